@@ -3,55 +3,14 @@ package main
 import (
 	"fmt"
 
+	"git.enflame.cn/hai.bai/dmaster/rtinfo"
 	"git.enflame.cn/hai.bai/dmaster/rtinfo/rtdata"
 )
 
-type normalDumper struct {
-	taskToNameMap map[int]map[string]int
-}
-
-func NewNormalDumper() *normalDumper {
-	return &normalDumper{
-		taskToNameMap: make(map[int]map[string]int),
-	}
-}
-
-func (d *normalDumper) GetPidAndName(act rtdata.OpActivity) (bool, string, string, string) {
-	if act.IsOpRefValid() {
-
-		taskId := act.GetTask().TaskID
-		var nameMap map[string]int
-		if nm, ok := d.taskToNameMap[taskId]; ok {
-			nameMap = nm
-		} else {
-			nameMap = make(map[string]int)
-			d.taskToNameMap[taskId] = nameMap
-		}
-
-		opMeta := act.GetOp()
-		opNameWithOpId := fmt.Sprintf("%v.%v", opMeta.OpName, opMeta.OpId)
-		uniqueOpName := opNameWithOpId
-		var subSeq int
-		var ok bool
-		if subSeq, ok = nameMap[opNameWithOpId]; ok {
-			subSeq++
-			uniqueOpName += fmt.Sprintf(".%v", subSeq)
-		}
-		nameMap[opNameWithOpId] = subSeq
-		return true,
-			act.GetTask().ToShortString(), // Process name
-			opMeta.OpName, // Thread name
-			uniqueOpName // Thread name with op id
-	}
-	return false, "Unknown Task", "Unk", "Unk"
-}
-
-type wildInDumper struct {
-	notWildInCount int
-}
+// The ops left over by GenerateDtuOps but still with op ref set
+type wildInDumper struct{}
 
 func (w *wildInDumper) GetPidAndName(act rtdata.OpActivity) (bool, string, string, string) {
-	//+ act.GetTask().ToShortString(),
 	if act.IsOpRefValid() {
 		rawOpName := act.GetOp().OpName
 		opId := act.GetOp().OpId
@@ -59,19 +18,26 @@ func (w *wildInDumper) GetPidAndName(act rtdata.OpActivity) (bool, string, strin
 			rawOpName,
 			fmt.Sprintf("%v.%v", rawOpName, opId)
 	}
-	w.notWildInCount++
 	return false, "", "", ""
 }
 
+// Acts come in the same order of the attributions
 type wildOutDumper struct {
-	subSampleCc int
+	attribs []rtinfo.WildAttribution
+	cursor  int
+}
+
+func newWildOutDumper(report rtinfo.WildAttribReport) *wildOutDumper {
+	return &wildOutDumper{attribs: report.Attribs}
 }
 
 func (w *wildOutDumper) GetPidAndName(act rtdata.OpActivity) (bool, string, string, string) {
-	//+ act.GetTask().ToShortString(),
-	w.subSampleCc++
-	if w.subSampleCc%17 == 0 {
-		return true, "Wild Out", "some op", "some op"
+	if w.cursor >= len(w.attribs) {
+		return false, "", "", ""
 	}
-	return false, "", "", ""
+	attrib := w.attribs[w.cursor]
+	w.cursor++
+	return true, "Wild Out",
+		attrib.Ambiguity.String(),
+		attrib.Label()
 }
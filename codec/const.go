@@ -35,3 +35,23 @@ func IsCqmOpEvent(evt DpfEvent) bool {
 	return (evt.EngineTypeCode == EngCat_CQM || evt.EngineTypeCode == EngCat_GSYNC) &&
 		(evt.Event == CqmEventOpStart || evt.Event == CqmEventOpEnd)
 }
+
+// Kernel asserts come as V2(flag=1) SIP events,
+// the payload carries the cause id in SHT_KERN_ASSERT_INFO.
+// No firmware header in this tree defines the event id, 0x7f is only
+// the default, set the one of the firmware by SetKernelAssertEvent.
+const (
+	SipEventKernelAssert = 0x7f
+)
+
+var kernelAssertEvent = SipEventKernelAssert
+
+// SetKernelAssertEvent is to be called before decoding
+func SetKernelAssertEvent(event int) {
+	kernelAssertEvent = event
+}
+
+func IsKernelAssertEvent(evt DpfEvent) bool {
+	return evt.Flag == 1 && evt.EngineTypeCode == EngCat_SIP &&
+		evt.Event == kernelAssertEvent
+}
@@ -0,0 +1,171 @@
+package dbexport
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"git.enflame.cn/hai.bai/dmaster/assert"
+)
+
+// Every dump into a vpd is a capture, appending adds one more.
+// Rows of all the tables but the bookkeeping ones are tagged by capture_id.
+const (
+	createCaptureTable = `
+	CREATE TABLE capture(capture_id INT,source TEXT,create_time TEXT,
+		idx_begin INT,idx_end INT,vp_id_begin INT,vp_id_end INT);`
+)
+
+const captureIdColumn = "capture_id"
+
+func init() {
+	RegisterTabInitCommand(createCaptureTable)
+}
+
+// Tables not tagged by capture id
+var untaggedTables = map[string]bool{
+	"header":         true,
+	"capture":        true,
+	"schema_version": true,
+}
+
+// Both *sql.DB and *sql.Tx
+type dbQueryer interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+func listTables(db dbQueryer) ([]string, error) {
+	rows, err := db.Query(
+		`select name from sqlite_master where type = 'table' order by name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var rv []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		rv = append(rv, name)
+	}
+	return rv, rows.Err()
+}
+
+func tableColumns(db dbQueryer, table string) (map[string]bool, error) {
+	rows, err := db.Query(fmt.Sprintf(`select name from pragma_table_info('%v')`,
+		table))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	rv := make(map[string]bool)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		rv[name] = true
+	}
+	return rv, rows.Err()
+}
+
+func maxOfColumn(db dbQueryer, table, col string) (sql.NullInt64, error) {
+	var v sql.NullInt64
+	err := db.QueryRow(fmt.Sprintf(`select max(%v) from %v`,
+		col, table)).Scan(&v)
+	return v, err
+}
+
+// Where the last capture stopped, and the capture id to go on with
+type captureCursor struct {
+	captureId int
+	nextIdx   int
+	lastVpId  int
+	tagged    []string // tables with capture_id
+}
+
+// prepareCapture adds capture_id to the tables without it,
+// and finds the max idx, vp_id and capture_id in use
+func prepareCapture(db *sql.DB) (captureCursor, error) {
+	var rv captureCursor
+	tables, err := listTables(db)
+	if err != nil {
+		return rv, err
+	}
+	for _, table := range tables {
+		cols, err := tableColumns(db, table)
+		if err != nil {
+			return rv, err
+		}
+		if cols["idx"] {
+			maxIdx, err := maxOfColumn(db, table, "idx")
+			if err != nil {
+				return rv, err
+			}
+			if maxIdx.Valid && int(maxIdx.Int64)+1 > rv.nextIdx {
+				rv.nextIdx = int(maxIdx.Int64) + 1
+			}
+		}
+		if cols["vp_id"] {
+			maxVpId, err := maxOfColumn(db, table, "vp_id")
+			if err != nil {
+				return rv, err
+			}
+			if maxVpId.Valid && int(maxVpId.Int64) > rv.lastVpId {
+				rv.lastVpId = int(maxVpId.Int64)
+			}
+		}
+		if untaggedTables[table] {
+			continue
+		}
+		if !cols[captureIdColumn] {
+			if _, err := db.Exec(fmt.Sprintf(
+				`alter table %v add column %v INT`,
+				table, captureIdColumn)); err != nil {
+				return rv, err
+			}
+		}
+		rv.tagged = append(rv.tagged, table)
+	}
+
+	var maxCaptureId sql.NullInt64
+	if err := db.QueryRow(`select max(capture_id) from capture`).
+		Scan(&maxCaptureId); err != nil {
+		return rv, err
+	}
+	if maxCaptureId.Valid {
+		rv.captureId = int(maxCaptureId.Int64) + 1
+	}
+	return rv, nil
+}
+
+type CaptureSession struct {
+	TableSession
+}
+
+func NewCaptureSession(db *sql.DB) *CaptureSession {
+	return &CaptureSession{
+		TableSession: NewTableSession(db, `insert into capture(
+			capture_id, source, create_time,
+			idx_begin, idx_end, vp_id_begin, vp_id_end)
+			values(?, ?, ?, ?, ?, ?, ?)`),
+	}
+}
+
+// AddCapture tags the rows written since the session opened
+func (cs *CaptureSession) AddCapture(captureId int, source string,
+	idxBegin, idxEnd, vpIdBegin, vpIdEnd int, tagged []string) {
+	for _, table := range tagged {
+		_, err := cs.tx.Exec(fmt.Sprintf(
+			`update %v set %v = ? where %v is null`,
+			table, captureIdColumn, captureIdColumn), captureId)
+		assert.Assert(err == nil, "Must be nil error: %v", err)
+	}
+	_, err := cs.stmt.Exec(captureId, source,
+		time.Now().Format(time.RFC3339),
+		idxBegin, idxEnd, vpIdBegin, vpIdEnd)
+	assert.Assert(err == nil, "Must be nil error: %v", err)
+}
@@ -0,0 +1,107 @@
+package dbexport
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"git.enflame.cn/hai.bai/dmaster/rtinfo"
+	"git.enflame.cn/hai.bai/dmaster/rtinfo/rtdata"
+)
+
+func dumpCoverageCapture(t *testing.T, target string, opt DbSessionOpt,
+	taskCount int) {
+	dbs, err := OpenDbSession(target, opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var report rtinfo.OpCoverageReport
+	for i := 0; i < taskCount; i++ {
+		report.Tasks = append(report.Tasks, rtinfo.TaskOpCoverage{TaskID: i})
+	}
+	dbs.DumpOpCoverage(rtdata.Coords{}, report)
+	dbs.Close()
+}
+
+func TestAppendCaptures(t *testing.T) {
+	target := filepath.Join(t.TempDir(), "foo.vpd")
+	dumpCoverageCapture(t, target, DbSessionOpt{Source: "a"}, 2)
+	dumpCoverageCapture(t, target, DbSessionOpt{Append: true, Source: "b"}, 1)
+
+	db, err := sql.Open("sqlite3", target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	rows, err := db.Query(`select idx, capture_id from op_coverage order by idx`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got [][2]int
+	for rows.Next() {
+		var idx, captureId int
+		rows.Scan(&idx, &captureId)
+		got = append(got, [2]int{idx, captureId})
+	}
+	rows.Close()
+	expected := [][2]int{{0, 0}, {1, 0}, {2, 1}}
+	if len(got) != len(expected) {
+		t.Fatalf("expecting %v, got %v", expected, got)
+	}
+	for i := range expected {
+		if got[i] != expected[i] {
+			t.Errorf("expecting %v, got %v", expected, got)
+			break
+		}
+	}
+
+	var source string
+	var idxBegin, idxEnd int
+	if err := db.QueryRow(`select source, idx_begin, idx_end from capture
+		where capture_id = 1`).Scan(&source, &idxBegin, &idxEnd); err != nil {
+		t.Fatal(err)
+	}
+	if source != "b" || idxBegin != 2 || idxEnd != 2 {
+		t.Errorf("unexpected capture 1: %v [%v, %v]", source, idxBegin, idxEnd)
+	}
+
+	for table, count := range map[string]int{"op_coverage": 3, "capture": 2} {
+		var n int
+		if err := db.QueryRow(`select count from header where table_name = ?`,
+			table).Scan(&n); err != nil {
+			t.Fatal(err)
+		}
+		if n != count {
+			t.Errorf("expecting header count %v of %v, got %v", count, table, n)
+		}
+	}
+
+	// The version of the rows before is kept
+	if _, err := db.Exec(`update header set version = '0.9'
+		where table_name = 'op_coverage'`); err != nil {
+		t.Fatal(err)
+	}
+	dumpCoverageCapture(t, target, DbSessionOpt{Append: true, Source: "c"}, 1)
+	var version string
+	var count int
+	db.QueryRow(`select version, count from header
+		where table_name = 'op_coverage'`).Scan(&version, &count)
+	if version != "0.9" || count != 4 {
+		t.Errorf("expecting version 0.9 of 4 rows kept, got %v of %v",
+			version, count)
+	}
+
+	// Without append it starts over
+	dumpCoverageCapture(t, target, DbSessionOpt{}, 1)
+	db1, err := sql.Open("sqlite3", target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db1.Close()
+	var captures int
+	db1.QueryRow(`select count(*) from capture`).Scan(&captures)
+	if captures != 1 {
+		t.Errorf("expecting the vpd recreated, got %v captures", captures)
+	}
+}
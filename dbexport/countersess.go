@@ -0,0 +1,82 @@
+package dbexport
+
+import (
+	"database/sql"
+	"log"
+
+	"git.enflame.cn/hai.bai/dmaster/assert"
+	"git.enflame.cn/hai.bai/dmaster/rtinfo"
+	"git.enflame.cn/hai.bai/dmaster/rtinfo/rtdata"
+)
+
+// Time series of a device, one row per value change of a track.
+// The value holds from its timestamp until the next one of the track.
+const (
+	createCounterTable = `
+	CREATE TABLE counter(idx INT,node_id INT,device_id INT,
+		track_name TEXT,unit TEXT,timestamp INT,value REAL);`
+)
+
+func init() {
+	RegisterTabInitCommand(createCounterTable)
+	RegisterSchemaMigration(SchemaMigration{
+		Version:     8,
+		Description: "counter table",
+		Up: func(tx *sql.Tx) error {
+			if err := createTablesIfMissing(tx, createCounterTable); err != nil {
+				return err
+			}
+			return createIndexesAndViews(tx)
+		},
+	})
+}
+
+type CounterSession struct {
+	TableSession
+}
+
+func NewCounterSession(db *sql.DB) *CounterSession {
+	return &CounterSession{
+		TableSession: NewTableSession(db, `insert into counter(
+			idx, node_id, device_id,
+			track_name, unit, timestamp, value
+		) values(?, ?, ?,
+				 ?, ?, ?, ?)`),
+	}
+}
+
+func (ctrS *CounterSession) AddCounter(idx, nodeID, devID int,
+	trackName, unit string, timestamp uint64, value float64) {
+	_, err := ctrS.stmt.Exec(idx, nodeID, devID,
+		trackName, unit, timestamp, value,
+	)
+	assert.Assert(err == nil, "Must be nil error: %v", err)
+}
+
+func (dbs *DbSession) DumpCounters(
+	coords rtdata.Coords,
+	tracks []rtinfo.CounterTrack,
+	tm *rtinfo.TimelineManager,
+) {
+	ctrS := NewCounterSession(dbs.dbObject)
+	defer ctrS.Close()
+	nodeID, deviceID := coords.NodeID, coords.DeviceID
+	pointCount := 0
+	for _, track := range tracks {
+		for _, pt := range track.Points {
+			hosttime, ok := tm.MapToHosttime(pt.Cycle)
+			if !ok {
+				continue
+			}
+			ctrS.AddCounter(dbs.idx, nodeID, deviceID,
+				track.Name, track.Unit, hosttime, pt.Value)
+			dbs.itemStat.counterCount++
+			dbs.idx++
+			pointCount++
+		}
+	}
+	log.Printf("# %v value(s) of %v counter track(s) have been traced into %v",
+		pointCount, len(tracks),
+		dbs.targetName,
+	)
+}
@@ -0,0 +1,58 @@
+package dbexport
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"git.enflame.cn/hai.bai/dmaster/rtinfo"
+	"git.enflame.cn/hai.bai/dmaster/rtinfo/rtdata"
+)
+
+func TestDumpCounters(t *testing.T) {
+	target := filepath.Join(t.TempDir(), "foo.vpd")
+	dbs, err := NewDbSession(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	point := func(cycle uint64, value float64) rtinfo.CounterPoint {
+		return rtinfo.CounterPoint{Cycle: cycle, Value: value}
+	}
+	tracks := []rtinfo.CounterTrack{
+		{Name: "DMA in flight", Unit: "count",
+			Points: []rtinfo.CounterPoint{point(100, 1), point(200, 2), point(300, 0)}},
+		{Name: "queue depth", Unit: "count",
+			Points: []rtinfo.CounterPoint{point(150, 4)}},
+	}
+	// The -devalign correction is set after the counters are generated,
+	// device cycles are taken as host ns
+	tm := &rtinfo.TimelineManager{}
+	tm.SetHostCorrection(1000)
+	dbs.DumpCounters(rtdata.Coords{DeviceID: 1}, tracks, tm)
+	dbs.Close()
+
+	db, err := sql.Open("sqlite3", target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	var value float64
+	if err := db.QueryRow(`select value from counter
+		where device_id = 1 and track_name = 'DMA in flight'
+		and timestamp <= 1250 order by timestamp desc limit 1`).Scan(&value); err != nil {
+		t.Fatal(err)
+	}
+	if value != 2 {
+		t.Errorf("expecting 2 in flight at 1250, got %v", value)
+	}
+	var first uint64
+	db.QueryRow(`select min(timestamp) from counter`).Scan(&first)
+	if first != 1100 {
+		t.Errorf("expecting the counters shifted by the correction to 1100, got %v", first)
+	}
+	var count int
+	db.QueryRow(`select count from header where table_name = 'counter'`).Scan(&count)
+	if count != 4 {
+		t.Errorf("expecting 4 counter values in header, got %v", count)
+	}
+}
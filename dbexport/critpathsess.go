@@ -0,0 +1,63 @@
+package dbexport
+
+import (
+	"database/sql"
+
+	"git.enflame.cn/hai.bai/dmaster/assert"
+)
+
+const (
+	CriticalPathRowName = "Critical Path"
+)
+
+const (
+	createCriticalPathTable = `
+	CREATE TABLE critical_path(idx INT,node_id INT,device_id INT,
+		task_id INT,exec_uuid TEXT,
+		start_timestamp INT,end_timestamp INT,
+		start_cycle INT,end_cycle INT,duration_cycle INT,
+		compute_cycle INT,dma_cycle INT,cqm_cycle INT,idle_cycle INT,
+		step_count INT,bound_by TEXT);`
+)
+
+func init() {
+	RegisterTabInitCommand(createCriticalPathTable)
+}
+
+type CriticalPathSession struct {
+	TableSession
+}
+
+func NewCriticalPathSession(db *sql.DB) *CriticalPathSession {
+	return &CriticalPathSession{
+		TableSession: NewTableSession(db, `insert into critical_path(
+			idx, node_id, device_id,
+			task_id, exec_uuid,
+			start_timestamp, end_timestamp,
+			start_cycle, end_cycle, duration_cycle,
+			compute_cycle, dma_cycle, cqm_cycle, idle_cycle,
+			step_count, bound_by
+		) values(?, ?, ?,
+				 ?, ?,
+				 ?, ?,
+				 ?, ?, ?,
+				 ?, ?, ?, ?,
+				 ?, ?)`),
+	}
+}
+
+func (cpS *CriticalPathSession) AddCriticalPath(idx, nodeID, devID int,
+	taskId int, execUuid string,
+	startTS, endTS uint64,
+	startCy, endCy, durCy uint64,
+	computeCy, dmaCy, cqmCy, idleCy uint64,
+	stepCount int, boundBy string) {
+	_, err := cpS.stmt.Exec(idx, nodeID, devID,
+		taskId, execUuid,
+		startTS, endTS,
+		startCy, endCy, durCy,
+		computeCy, dmaCy, cqmCy, idleCy,
+		stepCount, boundBy,
+	)
+	assert.Assert(err == nil, "Must be nil error: %v", err)
+}
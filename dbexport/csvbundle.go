@@ -0,0 +1,194 @@
+package dbexport
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+const CsvBundleManifest = "manifest.json"
+
+type CsvBundleTable struct {
+	Table   string   `json:"table"`
+	File    string   `json:"file"`
+	Rows    int      `json:"rows"`
+	Columns []string `json:"columns"`
+}
+
+type CsvBundleManifestInfo struct {
+	Separator string           `json:"separator"`
+	Tables    []CsvBundleTable `json:"tables"`
+	Note      string           `json:"note"`
+}
+
+// CsvBundleSession dumps into a scratch vpd the same way DbSession does,
+// then writes every table of it into the output directory on Close,
+// so the columns are always those of the sqlite schema.
+type CsvBundleSession struct {
+	*DbSession
+	outDir  string
+	scratch string
+	comma   rune
+}
+
+// NewCsvBundleSession writes CSV files with comma ',' and TSV with '\t'
+func NewCsvBundleSession(outDir string, comma rune) (*CsvBundleSession, error) {
+	if err := os.MkdirAll(outDir, 0755); err != nil {
+		return nil, err
+	}
+	fout, err := os.CreateTemp(outDir, ".scratch-*.vpd")
+	if err != nil {
+		return nil, err
+	}
+	scratch := fout.Name()
+	fout.Close()
+	dbs, err := NewDbSession(scratch)
+	if err != nil {
+		os.Remove(scratch)
+		return nil, err
+	}
+	dbs.targetName = outDir
+	return &CsvBundleSession{
+		DbSession: dbs,
+		outDir:    outDir,
+		scratch:   scratch,
+		comma:     comma,
+	}, nil
+}
+
+func (cs *CsvBundleSession) Close() {
+	cs.DbSession.Close()
+	defer os.Remove(cs.scratch)
+
+	db, err := sql.Open("sqlite3", cs.scratch)
+	if err != nil {
+		log.Printf("error open %v: %v", cs.scratch, err)
+		return
+	}
+	defer db.Close()
+	manifest, err := ExportCsvBundle(db, cs.outDir, cs.comma)
+	if err != nil {
+		log.Printf("error export csv bundle: %v", err)
+		return
+	}
+	log.Printf("# %v table(s) have been exported into %v",
+		len(manifest.Tables), cs.outDir)
+}
+
+func csvBundleExt(comma rune) string {
+	if comma == '\t' {
+		return ".tsv"
+	}
+	return ".csv"
+}
+
+// ExportCsvBundle writes each table of the db into outDir, one file per
+// table with a header line of the column names, and the manifest last.
+func ExportCsvBundle(db *sql.DB, outDir string, comma rune) (
+	CsvBundleManifestInfo, error) {
+	ext := csvBundleExt(comma)
+	manifest := CsvBundleManifestInfo{
+		Separator: string(comma),
+		Note:      "tasks, cpu ops, critical path steps and assert marks are dtu_op rows told apart by row_name",
+	}
+
+	var tables []string
+	rows, err := db.Query(
+		`select name from sqlite_master where type = 'table' order by name`)
+	if err != nil {
+		return manifest, err
+	}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return manifest, err
+		}
+		tables = append(tables, name)
+	}
+	rows.Close()
+
+	for _, table := range tables {
+		entry := CsvBundleTable{Table: table, File: table + ext}
+		if err := exportCsvTable(db, filepath.Join(outDir, entry.File),
+			comma, &entry); err != nil {
+			return manifest, fmt.Errorf("table %v: %v", table, err)
+		}
+		manifest.Tables = append(manifest.Tables, entry)
+	}
+
+	chunk, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return manifest, err
+	}
+	err = os.WriteFile(filepath.Join(outDir, CsvBundleManifest), chunk, 0644)
+	return manifest, err
+}
+
+func exportCsvTable(db *sql.DB, target string, comma rune,
+	entry *CsvBundleTable) error {
+	rows, err := db.Query(fmt.Sprintf(`select * from "%v" order by rowid`,
+		entry.Table))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	if entry.Columns, err = rows.Columns(); err != nil {
+		return err
+	}
+
+	fout, err := os.Create(target)
+	if err != nil {
+		return err
+	}
+	defer fout.Close()
+	w := csv.NewWriter(fout)
+	w.Comma = comma
+	w.Write(entry.Columns)
+
+	values := make([]interface{}, len(entry.Columns))
+	ptrs := make([]interface{}, len(entry.Columns))
+	for i := range values {
+		ptrs[i] = &values[i]
+	}
+	record := make([]string, len(entry.Columns))
+	for rows.Next() {
+		if err := rows.Scan(ptrs...); err != nil {
+			return err
+		}
+		for i, v := range values {
+			record[i] = csvField(v)
+		}
+		w.Write(record)
+		entry.Rows++
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	w.Flush()
+	return w.Error()
+}
+
+// NULL goes as the empty field
+func csvField(v interface{}) string {
+	switch val := v.(type) {
+	case nil:
+		return ""
+	case []byte:
+		return string(val)
+	case string:
+		return val
+	case int64:
+		return strconv.FormatInt(val, 10)
+	case float64:
+		return strconv.FormatFloat(val, 'g', -1, 64)
+	case bool:
+		return strconv.FormatBool(val)
+	}
+	return fmt.Sprint(v)
+}
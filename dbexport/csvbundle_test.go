@@ -0,0 +1,65 @@
+package dbexport
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"git.enflame.cn/hai.bai/dmaster/rtinfo/rtdata"
+)
+
+func TestCsvBundle(t *testing.T) {
+	outDir := filepath.Join(t.TempDir(), "bundle")
+	cs, err := NewCsvBundleSession(outDir, '\t')
+	if err != nil {
+		t.Fatal(err)
+	}
+	cs.DumpCpuOpTrace(rtdata.Coords{}, []rtdata.CpuOpAct{
+		{Cat: "BACKEND", Name: "a,b", StartTimestamp: 0, EndTimestamp: 100},
+		{Cat: "BACKEND", Name: "c", StartTimestamp: 50, EndTimestamp: 80},
+	}, "CPU Op")
+	cs.Close()
+
+	buf, err := os.ReadFile(filepath.Join(outDir, CsvBundleManifest))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var manifest CsvBundleManifestInfo
+	if err := json.Unmarshal(buf, &manifest); err != nil {
+		t.Fatal(err)
+	}
+	var dtuOp *CsvBundleTable
+	for i, entry := range manifest.Tables {
+		if entry.Table == "dtu_op" {
+			dtuOp = &manifest.Tables[i]
+		}
+	}
+	if dtuOp == nil || dtuOp.File != "dtu_op.tsv" || dtuOp.Rows != 2 {
+		t.Fatalf("unexpected dtu_op entry: %+v", dtuOp)
+	}
+
+	fin, err := os.Open(filepath.Join(outDir, dtuOp.File))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fin.Close()
+	r := csv.NewReader(fin)
+	r.Comma = '\t'
+	records, err := r.ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 3 || len(records[0]) != len(dtuOp.Columns) {
+		t.Fatalf("expecting header and 2 rows of %v columns, got %v",
+			len(dtuOp.Columns), records)
+	}
+	if records[0][0] != "idx" || records[0][1] != "name" || records[1][1] != "a,b" {
+		t.Errorf("unexpected records: %v", records[:2])
+	}
+
+	if matches, _ := filepath.Glob(filepath.Join(outDir, ".scratch-*")); len(matches) > 0 {
+		t.Errorf("scratch vpd left: %v", matches)
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"os"
 
 	"git.enflame.cn/hai.bai/dmaster/codec"
+	"git.enflame.cn/hai.bai/dmaster/meta/metadata"
 	"git.enflame.cn/hai.bai/dmaster/rtinfo"
 	"git.enflame.cn/hai.bai/dmaster/rtinfo/rtdata"
 	"git.enflame.cn/hai.bai/dmaster/topsdev/mimic/mimicdefs"
@@ -37,19 +38,30 @@ type AddFwTrace func(idx, nodeID, devID, clusterID, ctxID int, name string,
 )
 
 type ItemStat struct {
-	dtuOpCount    int
-	taskActCount  int
-	fwOpCount     int
-	dmaOpCount    int
-	kernelOpCount int
-	cmdInfoCount  int
-	verInfoCount  int
-	platformCount int
-	cpuOpCount    int
+	dtuOpCount      int
+	taskActCount    int
+	fwOpCount       int
+	dmaOpCount      int
+	kernelOpCount   int
+	cmdInfoCount    int
+	verInfoCount    int
+	platformCount   int
+	cpuOpCount      int
+	opCovCount      int
+	critStepCount   int
+	critPathCount   int
+	engUtilCount    int
+	pgUtilCount     int
+	assertCount     int
+	assertMarks     int
+	provenanceCount int
+	flowCount       int
+	counterCount    int
 }
 
 func (item ItemStat) GetOpCount() int {
-	return item.dtuOpCount + item.taskActCount + item.cpuOpCount
+	return item.dtuOpCount + item.taskActCount + item.cpuOpCount +
+		item.critStepCount + item.assertMarks
 }
 
 type DbSession struct {
@@ -57,16 +69,42 @@ type DbSession struct {
 	dbObject   *sql.DB
 	idx        int
 
+	capture   captureCursor
+	source    string
+	idxBegin  int
+	vpIdBegin int
+	vpIds     *VpIdAllocator
+
+	// A stage is merged into its session, see OpenStages
+	staged bool
+
+	// Links of the device being dumped, see DumpFlows
+	flows *flowEnds
+
 	itemStat ItemStat
 }
 
+type DbSessionOpt struct {
+	// Append onto the target if it exists, otherwise it is recreated
+	Append bool
+	// Where the rows come from, the target name if empty
+	Source string
+}
+
 func ifFileExist(file string) bool {
 	stat, err := os.Stat(file)
 	return nil == err && !stat.IsDir()
 }
 
 func NewDbSession(target string) (*DbSession, error) {
-	if ifFileExist(target) {
+	return OpenDbSession(target, DbSessionOpt{})
+}
+
+// OpenDbSession starts a new capture in the target, with append the idx
+// and vp ids go on from the captures already there
+func OpenDbSession(target string, opt DbSessionOpt) (*DbSession, error) {
+	appending := opt.Append && ifFileExist(target)
+	if ifFileExist(target) && !appending {
 		os.Remove(target)
 	}
 
@@ -75,37 +113,106 @@ func NewDbSession(target string) (*DbSession, error) {
 		return nil, err
 	}
 
-	sqlStmt := getDbInitSchema()
-	_, err = db.Exec(sqlStmt)
+	if appending {
+		// Older vpd gets the tables and columns of now first
+		if _, _, err := MigrateSchema(db); err != nil {
+			db.Close()
+			return nil, err
+		}
+	} else {
+		sqlStmt := getDbInitSchema()
+		_, err = db.Exec(sqlStmt)
+		if err != nil {
+			log.Printf("%q: %s\n", err, sqlStmt)
+			return nil, err
+		}
+		if err := recordSchemaVersion(db, CurrentSchemaVersion(),
+			"created"); err != nil {
+			db.Close()
+			return nil, err
+		}
+	}
+
+	cursor, err := prepareCapture(db)
 	if err != nil {
-		log.Printf("%q: %s\n", err, sqlStmt)
+		db.Close()
 		return nil, err
 	}
+	vpIds := &VpIdAllocator{}
+	vpIds.ContinueAfter(cursor.lastVpId)
+	source := opt.Source
+	if source == "" {
+		source = target
+	}
+	if appending {
+		log.Printf("append to %v as capture %v, from idx %v",
+			target, cursor.captureId, cursor.nextIdx)
+	}
 
 	return &DbSession{
-		dbObject: db,
+		targetName: target,
+		dbObject:   db,
+		idx:        cursor.nextIdx,
+		capture:    cursor,
+		source:     source,
+		idxBegin:   cursor.nextIdx,
+		vpIdBegin:  vpIds.Current() + 1,
+		vpIds:      vpIds,
 	}, nil
 }
 
 func (dbs *DbSession) Close() {
+	dbs.flushFlows()
+	if dbs.staged {
+		dbs.dbObject.Close()
+		return
+	}
 	log.Printf("finish db session")
+	cs := NewCaptureSession(dbs.dbObject)
+	cs.AddCapture(dbs.capture.captureId, dbs.source,
+		dbs.idxBegin, dbs.idx-1, dbs.vpIdBegin, dbs.vpIds.Current(),
+		dbs.capture.tagged)
+	cs.Close()
+
 	hs := NewHeaderSess(dbs.dbObject)
-	// Finalize headers, not until the end do we know the count
-	hs.AddHeader("dtu_op", "1.0",
+	// Finalize headers, not until the end do we know the count,
+	// counts of the captures before are added up
+	hs.AccumulateHeader("dtu_op", "1.0",
 		TableCategory_DTUOpActivity, dbs.itemStat.GetOpCount(), "ns")
-	hs.AddHeader("fw", "1.0",
+	hs.AccumulateHeader("fw", "1.0",
 		TableCategory_DTUFwActivity, dbs.itemStat.fwOpCount, "ns")
-	hs.AddHeader("memcpy", "1.0",
+	hs.AccumulateHeader("memcpy", "1.1",
 		TableCategory_DTUMemcpyActivity, dbs.itemStat.dmaOpCount, "ns")
-	hs.AddHeader("kernel", "1.0",
+	hs.AccumulateHeader("kernel", "1.0",
 		TableCategory_DTUKernelActivity, dbs.itemStat.kernelOpCount, "ns")
-	hs.AddHeader("command", "2.0",
+	hs.AccumulateHeader("command", "2.0",
 		TableCategory_CommandInfo, dbs.itemStat.cmdInfoCount, "ns")
-	hs.AddHeader("version", "2.0",
+	hs.AccumulateHeader("version", "2.0",
 		TableCategory_VersionInfo, dbs.itemStat.verInfoCount, "ns")
-	hs.AddHeader("platform", "2.0",
+	hs.AccumulateHeader("platform", "2.0",
 		TableCategroy_Platform, dbs.itemStat.platformCount, "ns")
+	hs.AccumulateHeader("op_coverage", "1.0",
+		TableCategory_OpCoverage, dbs.itemStat.opCovCount, "cycle")
+	hs.AccumulateHeader("critical_path", "1.0",
+		TableCategory_CriticalPath, dbs.itemStat.critPathCount, "ns")
+	hs.AccumulateHeader("engine_utilization", "1.0",
+		TableCategory_EngineUtil, dbs.itemStat.engUtilCount, "cycle")
+	hs.AccumulateHeader("pg_utilization", "1.0",
+		TableCategory_PgUtil, dbs.itemStat.pgUtilCount, "cycle")
+	hs.AccumulateHeader("kernel_assert", "1.0",
+		TableCategory_KernelAssert, dbs.itemStat.assertCount, "ns")
+	hs.AccumulateHeader("provenance", "1.0",
+		TableCategory_Provenance, dbs.itemStat.provenanceCount, "")
+	hs.AccumulateHeader("flow", "1.0",
+		TableCategory_Flow, dbs.itemStat.flowCount, "")
+	hs.AccumulateHeader("counter", "1.0",
+		TableCategory_Counter, dbs.itemStat.counterCount, "ns")
+	hs.AccumulateHeader("capture", "1.0",
+		TableCategory_Capture, 1, "")
 	hs.Close()
+	if err := createIndexesAndViews(dbs.dbObject); err != nil {
+		log.Printf("error create indexes of %v: %v", dbs.targetName, err)
+	}
 	// And finally , close DB handle
 	dbs.dbObject.Close()
 }
@@ -115,7 +222,7 @@ func (dbs *DbSession) DumpDtuOps(
 	bundle []rtdata.OpActivity,
 	tm *rtinfo.TimelineManager,
 ) {
-	dos := NewDtuOpSession(dbs.dbObject)
+	dos := NewDtuOpSession(dbs.dbObject, dbs.vpIds)
 	defer dos.Close()
 	nc := NewNameConverter()
 	dtuOpCount, convertToHostError := 0, 0
@@ -140,11 +247,14 @@ func (dbs *DbSession) DumpDtuOps(
 			if startOK && endOK {
 				name1 := nc.GetIndexedName(0, act.Start.Context,
 					name)
-				dos.AddDtuOp(dbs.idx, nodeID, deviceID, clusterID, act.Start.Context, name1,
+				task := act.GetTask()
+				dbs.markFlow(rtinfo.FlowNode_Op, act.DpfAct)
+				dos.AddDtuOpOfTask(dbs.idx, nodeID, deviceID, clusterID, act.Start.Context, name1,
 					startHostTime, endHostTime, endHostTime-startHostTime,
 					act.StartCycle(), act.EndCycle(), act.EndCycle()-act.StartCycle(),
 					act.GetOp().OpId, name,
 					DtuOpRowName,
+					task.TaskID, task.ExecutableUUID,
 				)
 				dbs.itemStat.dtuOpCount++
 				dbs.idx++
@@ -167,7 +277,7 @@ func (dbs *DbSession) DumpCpuOpTrace(
 	cpuOps []rtdata.CpuOpAct,
 	rowName string,
 ) {
-	dos := NewDtuOpSession(dbs.dbObject)
+	dos := NewDtuOpSession(dbs.dbObject, dbs.vpIds)
 	defer dos.Close()
 	nodeID := coords.NodeID
 	deviceID := coords.DeviceID
@@ -192,7 +302,7 @@ func (dbs *DbSession) DumpTaskVec(
 	taskActMap map[int]rtdata.FwActivity,
 	tm *rtinfo.TimelineManager,
 ) {
-	dos := NewDtuOpSession(dbs.dbObject)
+	dos := NewDtuOpSession(dbs.dbObject, dbs.vpIds)
 	defer dos.Close()
 
 	nodeID, deviceID := coords.NodeID, coords.DeviceID
@@ -226,11 +336,12 @@ func (dbs *DbSession) DumpTaskVec(
 			name += " ->..."
 		}
 
-		dos.AddDtuOp(dbs.idx, nodeID, deviceID, clusterID, contextID, name,
+		dos.AddDtuOpOfTask(dbs.idx, nodeID, deviceID, clusterID, contextID, name,
 			startHostTime, endHostTime, endHostTime-startHostTime,
 			startCy, endCy, durationCycle,
 			0, name,
 			rowName,
+			task.TaskID, task.ExecutableUUID,
 		)
 		dbs.itemStat.taskActCount++
 		dbs.idx++
@@ -243,7 +354,7 @@ func (dbs *DbSession) DumpFwActs(
 	taskActMap map[int]rtdata.FwActivity,
 	tm *rtinfo.TimelineManager,
 ) {
-	fw := NewFwSession(dbs.dbObject)
+	fw := NewFwSession(dbs.dbObject, dbs.vpIds)
 	defer fw.Close()
 
 	nc := NewNameConverter()
@@ -302,6 +413,9 @@ func (dbs *DbSession) DumpFwActs(
 				packetID = act.Start.PacketID
 				contextID = act.Start.Context
 			}
+			if kind, ok := rtinfo.FwFlowNodeKind(act); ok {
+				dbs.markFlow(kind, act.DpfAct)
+			}
 			fw.AddFwTrace(dbs.idx, nodeID, deviceID, act.Start.ClusterID, contextID, name,
 				startHostTime, endHostTime, endHostTime-startHostTime,
 				act.StartCycle(), act.EndCycle(), act.EndCycle()-act.StartCycle(),
@@ -351,10 +465,10 @@ func (dbs *DbSession) DumpFwActs(
 
 func (dbs *DbSession) DumpDmaActs(
 	coords rtdata.Coords,
-	bundle []rtdata.DmaActivity,
+	bundle []rtdata.CookedDmaActivity,
 	tm *rtinfo.TimelineManager,
 ) {
-	dmaS := NewDmaSession(dbs.dbObject)
+	dmaS := NewDmaSession(dbs.dbObject, dbs.vpIds)
 	defer dmaS.Close()
 
 	dmaActCount, convertToHostError := 0, 0
@@ -372,11 +486,13 @@ func (dbs *DbSession) DumpDmaActs(
 
 			name, _ := rtdata.ToDmaEventString(act.Start.Event)
 			tilingMode := act.Start.EngineTypeCode.String() // Unknown tiling mode(Slice,Transpose, etc)
+			metaCols := makeDmaMetaCols(act, tm)
 			if act.IsDmaMetaRefValid() {
 				dmaMeta := act.GetDmaMeta()
 				tilingMode = dmaMeta.DmaOpString
 			}
 
+			dbs.markFlow(rtinfo.FlowNode_Dma, act.DpfAct)
 			dmaS.AddDmaTrace(dbs.idx, nodeID, deviceID, act.Start.ClusterID,
 				contextID, name,
 				startHostTime, endHostTime, endHostTime-startHostTime,
@@ -385,6 +501,7 @@ func (dbs *DbSession) DumpDmaActs(
 				tilingMode,
 				act.GetEngineIndex(),
 				act.GetVcId(),
+				metaCols,
 			)
 			dbs.itemStat.dmaOpCount++
 			dbs.idx++
@@ -410,7 +527,41 @@ func (dbs *DbSession) DumpDmaActs(
 		dmaActCount,
 		dbs.targetName,
 	)
+}
 
+func makeDmaMetaCols(act rtdata.CookedDmaActivity,
+	tm *rtinfo.TimelineManager) DmaMetaCols {
+	cols := DmaMetaCols{MatchStatus: act.Status.String()}
+	if act.OwnerOpValid {
+		cols.OpId, cols.OpName = act.OwnerOpId, act.OwnerOpName
+	}
+	if !act.IsDmaMetaRefValid() {
+		return cols
+	}
+	task := act.GetTask()
+	cols.DmaOp = act.GetDmaMeta().DmaOpString
+	cols.TaskId = task.TaskID
+	cols.ExecUuid = fmt.Sprintf("0x%016x", task.ExecutableUUID)
+
+	bw, bwOK := rtinfo.DmaActBandwidth(act.DmaActivity, tm)
+	tr := bw.Transfer
+	if tr.AddrValid {
+		cols.SrcAddr, cols.DstAddr = tr.SrcAddr, tr.DstAddr
+	}
+	if tr.SrcSize > 0 {
+		cols.SrcSize = tr.SrcSize
+	}
+	if tr.DstSize > 0 {
+		cols.DstSize = tr.DstSize
+	}
+	if tr.Direction != "" {
+		cols.Direction = tr.Direction
+	}
+	if bwOK {
+		cols.Args = fmt.Sprintf(`{"bytes":%v,"bandwidth_gbps":%.6f}`,
+			bw.Bytes, bw.GBps)
+	}
+	return cols
 }
 
 func (dbs *DbSession) DumpKernelActs(
@@ -419,7 +570,7 @@ func (dbs *DbSession) DumpKernelActs(
 	tm *rtinfo.TimelineManager,
 	rowName string,
 ) {
-	dmaS := NewKernelSession(dbs.dbObject)
+	dmaS := NewKernelSession(dbs.dbObject, dbs.vpIds)
 	defer dmaS.Close()
 	nc := NewNameConverter()
 	nodeID, deviceID := coords.NodeID, coords.DeviceID
@@ -434,6 +585,20 @@ func (dbs *DbSession) DumpKernelActs(
 					act.ContextId(),
 					"SIP Act")
 			}
+			var attrib KernelAttribCols
+			if rtInfo := act.RtInfo; rtInfo.SubValid {
+				attrib.OpId = rtInfo.OpId
+				attrib.Confidence = rtInfo.Confidence
+				attrib.Reason = rtInfo.Reason.String()
+				// Make it visible on the timeline
+				if rtInfo.IsLowConfidence() {
+					name += " (?)"
+					attrib.Description = fmt.Sprintf(
+						"low confidence attribution: %v, %.4f",
+						rtInfo.Reason, rtInfo.Confidence)
+				}
+			}
+			dbs.markFlow(rtinfo.FlowNode_Kernel, act.DpfAct)
 			dmaS.AddKernelTrace(
 				dbs.idx, nodeID, deviceID, act.Start.ClusterID,
 				contextID, name,
@@ -441,6 +606,7 @@ func (dbs *DbSession) DumpKernelActs(
 				act.StartCycle(), act.EndCycle(), uint64(act.Duration()),
 				packetID, act.Start.EngineTypeCode.String(),
 				act.GetEngineIndex(), rowName,
+				attrib,
 			)
 			dbs.itemStat.kernelOpCount++
 			dbs.idx++
@@ -472,7 +638,204 @@ func (dbs *DbSession) DumpHostInfo(
 	platS := NewPlatformInfoSession(dbs.dbObject)
 	for _, plInfo := range hostInfo.PlatformInfo {
 		dbs.itemStat.platformCount++
-		platS.AddPlatform(plInfo.Product)
+		platS.AddPlatform(plInfo)
 	}
 	platS.Close()
 }
+
+func (dbs *DbSession) DumpOpCoverage(
+	coords rtdata.Coords,
+	coverage rtinfo.OpCoverageReport,
+) {
+	covS := NewOpCoverageSession(dbs.dbObject)
+	defer covS.Close()
+	nodeID, deviceID := coords.NodeID, coords.DeviceID
+	for _, t := range coverage.Tasks {
+		covS.AddOpCoverage(dbs.idx, nodeID, deviceID,
+			OpCoverageScope_Task,
+			t.TaskID, fmt.Sprintf("0x%016x", t.ExecUuid), t.PgMask, 1,
+			t.ExpectedOps, t.ObservedOps, t.Coverage(), rtinfo.JoinOpIds(t.MissingOpIds),
+			t.TotalCycles, float64(t.TotalCycles), t.TotalCycles, t.TotalCycles,
+			t.GapCycles, float64(t.LaunchGapCycles),
+		)
+		dbs.itemStat.opCovCount++
+		dbs.idx++
+	}
+	for _, e := range coverage.Execs {
+		covS.AddOpCoverage(dbs.idx, nodeID, deviceID,
+			OpCoverageScope_Exec,
+			-1, fmt.Sprintf("0x%016x", e.ExecUuid), 0, e.TaskCount,
+			e.ExpectedOps, e.ObservedOps, e.Coverage(), rtinfo.JoinOpIds(e.MissingOpIds),
+			e.TotalCycles, e.MeanCycles, e.MinCycles, e.MaxCycles,
+			0, e.MeanLaunchGapCycles,
+		)
+		dbs.itemStat.opCovCount++
+		dbs.idx++
+	}
+	log.Printf("# %v task(s) and %v executable(s) op coverage traced into %v",
+		len(coverage.Tasks), len(coverage.Execs),
+		dbs.targetName,
+	)
+}
+
+// DumpCriticalPaths puts each step onto its own track in dtu_op,
+// and the attribution of every task into critical_path
+func (dbs *DbSession) DumpCriticalPaths(
+	coords rtdata.Coords,
+	paths []rtinfo.TaskCriticalPath,
+	tm *rtinfo.TimelineManager,
+) {
+	nodeID, deviceID := coords.NodeID, coords.DeviceID
+	const clusterID = -1
+	const contextID = -1
+
+	dos := NewDtuOpSession(dbs.dbObject, dbs.vpIds)
+	for _, path := range paths {
+		for _, seg := range path.Segments {
+			startHostTime, startOK := tm.MapToHosttime(seg.StartCycle)
+			endHostTime, endOK := tm.MapToHosttime(seg.EndCycle)
+			if !startOK || !endOK {
+				continue
+			}
+			name := fmt.Sprintf("%v: %v", seg.Kind, seg.Name)
+			dos.AddDtuOp(dbs.idx, nodeID, deviceID, clusterID, contextID, name,
+				startHostTime, endHostTime, endHostTime-startHostTime,
+				seg.StartCycle, seg.EndCycle, seg.Cycles(),
+				seg.OpId, string(seg.Kind),
+				CriticalPathRowName,
+			)
+			dbs.itemStat.critStepCount++
+			dbs.idx++
+		}
+	}
+	dos.Close()
+
+	cpS := NewCriticalPathSession(dbs.dbObject)
+	defer cpS.Close()
+	for _, path := range paths {
+		startHostTime, startOK := tm.MapToHosttime(path.StartCycle)
+		endHostTime, endOK := tm.MapToHosttime(path.EndCycle)
+		if !startOK || !endOK {
+			continue
+		}
+		cpS.AddCriticalPath(dbs.idx, nodeID, deviceID,
+			path.TaskID, fmt.Sprintf("0x%016x", path.ExecUuid),
+			startHostTime, endHostTime,
+			path.StartCycle, path.EndCycle, path.TotalCycles(),
+			path.CycleByKind[rtinfo.CriticalKind_Compute],
+			path.CycleByKind[rtinfo.CriticalKind_Dma],
+			path.CycleByKind[rtinfo.CriticalKind_Cqm],
+			path.CycleByKind[rtinfo.CriticalKind_Idle],
+			len(path.Segments), string(path.BoundBy()),
+		)
+		dbs.itemStat.critPathCount++
+		dbs.idx++
+	}
+	log.Printf("# %v task critical path(s) have been traced into %v",
+		len(paths),
+		dbs.targetName,
+	)
+}
+
+func (dbs *DbSession) DumpUtilization(
+	coords rtdata.Coords,
+	report rtinfo.UtilizationReport,
+	tm *rtinfo.TimelineManager,
+) {
+	nodeID, deviceID := coords.NodeID, coords.DeviceID
+
+	euS := NewEngineUtilSession(dbs.dbObject)
+	for _, e := range report.Engines {
+		euS.AddEngineUtil(dbs.idx, nodeID, deviceID,
+			e.EngineType, e.ClusterID, e.EngineIndex, e.VcId,
+			e.PgIdx, e.ActCount, e.BusyCycles, e.SpanCycles,
+			e.Utilization(),
+		)
+		dbs.itemStat.engUtilCount++
+		dbs.idx++
+	}
+	euS.Close()
+
+	puS := NewPgUtilSession(dbs.dbObject)
+	defer puS.Close()
+	for _, vec := range [][]rtinfo.PgUtilization{report.Pgs, report.Tasks} {
+		for _, p := range vec {
+			// Keep the row even if out of the timeline, cycles still count
+			startHostTime, _ := tm.MapToHosttime(p.StartCycle)
+			endHostTime, _ := tm.MapToHosttime(p.EndCycle)
+			puS.AddPgUtil(dbs.idx, nodeID, deviceID,
+				p.PgIdx, p.TaskID,
+				startHostTime, endHostTime,
+				p.StartCycle, p.EndCycle,
+				p.SipBusyCycles, p.DmaBusyCycles, p.CqmBusyCycles,
+				p.IdleCycles, p.IdleGapCount,
+				p.IdleByCause[rtinfo.IdleCause_Sleep],
+				p.IdleByCause[rtinfo.IdleCause_WaitDma],
+				p.IdleByCause[rtinfo.IdleCause_WaitLaunch],
+				p.IdleByCause[rtinfo.IdleCause_Cqm],
+				p.Utilization(),
+			)
+			dbs.itemStat.pgUtilCount++
+			dbs.idx++
+		}
+	}
+}
+
+// DumpKernelAsserts marks each assert in dtu_op on its own track,
+// and keeps the details in kernel_assert
+func (dbs *DbSession) DumpKernelAsserts(
+	coords rtdata.Coords,
+	report rtinfo.KernelAssertReport,
+	tm *rtinfo.TimelineManager,
+) {
+	if len(report.Asserts) == 0 {
+		return
+	}
+	nodeID, deviceID := coords.NodeID, coords.DeviceID
+	const contextID = -1
+
+	dos := NewDtuOpSession(dbs.dbObject, dbs.vpIds)
+	for _, a := range report.Asserts {
+		hostTime, ok := tm.MapToHosttime(a.Event.Cycle)
+		if !ok {
+			continue
+		}
+		dos.AddDtuOpOfTask(dbs.idx, nodeID, deviceID,
+			a.Event.ClusterID, contextID,
+			"ASSERT "+a.Location(),
+			hostTime, hostTime, 0,
+			a.Event.Cycle, a.Event.Cycle, 0,
+			a.OpId, a.OpName,
+			KernelAssertRowName,
+			a.TaskId, a.ExecUuid,
+		)
+		dbs.itemStat.assertMarks++
+		dbs.idx++
+	}
+	dos.Close()
+
+	kaS := NewKernelAssertSession(dbs.dbObject)
+	defer kaS.Close()
+	for _, a := range report.Asserts {
+		// Keep the row even if out of the timeline
+		hostTime, _ := tm.MapToHosttime(a.Event.Cycle)
+		var info metadata.KernelAssertInfo
+		if a.Resolved() {
+			info = a.Infos[0]
+		}
+		kaS.AddKernelAssert(dbs.idx, nodeID, deviceID,
+			a.Event.ClusterID, a.Event.EngineIndex,
+			hostTime, a.Event.Cycle,
+			a.TaskId, fmt.Sprintf("0x%016x", a.ExecUuid),
+			a.OpId, a.OpName, a.SubOpName,
+			a.CauseId, info.SrcFile, info.LineNo, info.UserMsg,
+			a.Resolved(),
+		)
+		dbs.itemStat.assertCount++
+		dbs.idx++
+	}
+	log.Printf("# %v kernel assert(s) have been marked into %v",
+		len(report.Asserts),
+		dbs.targetName,
+	)
+}
@@ -32,6 +32,15 @@ const (
 	TableCategory_CommandInfo       = "CommandInfo"
 	TableCategory_VersionInfo       = "SotwareVersionInfo"
 	TableCategroy_Platform          = "PlatformInfo"
+	TableCategory_OpCoverage        = "DTUOpCoverage"
+	TableCategory_CriticalPath      = "DTUCriticalPath"
+	TableCategory_EngineUtil        = "DTUEngineUtilization"
+	TableCategory_PgUtil            = "DTUPgUtilization"
+	TableCategory_KernelAssert      = "DTUKernelAssert"
+	TableCategory_Capture           = "Capture"
+	TableCategory_Provenance        = "Provenance"
+	TableCategory_Flow              = "Flow"
+	TableCategory_Counter           = "Counter"
 )
 
 func getDbInitSchema() string {
@@ -7,7 +7,13 @@ import (
 	"git.enflame.cn/hai.bai/dmaster/assert"
 )
 
+// The bandwidth went to its own table up to schema version 8, it is a
+// counter track now
 const (
+	createDmaBandwidthTable = `
+	CREATE TABLE dma_bandwidth(idx INT,node_id INT,device_id INT,
+		track_name TEXT,engine_type TEXT,cluster_id INT,engine_id INT,
+		direction TEXT,timestamp INT,value REAL);`
 	createMemcpyTable = `
 	CREATE TABLE memcpy(idx INT,name TEXT,node_id INT,description TEXT,context_id INT,
 		start_timestamp INT,end_timestamp INT,duration_timestamp INT,
@@ -16,18 +22,69 @@ const (
 		engine_type TEXT,op_id INT,op_name TEXT,
 		src_addr INT,dst_addr INT,src_size INT,dst_size INT,
 		direction TEXT,tiling_mode TEXT,vc INT,
-		args TEXT,vp_id INT,row_name TEXT,tid TEXT);`
+		args TEXT,vp_id INT,row_name TEXT,tid TEXT,
+		dma_op TEXT,task_id INT,exec_uuid TEXT,match_status TEXT);`
 )
 
 func init() {
 	RegisterTabInitCommand(createMemcpyTable)
+	RegisterSchemaMigration(SchemaMigration{
+		Version:     9,
+		Description: "dma_bandwidth rows go to counter",
+		Up: func(tx *sql.Tx) error {
+			if ok, err := hasTable(tx, "dma_bandwidth"); err != nil || !ok {
+				return err
+			}
+			cols, err := tableColumns(tx, "dma_bandwidth")
+			if err != nil {
+				return err
+			}
+			colList := "idx, node_id, device_id, track_name, unit, timestamp, value"
+			selList := "idx, node_id, device_id, " +
+				"replace(track_name, ' GB/s', ' bandwidth'), 'GB/s', timestamp, value"
+			if cols[captureIdColumn] {
+				if err := addMissingColumns(tx, "counter",
+					captureIdColumn+" INT"); err != nil {
+					return err
+				}
+				colList += ", " + captureIdColumn
+				selList += ", " + captureIdColumn
+			}
+			for _, cmd := range []string{
+				fmt.Sprintf(`insert into counter(%v) select %v from dma_bandwidth`,
+					colList, selList),
+				`drop table dma_bandwidth`,
+				`delete from header where table_name = 'dma_bandwidth'`,
+			} {
+				if _, err := tx.Exec(cmd); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	})
+}
+
+// Columns from the DMA meta, unknown ones are left as NULL
+type DmaMetaCols struct {
+	SrcAddr, DstAddr interface{}
+	SrcSize, DstSize interface{}
+	Direction        interface{}
+	Args             interface{}
+	DmaOp            interface{}
+	TaskId           interface{}
+	ExecUuid         interface{}
+	OpId             interface{}
+	OpName           interface{}
+	MatchStatus      string
 }
 
 type DmaSession struct {
 	TableSession
+	vpIds *VpIdAllocator
 }
 
-func NewDmaSession(db *sql.DB) *DmaSession {
+func NewDmaSession(db *sql.DB, vpIds *VpIdAllocator) *DmaSession {
 	return &DmaSession{
 		TableSession: NewTableSession(db, `insert into memcpy(
 			idx, node_id, device_id, cluster_id, context_id, name,
@@ -38,7 +95,10 @@ func NewDmaSession(db *sql.DB) *DmaSession {
 			tiling_mode,
 			engine_id,
 			vc,
-			tid
+			tid,
+			src_addr, dst_addr, src_size, dst_size,
+			direction, args,
+			dma_op, task_id, exec_uuid, op_id, op_name, match_status
 		) values(?, ?, ?, ?, ?, ?,
 		         ?, ?, ?,
 				 ?, ?, ?,
@@ -47,7 +107,11 @@ func NewDmaSession(db *sql.DB) *DmaSession {
 				 ?,
 				 ?,
 				 ?,
-				 ?)`),
+				 ?,
+				 ?, ?, ?, ?,
+				 ?, ?,
+				 ?, ?, ?, ?, ?, ?)`),
+		vpIds: vpIds,
 	}
 }
 
@@ -58,7 +122,8 @@ func (dmaS *DmaSession) AddDmaTrace(idx, nodeID, devID, clusterID, ctxID int,
 	packetId int, engineType string,
 	tilingMode string,
 	engineID int,
-	vc int) {
+	vc int,
+	metaCols DmaMetaCols) {
 	//0:0:-1:2:ENGINE_TS:0:CQM Executable Launch0
 	// row_name as name
 	rowName := name
@@ -66,12 +131,16 @@ func (dmaS *DmaSession) AddDmaTrace(idx, nodeID, devID, clusterID, ctxID int,
 		startTS, endTS, durTS,
 		startCy, endCy, durCy,
 		packetId, engineType,
-		GetNextVpId(), rowName,
+		dmaS.vpIds.Next(), rowName,
 		tilingMode,
 		engineID,
 		vc,
 		fmt.Sprintf("%v:%v:%v:%v:%v:%v:%v",
 			nodeID, devID, ctxID, clusterID, engineType, engineID, name),
+		metaCols.SrcAddr, metaCols.DstAddr, metaCols.SrcSize, metaCols.DstSize,
+		metaCols.Direction, metaCols.Args,
+		metaCols.DmaOp, metaCols.TaskId, metaCols.ExecUuid,
+		metaCols.OpId, metaCols.OpName, metaCols.MatchStatus,
 	)
 	assert.Assert(err == nil, "Must be nil error: %v", err)
 }
@@ -21,7 +21,8 @@ const (
 		input_shape TEXT,output_shape TEXT,layer_kind TEXT,
 		layer_name TEXT,
 		module_id INT,module_name TEXT,meta TEXT,device_id INT,
-		cluster_id INT,vp_id INT,row_name TEXT,tid TEXT);`
+		cluster_id INT,vp_id INT,row_name TEXT,tid TEXT,
+		task_id INT,exec_uuid TEXT);`
 )
 
 func init() {
@@ -30,9 +31,10 @@ func init() {
 
 type DtuOpSession struct {
 	TableSession
+	vpIds *VpIdAllocator
 }
 
-func NewDtuOpSession(db *sql.DB) *DtuOpSession {
+func NewDtuOpSession(db *sql.DB, vpIds *VpIdAllocator) *DtuOpSession {
 	return &DtuOpSession{
 		TableSession: NewTableSession(db, `insert into dtu_op(
 			idx, node_id, device_id, cluster_id, context_id, name,
@@ -40,13 +42,16 @@ func NewDtuOpSession(db *sql.DB) *DtuOpSession {
 			start_cycle, end_cycle, duration_cycle,
 			op_id, op_name,
 			vp_id, module_id,
-			row_name, tid)
+			row_name, tid,
+			task_id, exec_uuid)
 			values(?, ?, ?, ?, ?, ?,
 				   ?, ?, ?,
 				   ?, ?, ?,
 				   ?, ?,
 				   ?, ?,
+				   ?, ?,
 				   ?, ?)`),
+		vpIds: vpIds,
 	}
 }
 
@@ -55,9 +60,37 @@ func (dos *DtuOpSession) AddDtuOp(
 	startTS, endTS, durTS uint64,
 	startCy, endCy, durCy uint64,
 	opId int, opName string, rowName string) {
+	dos.addDtuOp(idx, nodeID, devID, clusterID, ctxID, name,
+		startTS, endTS, durTS,
+		startCy, endCy, durCy,
+		opId, opName, rowName,
+		nil, nil)
+}
+
+// AddDtuOpOfTask keeps the task and executable the op belongs to,
+// which is the key to match ops across runs.
+func (dos *DtuOpSession) AddDtuOpOfTask(
+	idx, nodeID, devID, clusterID, ctxID int, name string,
+	startTS, endTS, durTS uint64,
+	startCy, endCy, durCy uint64,
+	opId int, opName string, rowName string,
+	taskId int, execUuid uint64) {
+	dos.addDtuOp(idx, nodeID, devID, clusterID, ctxID, name,
+		startTS, endTS, durTS,
+		startCy, endCy, durCy,
+		opId, opName, rowName,
+		taskId, fmt.Sprintf("0x%016x", execUuid))
+}
+
+func (dos *DtuOpSession) addDtuOp(
+	idx, nodeID, devID, clusterID, ctxID int, name string,
+	startTS, endTS, durTS uint64,
+	startCy, endCy, durCy uint64,
+	opId int, opName string, rowName string,
+	taskId, execUuid interface{}) {
 
 	moduleID := 1
-	vpId := GetNextVpId()
+	vpId := dos.vpIds.Next()
 
 	_, err := dos.stmt.Exec(
 		idx, nodeID, devID, clusterID, ctxID, name,
@@ -68,6 +101,7 @@ func (dos *DtuOpSession) AddDtuOp(
 		vpId, moduleID,
 		rowName, fmt.Sprintf("%v:%v:%v:%v:%v",
 			nodeID, devID, ctxID, clusterID, rowName,
-		))
+		),
+		taskId, execUuid)
 	assert.Assert(err == nil, "Must be nil to carry on:%v", err)
 }
@@ -0,0 +1,168 @@
+package dbexport
+
+import (
+	"database/sql"
+	"log"
+
+	"git.enflame.cn/hai.bai/dmaster/assert"
+	"git.enflame.cn/hai.bai/dmaster/rtinfo"
+	"git.enflame.cn/hai.bai/dmaster/rtinfo/rtdata"
+)
+
+// Links from a launch down to the engine work it triggered, one row per
+// link of the rows at both ends: TS launch -> CQM executable -> DTU ops
+// of the task -> DMAs and sub ops of the op. Idx is unique over the
+// tables, the table names are there to save guessing.
+const (
+	createFlowTable = `
+	CREATE TABLE flow(node_id INT,device_id INT,
+		kind TEXT,task_id INT,
+		src_table TEXT,src_idx INT,dst_table TEXT,dst_idx INT);`
+)
+
+func init() {
+	RegisterTabInitCommand(createFlowTable)
+	RegisterSchemaMigration(SchemaMigration{
+		Version:     7,
+		Description: "flow table",
+		Up: func(tx *sql.Tx) error {
+			if err := createTablesIfMissing(tx, createFlowTable); err != nil {
+				return err
+			}
+			return createIndexesAndViews(tx)
+		},
+	})
+}
+
+type FlowSession struct {
+	TableSession
+}
+
+func NewFlowSession(db *sql.DB) *FlowSession {
+	return &FlowSession{
+		TableSession: NewTableSession(db, `insert into flow(
+			node_id, device_id,
+			kind, task_id,
+			src_table, src_idx, dst_table, dst_idx
+		) values(?, ?,
+				 ?, ?,
+				 ?, ?, ?, ?)`),
+	}
+}
+
+func (flowS *FlowSession) AddFlow(nodeID, devID int,
+	kind string, taskID int,
+	srcTable string, srcIdx int, dstTable string, dstIdx int) {
+	_, err := flowS.stmt.Exec(nodeID, devID,
+		kind, taskID,
+		srcTable, srcIdx, dstTable, dstIdx,
+	)
+	assert.Assert(err == nil, "Must be nil error: %v", err)
+}
+
+// Table the rows of the node kind go into
+func flowNodeTable(kind rtinfo.FlowNodeKind) string {
+	switch kind {
+	case rtinfo.FlowNode_Launch, rtinfo.FlowNode_Exec:
+		return "fw"
+	case rtinfo.FlowNode_Op:
+		return "dtu_op"
+	case rtinfo.FlowNode_Dma:
+		return "memcpy"
+	case rtinfo.FlowNode_Kernel:
+		return "kernel"
+	}
+	return ""
+}
+
+// flowEnds resolves the links of one device onto what an output makes
+// of their endpoints, a row idx or a slice. The first one made of a node
+// is kept: the sub ops may be dumped again onto the SIP BUSY rows.
+type flowEnds struct {
+	coords rtdata.Coords
+	links  []rtinfo.FlowLink
+	byNode map[rtinfo.FlowNode][]int // endpoint to its links
+	src    []int                     // -1 until made
+	dst    []int
+}
+
+func newFlowEnds(coords rtdata.Coords, links []rtinfo.FlowLink) *flowEnds {
+	fe := &flowEnds{
+		coords: coords,
+		links:  links,
+		byNode: make(map[rtinfo.FlowNode][]int),
+		src:    make([]int, len(links)),
+		dst:    make([]int, len(links)),
+	}
+	for i, link := range links {
+		fe.byNode[link.Src] = append(fe.byNode[link.Src], i)
+		fe.byNode[link.Dst] = append(fe.byNode[link.Dst], i)
+		fe.src[i], fe.dst[i] = -1, -1
+	}
+	return fe
+}
+
+// claim gives the node to the handle, returns the links it becomes an
+// end of
+func (fe *flowEnds) claim(node rtinfo.FlowNode, handle int) []int {
+	var claimed []int
+	for _, i := range fe.byNode[node] {
+		switch {
+		case fe.links[i].Src == node && fe.src[i] < 0:
+			fe.src[i] = handle
+		case fe.links[i].Dst == node && fe.dst[i] < 0:
+			fe.dst[i] = handle
+		default:
+			continue
+		}
+		claimed = append(claimed, i)
+	}
+	return claimed
+}
+
+// resolved visits the links with both ends made, in link order
+func (fe *flowEnds) resolved(visit func(link rtinfo.FlowLink, src, dst int)) {
+	for i, link := range fe.links {
+		if fe.src[i] >= 0 && fe.dst[i] >= 0 {
+			visit(link, fe.src[i], fe.dst[i])
+		}
+	}
+}
+
+// DumpFlows comes before the activities of the device, the links are
+// written once their rows are, by the next DumpFlows or Close
+func (dbs *DbSession) DumpFlows(
+	coords rtdata.Coords,
+	links []rtinfo.FlowLink,
+) {
+	dbs.flushFlows()
+	dbs.flows = newFlowEnds(coords, links)
+}
+
+func (dbs *DbSession) markFlow(kind rtinfo.FlowNodeKind, act rtdata.DpfAct) {
+	if dbs.flows != nil {
+		dbs.flows.claim(rtinfo.NewFlowNode(kind, act), dbs.idx)
+	}
+}
+
+func (dbs *DbSession) flushFlows() {
+	if dbs.flows == nil {
+		return
+	}
+	flowS := NewFlowSession(dbs.dbObject)
+	defer flowS.Close()
+	coords, flowCount := dbs.flows.coords, 0
+	dbs.flows.resolved(func(link rtinfo.FlowLink, src, dst int) {
+		flowS.AddFlow(coords.NodeID, coords.DeviceID,
+			string(link.Kind), link.TaskId,
+			flowNodeTable(link.Src.Kind), src,
+			flowNodeTable(link.Dst.Kind), dst)
+		flowCount++
+	})
+	dbs.itemStat.flowCount += flowCount
+	log.Printf("# %v of %v flow(s) have been traced into %v",
+		flowCount, len(dbs.flows.links),
+		dbs.targetName,
+	)
+	dbs.flows = nil
+}
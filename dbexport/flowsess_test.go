@@ -0,0 +1,95 @@
+package dbexport
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"git.enflame.cn/hai.bai/dmaster/codec"
+	"git.enflame.cn/hai.bai/dmaster/rtinfo"
+	"git.enflame.cn/hai.bai/dmaster/rtinfo/rtdata"
+)
+
+func TestDumpFlows(t *testing.T) {
+	act := func(startCy uint64) rtdata.DpfAct {
+		return rtdata.DpfAct{
+			Start: codec.DpfEvent{Cycle: startCy},
+			End:   codec.DpfEvent{Cycle: startCy + 10},
+		}
+	}
+	op := rtinfo.NewFlowNode(rtinfo.FlowNode_Op, act(100))
+	link := func(kind rtinfo.FlowKind, dst rtinfo.FlowNode) rtinfo.FlowLink {
+		return rtinfo.FlowLink{Kind: kind, TaskId: 3, Src: op, Dst: dst}
+	}
+	links := []rtinfo.FlowLink{
+		link(rtinfo.FlowKind_Kernel, rtinfo.NewFlowNode(rtinfo.FlowNode_Kernel, act(105))),
+		link(rtinfo.FlowKind_Dma, rtinfo.NewFlowNode(rtinfo.FlowNode_Dma, act(102))),
+		link(rtinfo.FlowKind_Dma, rtinfo.NewFlowNode(rtinfo.FlowNode_Dma, act(300))),
+	}
+
+	target := filepath.Join(t.TempDir(), "foo.vpd")
+	dbs, err := NewDbSession(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dbs.DumpFlows(rtdata.Coords{DeviceID: 2}, links)
+	// Rows as dumped: op, kernel, DMA, then the kernel again as SIP BUSY,
+	// the DMA at 300 is never dumped
+	for _, end := range []struct {
+		kind rtinfo.FlowNodeKind
+		act  rtdata.DpfAct
+	}{
+		{rtinfo.FlowNode_Op, act(100)},
+		{rtinfo.FlowNode_Kernel, act(105)},
+		{rtinfo.FlowNode_Dma, act(102)},
+		{rtinfo.FlowNode_Kernel, act(105)},
+	} {
+		dbs.markFlow(end.kind, end.act)
+		dbs.idx++
+	}
+	dbs.Close()
+
+	db, err := sql.Open("sqlite3", target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	rows, err := db.Query(`select device_id, kind, task_id,
+		src_table, src_idx, dst_table, dst_idx from flow order by rowid`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	type flowRow struct {
+		devID, taskID    int
+		kind             string
+		srcTable, dstTbl string
+		srcIdx, dstIdx   int
+	}
+	var got []flowRow
+	for rows.Next() {
+		var r flowRow
+		if err := rows.Scan(&r.devID, &r.kind, &r.taskID,
+			&r.srcTable, &r.srcIdx, &r.dstTbl, &r.dstIdx); err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, r)
+	}
+	expected := []flowRow{
+		{2, 3, "kernel", "dtu_op", "kernel", 0, 1},
+		{2, 3, "dma", "dtu_op", "memcpy", 0, 2},
+	}
+	if len(got) != len(expected) {
+		t.Fatalf("expecting %v flows, got %v", expected, got)
+	}
+	for i := range expected {
+		if got[i] != expected[i] {
+			t.Errorf("flow %v: expecting %v, got %v", i, expected[i], got[i])
+		}
+	}
+	var count int
+	db.QueryRow(`select count from header where table_name = 'flow'`).Scan(&count)
+	if count != 2 {
+		t.Errorf("expecting 2 flows in header, got %v", count)
+	}
+}
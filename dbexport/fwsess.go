@@ -22,9 +22,10 @@ func init() {
 
 type FwSession struct {
 	TableSession
+	vpIds *VpIdAllocator
 }
 
-func NewFwSession(db *sql.DB) *FwSession {
+func NewFwSession(db *sql.DB, vpIds *VpIdAllocator) *FwSession {
 	return &FwSession{
 		TableSession: NewTableSession(db, `insert into fw(
 			idx, node_id, device_id, cluster_id, context_id, name,
@@ -41,6 +42,7 @@ func NewFwSession(db *sql.DB) *FwSession {
 				 ?, ?,
 				 ?,
 				 ?)`),
+		vpIds: vpIds,
 	}
 }
 
@@ -56,7 +58,7 @@ func (fw *FwSession) AddFwTrace(idx, nodeID, devID, clusterID, ctxID int, name s
 		startTS, endTS, durTS,
 		startCy, endCy, durCy,
 		packetId, engineType,
-		GetNextVpId(), rowName,
+		fw.vpIds.Next(), rowName,
 		engineID,
 		fmt.Sprintf("%v:%v:%v:%v:%v:%v:%v",
 			nodeID, devID, ctxID, clusterID, engineType, engineID, rowName),
@@ -3,6 +3,9 @@ package dbexport
 import (
 	"database/sql"
 	"fmt"
+	"log"
+
+	"git.enflame.cn/hai.bai/dmaster/assert"
 )
 
 const (
@@ -32,3 +35,25 @@ func (hs *HeaderSession) AddHeader(tableName string, version string, category st
 		version, category, fmt.Sprintf("%v", count),
 		timeUnit)
 }
+
+// AccumulateHeader adds the count onto the header already there,
+// which is the case of appending to a vpd. The version already there
+// is kept, as the rows of the captures before are still of it.
+func (hs *HeaderSession) AccumulateHeader(tableName string, version string,
+	category string, count int, timeUnit string) {
+	var stored string
+	err := hs.tx.QueryRow(`select IFNULL(version, '') from header
+		where table_name = ?`, tableName).Scan(&stored)
+	if err == sql.ErrNoRows {
+		hs.AddHeader(tableName, version, category, count, timeUnit)
+		return
+	}
+	assert.Assert(err == nil, "Must be nil error: %v", err)
+	if stored != version {
+		log.Printf("warning: %v of version %v appended to the rows of version %v",
+			tableName, version, stored)
+	}
+	_, err = hs.tx.Exec(`update header set count = count + ?
+		where table_name = ?`, count, tableName)
+	assert.Assert(err == nil, "Must be nil error: %v", err)
+}
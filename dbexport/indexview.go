@@ -0,0 +1,130 @@
+package dbexport
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+)
+
+// Indexes are created once the rows are in, inserting into indexed
+// tables is much slower. They are named idx_<table>_<columns>.
+var vpdIndexes = []struct {
+	table   string
+	columns []string
+}{
+	{"dtu_op", []string{"device_id", "task_id", "op_id"}},
+	{"dtu_op", []string{"exec_uuid", "op_id"}},
+	{"dtu_op", []string{"row_name"}},
+	{"dtu_op", []string{"start_timestamp"}},
+	{"fw", []string{"device_id", "packet_id"}},
+	{"fw", []string{"start_timestamp"}},
+	{"memcpy", []string{"engine_type", "tiling_mode"}},
+	{"memcpy", []string{"engine_type", "packet_id"}},
+	{"memcpy", []string{"device_id", "task_id", "op_id"}},
+	{"memcpy", []string{"start_timestamp"}},
+	{"kernel", []string{"device_id", "op_id"}},
+	{"kernel", []string{"packet_id"}},
+	{"kernel", []string{"start_timestamp"}},
+	{"flow", []string{"src_table", "src_idx"}},
+	{"flow", []string{"dst_table", "dst_idx"}},
+	{"counter", []string{"device_id", "track_name", "timestamp"}},
+}
+
+// Tables added by later migrations are not there yet when migrating
+// through the versions before
+func getIndexCmds(db dbQueryer) ([]string, error) {
+	var cmds []string
+	for _, index := range vpdIndexes {
+		if ok, err := hasTable(db, index.table); err != nil {
+			return nil, err
+		} else if !ok {
+			continue
+		}
+		cmds = append(cmds, fmt.Sprintf(
+			"CREATE INDEX IF NOT EXISTS idx_%v_%v ON %v(%v);",
+			index.table, strings.Join(index.columns, "_"),
+			index.table, strings.Join(index.columns, ",")))
+	}
+	return cmds, nil
+}
+
+// Views for the analysis, joining the DTU ops with the DMAs and kernels
+// they own and summarizing them per op of an executable
+var vpdViews = []string{
+	// DMAs owned by the op, by the task and op id from the DMA meta
+	`CREATE VIEW IF NOT EXISTS op_dma AS
+	SELECT o.idx AS op_idx, o.capture_id, o.node_id, o.device_id,
+		o.task_id, o.exec_uuid, o.op_id, o.op_name,
+		m.idx AS dma_idx, m.name AS dma_name, m.engine_type, m.engine_id,
+		m.dma_op, m.direction, m.src_size, m.dst_size,
+		m.start_timestamp, m.end_timestamp, m.duration_timestamp
+	FROM dtu_op o JOIN memcpy m
+		ON m.node_id = o.node_id AND m.device_id = o.device_id
+		AND m.task_id = o.task_id AND m.op_id = o.op_id
+		AND m.capture_id IS o.capture_id
+	WHERE o.row_name = '` + DtuOpRowName + `';`,
+
+	// Kernels attributed to the op, within the time of the op
+	`CREATE VIEW IF NOT EXISTS op_kernel AS
+	SELECT o.idx AS op_idx, o.capture_id, o.node_id, o.device_id,
+		o.task_id, o.exec_uuid, o.op_id, o.op_name,
+		k.idx AS kernel_idx, k.name AS kernel_name, k.cluster_id, k.engine_id,
+		k.confidence, k.attrib_reason,
+		k.start_timestamp, k.end_timestamp, k.duration_timestamp
+	FROM dtu_op o JOIN kernel k
+		ON k.node_id = o.node_id AND k.device_id = o.device_id
+		AND k.op_id = o.op_id AND k.capture_id IS o.capture_id
+		AND k.start_timestamp < o.end_timestamp
+		AND k.end_timestamp > o.start_timestamp
+	WHERE o.row_name = '` + DtuOpRowName + `';`,
+
+	// Per op of an executable over all the tasks running it
+	`CREATE VIEW IF NOT EXISTS op_stats AS
+	SELECT o.exec_uuid, o.op_id, o.op_name,
+		COUNT(*) AS op_count,
+		SUM(o.duration_timestamp) AS total_ns,
+		AVG(o.duration_timestamp) AS mean_ns,
+		MIN(o.duration_timestamp) AS min_ns,
+		MAX(o.duration_timestamp) AS max_ns,
+		SUM(o.duration_cycle) AS total_cycles,
+		IFNULL(MAX(d.dma_count), 0) AS dma_count,
+		IFNULL(MAX(d.dma_ns), 0) AS dma_ns,
+		IFNULL(MAX(k.kernel_count), 0) AS kernel_count,
+		IFNULL(MAX(k.kernel_ns), 0) AS kernel_ns
+	FROM dtu_op o
+	LEFT JOIN (SELECT exec_uuid, op_id,
+			COUNT(*) AS dma_count, SUM(duration_timestamp) AS dma_ns
+		FROM op_dma GROUP BY exec_uuid, op_id) d
+		ON d.exec_uuid = o.exec_uuid AND d.op_id = o.op_id
+	LEFT JOIN (SELECT exec_uuid, op_id,
+			COUNT(*) AS kernel_count, SUM(duration_timestamp) AS kernel_ns
+		FROM op_kernel GROUP BY exec_uuid, op_id) k
+		ON k.exec_uuid = o.exec_uuid AND k.op_id = o.op_id
+	WHERE o.row_name = '` + DtuOpRowName + `'
+	GROUP BY o.exec_uuid, o.op_id, o.op_name;`,
+}
+
+func createIndexesAndViews(db dbQueryer) error {
+	cmds, err := getIndexCmds(db)
+	if err != nil {
+		return err
+	}
+	for _, cmd := range append(cmds, vpdViews...) {
+		if _, err := db.Exec(cmd); err != nil {
+			log.Printf("%q: %s\n", err, cmd)
+			return err
+		}
+	}
+	return nil
+}
+
+func init() {
+	RegisterSchemaMigration(SchemaMigration{
+		Version:     5,
+		Description: "indexes and analysis views",
+		Up: func(tx *sql.Tx) error {
+			return createIndexesAndViews(tx)
+		},
+	})
+}
@@ -0,0 +1,63 @@
+package dbexport
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+)
+
+func TestOpStatsView(t *testing.T) {
+	target := filepath.Join(t.TempDir(), "foo.vpd")
+	dbs, err := NewDbSession(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dbs.Close()
+
+	db, err := sql.Open("sqlite3", target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var indexes int
+	db.QueryRow(`select count(*) from sqlite_master where type = 'index'
+		and name like 'idx_%'`).Scan(&indexes)
+	if indexes != len(vpdIndexes) {
+		t.Errorf("expecting %v indexes, got %v", len(vpdIndexes), indexes)
+	}
+
+	// One op run twice by two tasks, each with a DMA, the kernel in the first only
+	if _, err := db.Exec(`
+		insert into dtu_op(idx, node_id, device_id, task_id, exec_uuid, op_id, op_name,
+			row_name, start_timestamp, end_timestamp, duration_timestamp, duration_cycle,
+			capture_id)
+		values(0, 0, 0, 1, '0xab', 3, 'conv', ?, 100, 200, 100, 1000, 0),
+			(1, 0, 0, 2, '0xab', 3, 'conv', ?, 300, 600, 300, 3000, 0);
+		insert into memcpy(idx, node_id, device_id, task_id, op_id,
+			start_timestamp, end_timestamp, duration_timestamp, capture_id)
+		values(2, 0, 0, 1, 3, 110, 130, 20, 0),
+			(3, 0, 0, 2, 3, 310, 350, 40, 0);
+		insert into kernel(idx, node_id, device_id, op_id,
+			start_timestamp, end_timestamp, duration_timestamp, capture_id)
+		values(4, 0, 0, 3, 120, 180, 60, 0);`,
+		DtuOpRowName, DtuOpRowName); err != nil {
+		t.Fatal(err)
+	}
+
+	var opCount, totalNs, dmaCount, dmaNs, kernelCount, kernelNs int
+	if err := db.QueryRow(`select op_count, total_ns, dma_count, dma_ns,
+		kernel_count, kernel_ns from op_stats
+		where exec_uuid = '0xab' and op_id = 3`).Scan(
+		&opCount, &totalNs, &dmaCount, &dmaNs, &kernelCount, &kernelNs); err != nil {
+		t.Fatal(err)
+	}
+	got := []int{opCount, totalNs, dmaCount, dmaNs, kernelCount, kernelNs}
+	expected := []int{2, 400, 2, 60, 1, 60}
+	for i := range expected {
+		if got[i] != expected[i] {
+			t.Errorf("expecting %v, got %v", expected, got)
+			break
+		}
+	}
+}
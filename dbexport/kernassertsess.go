@@ -0,0 +1,63 @@
+package dbexport
+
+import (
+	"database/sql"
+
+	"git.enflame.cn/hai.bai/dmaster/assert"
+)
+
+const (
+	KernelAssertRowName = "Kernel Assert"
+)
+
+const (
+	createKernelAssertTable = `
+	CREATE TABLE kernel_assert(idx INT,node_id INT,device_id INT,
+		cluster_id INT,engine_index INT,
+		timestamp INT,cycle INT,
+		task_id INT,exec_uuid TEXT,op_id INT,op_name TEXT,sub_op_name TEXT,
+		cause_id INT,src_file TEXT,line_no INT,message TEXT,
+		resolved INT);`
+)
+
+func init() {
+	RegisterTabInitCommand(createKernelAssertTable)
+}
+
+type KernelAssertSession struct {
+	TableSession
+}
+
+func NewKernelAssertSession(db *sql.DB) *KernelAssertSession {
+	return &KernelAssertSession{
+		TableSession: NewTableSession(db, `insert into kernel_assert(
+			idx, node_id, device_id,
+			cluster_id, engine_index,
+			timestamp, cycle,
+			task_id, exec_uuid, op_id, op_name, sub_op_name,
+			cause_id, src_file, line_no, message,
+			resolved
+		) values(?, ?, ?,
+				 ?, ?,
+				 ?, ?,
+				 ?, ?, ?, ?, ?,
+				 ?, ?, ?, ?,
+				 ?)`),
+	}
+}
+
+func (kaS *KernelAssertSession) AddKernelAssert(idx, nodeID, devID int,
+	clusterID, engineIndex int,
+	timestamp, cycle uint64,
+	taskId int, execUuid string, opId int, opName, subOpName string,
+	causeId int, srcFile string, lineNo int, message string,
+	resolved bool) {
+	_, err := kaS.stmt.Exec(idx, nodeID, devID,
+		clusterID, engineIndex,
+		timestamp, cycle,
+		taskId, execUuid, opId, opName, subOpName,
+		causeId, srcFile, lineNo, message,
+		resolved,
+	)
+	assert.Assert(err == nil, "Must be nil error: %v", err)
+}
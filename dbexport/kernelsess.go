@@ -13,18 +13,28 @@ const (
 		start_timestamp INT,end_timestamp INT,duration_timestamp INT,
 		start_cycle INT,end_cycle INT,duration_cycle INT,packet_id INT,
 		device_id INT,cluster_id INT,engine_id INT,engine_type TEXT,
-		op_id INT,op_name TEXT,vp_id INT,row_name TEXT,tid TEXT);`
+		op_id INT,op_name TEXT,vp_id INT,row_name TEXT,tid TEXT,
+		confidence REAL,attrib_reason TEXT);`
 )
 
 func init() {
 	RegisterTabInitCommand(createKernelTable)
 }
 
+// Sub op attribution, NULL if not attributed
+type KernelAttribCols struct {
+	Description interface{}
+	OpId        interface{}
+	Confidence  interface{}
+	Reason      interface{}
+}
+
 type KernelSession struct {
 	TableSession
+	vpIds *VpIdAllocator
 }
 
-func NewKernelSession(db *sql.DB) *KernelSession {
+func NewKernelSession(db *sql.DB, vpIds *VpIdAllocator) *KernelSession {
 	return &KernelSession{
 		TableSession: NewTableSession(db,
 			`insert into kernel(
@@ -34,14 +44,19 @@ func NewKernelSession(db *sql.DB) *KernelSession {
 				packet_id, engine_type,
 				vp_id, row_name,
 				engine_id,
-				tid
+				tid,
+				description,
+				op_id, confidence, attrib_reason
 			) values(?, ?, ?, ?, ?, ?,
 					 ?, ?, ?,
 					 ?, ?, ?,
 					 ?, ?,
 					 ?, ?,
 					 ?,
-					 ?)`),
+					 ?,
+					 ?,
+					 ?, ?, ?)`),
+		vpIds: vpIds,
 	}
 }
 
@@ -51,7 +66,8 @@ func (kernS *KernelSession) AddKernelTrace(idx, nodeID, devID, clusterID, ctxID
 	startCy, endCy, durCy uint64,
 	packetId int, engineType string,
 	engineID int,
-	rowName string) {
+	rowName string,
+	attrib KernelAttribCols) {
 	//0:0:-1:2:ENGINE_SIP:0:SIP BUSY
 	// And SIP BUSY only so far.
 	// row_name as name
@@ -59,10 +75,12 @@ func (kernS *KernelSession) AddKernelTrace(idx, nodeID, devID, clusterID, ctxID
 		startTS, endTS, durTS,
 		startCy, endCy, durCy,
 		packetId, engineType,
-		GetNextVpId(), rowName,
+		kernS.vpIds.Next(), rowName,
 		engineID,
 		fmt.Sprintf("%v:%v:%v:%v:%v:%v:%v",
 			nodeID, devID, ctxID, clusterID, engineType, engineID, rowName),
+		attrib.Description,
+		attrib.OpId, attrib.Confidence, attrib.Reason,
 	)
 	assert.Assert(err == nil, "Must be nil error: %v", err)
 }
@@ -0,0 +1,60 @@
+package dbexport
+
+import (
+	"database/sql"
+
+	"git.enflame.cn/hai.bai/dmaster/assert"
+)
+
+const (
+	OpCoverageScope_Task = "task"
+	OpCoverageScope_Exec = "exec"
+)
+
+const (
+	createOpCoverageTable = `
+	CREATE TABLE op_coverage(idx INT,node_id INT,device_id INT,scope TEXT,
+		task_id INT,exec_uuid TEXT,pg_mask INT,task_count INT,
+		expected_ops INT,observed_ops INT,coverage REAL,missing_op_ids TEXT,
+		total_cycles INT,mean_cycles REAL,min_cycles INT,max_cycles INT,
+		gap_cycles INT,launch_gap_cycles REAL);`
+)
+
+func init() {
+	RegisterTabInitCommand(createOpCoverageTable)
+}
+
+type OpCoverageSession struct {
+	TableSession
+}
+
+func NewOpCoverageSession(db *sql.DB) *OpCoverageSession {
+	return &OpCoverageSession{
+		TableSession: NewTableSession(db, `insert into op_coverage(
+			idx, node_id, device_id, scope,
+			task_id, exec_uuid, pg_mask, task_count,
+			expected_ops, observed_ops, coverage, missing_op_ids,
+			total_cycles, mean_cycles, min_cycles, max_cycles,
+			gap_cycles, launch_gap_cycles
+		) values(?, ?, ?, ?,
+				 ?, ?, ?, ?,
+				 ?, ?, ?, ?,
+				 ?, ?, ?, ?,
+				 ?, ?)`),
+	}
+}
+
+func (covS *OpCoverageSession) AddOpCoverage(idx, nodeID, devID int,
+	scope string,
+	taskId int, execUuid string, pgMask int, taskCount int,
+	expectedOps, observedOps int, coverage float64, missingOpIds string,
+	totalCy uint64, meanCy float64, minCy, maxCy uint64,
+	gapCy uint64, launchGapCy float64) {
+	_, err := covS.stmt.Exec(idx, nodeID, devID, scope,
+		taskId, execUuid, pgMask, taskCount,
+		expectedOps, observedOps, coverage, missingOpIds,
+		totalCy, meanCy, minCy, maxCy,
+		gapCy, launchGapCy,
+	)
+	assert.Assert(err == nil, "Must be nil error: %v", err)
+}
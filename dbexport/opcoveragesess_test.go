@@ -0,0 +1,62 @@
+package dbexport
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"git.enflame.cn/hai.bai/dmaster/rtinfo"
+	"git.enflame.cn/hai.bai/dmaster/rtinfo/rtdata"
+)
+
+func TestDumpOpCoverage(t *testing.T) {
+	target := filepath.Join(t.TempDir(), "foo.vpd")
+	dbs, err := NewDbSession(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dbs.DumpOpCoverage(rtdata.Coords{DeviceID: 1}, rtinfo.OpCoverageReport{
+		Tasks: []rtinfo.TaskOpCoverage{
+			{TaskID: 5, ExecUuid: 0xa, ExpectedOps: 3, ObservedOps: 1,
+				MissingOpIds: []int{2, 3}, TotalCycles: 100, GapCycles: 20},
+		},
+		Execs: []rtinfo.ExecOpCoverage{
+			{ExecUuid: 0xa, TaskCount: 1, ExpectedOps: 3, ObservedOps: 1,
+				MissingOpIds: []int{2, 3}, TotalCycles: 100, MeanCycles: 100,
+				MinCycles: 100, MaxCycles: 100},
+		},
+	})
+	dbs.Close()
+
+	db, err := sql.Open("sqlite3", target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	var taskId, devId int
+	var execUuid, missing string
+	if err := db.QueryRow(`select task_id, device_id, exec_uuid, missing_op_ids
+		from op_coverage where scope = ?`, OpCoverageScope_Task).Scan(
+		&taskId, &devId, &execUuid, &missing); err != nil {
+		t.Fatal(err)
+	}
+	if taskId != 5 || devId != 1 || execUuid != "0x000000000000000a" || missing != "2 3" {
+		t.Errorf("unexpected task coverage: %v %v %v %q",
+			taskId, devId, execUuid, missing)
+	}
+	var taskCount int
+	var coverage float64
+	if err := db.QueryRow(`select task_count, coverage from op_coverage
+		where scope = ? and task_id = -1`, OpCoverageScope_Exec).Scan(
+		&taskCount, &coverage); err != nil {
+		t.Fatal(err)
+	}
+	if taskCount != 1 || coverage < 0.333 || coverage > 0.334 {
+		t.Errorf("unexpected exec coverage: %v %v", taskCount, coverage)
+	}
+	var count int
+	db.QueryRow(`select count from header where table_name = 'op_coverage'`).Scan(&count)
+	if count != 2 {
+		t.Errorf("expecting 2 coverage rows in header, got %v", count)
+	}
+}
@@ -0,0 +1,119 @@
+package dbexport
+
+import (
+	"hash/fnv"
+	"math"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Field numbers of perfetto/protos/perfetto/trace, only the few in use.
+// There is no generated code for them, messages are encoded by hand.
+const (
+	pfTrace_Packet = 1
+
+	pfPacket_Timestamp       = 8
+	pfPacket_SequenceId      = 10 // trusted_packet_sequence_id
+	pfPacket_TrackEvent      = 11
+	pfPacket_SequenceFlags   = 13
+	pfPacket_TrackDescriptor = 60
+
+	pfTrack_Uuid       = 1
+	pfTrack_Name       = 2
+	pfTrack_Process    = 3
+	pfTrack_ParentUuid = 5
+	pfTrack_Counter    = 8
+
+	pfProcess_Pid  = 1
+	pfProcess_Name = 6
+
+	pfCounter_UnitName = 6
+
+	pfEvent_DebugAnnotations = 4
+	pfEvent_Type             = 9
+	pfEvent_TrackUuid        = 11
+	pfEvent_Categories       = 22
+	pfEvent_Name             = 23
+	pfEvent_DoubleCounter    = 44
+	pfEvent_FlowIds          = 47
+
+	pfAnnotation_BoolValue   = 2
+	pfAnnotation_UintValue   = 3
+	pfAnnotation_IntValue    = 4
+	pfAnnotation_DoubleValue = 5
+	pfAnnotation_StringValue = 6
+	pfAnnotation_Name        = 10
+)
+
+const (
+	pfEventType_SliceBegin = 1
+	pfEventType_SliceEnd   = 2
+	pfEventType_Instant    = 3
+	pfEventType_Counter    = 4
+)
+
+const (
+	pfSeqFlag_IncrementalStateCleared = 1
+)
+
+type pbMsg []byte
+
+func (m pbMsg) varint(num protowire.Number, v uint64) pbMsg {
+	m = protowire.AppendTag(m, num, protowire.VarintType)
+	return protowire.AppendVarint(m, v)
+}
+
+func (m pbMsg) fixed64(num protowire.Number, v uint64) pbMsg {
+	m = protowire.AppendTag(m, num, protowire.Fixed64Type)
+	return protowire.AppendFixed64(m, v)
+}
+
+func (m pbMsg) double(num protowire.Number, v float64) pbMsg {
+	return m.fixed64(num, math.Float64bits(v))
+}
+
+func (m pbMsg) str(num protowire.Number, s string) pbMsg {
+	m = protowire.AppendTag(m, num, protowire.BytesType)
+	return protowire.AppendString(m, s)
+}
+
+func (m pbMsg) msg(num protowire.Number, sub pbMsg) pbMsg {
+	m = protowire.AppendTag(m, num, protowire.BytesType)
+	return protowire.AppendBytes(m, sub)
+}
+
+type PerfettoArg struct {
+	Name  string
+	Value interface{} // string, int, int64, uint64, float64 or bool
+}
+
+func (a PerfettoArg) encode() pbMsg {
+	m := pbMsg{}.str(pfAnnotation_Name, a.Name)
+	switch v := a.Value.(type) {
+	case string:
+		m = m.str(pfAnnotation_StringValue, v)
+	case int:
+		m = m.varint(pfAnnotation_IntValue, uint64(int64(v)))
+	case int64:
+		m = m.varint(pfAnnotation_IntValue, uint64(v))
+	case uint64:
+		m = m.varint(pfAnnotation_UintValue, v)
+	case float64:
+		m = m.double(pfAnnotation_DoubleValue, v)
+	case bool:
+		var b uint64
+		if v {
+			b = 1
+		}
+		m = m.varint(pfAnnotation_BoolValue, b)
+	}
+	return m
+}
+
+// Tracks and flows are identified by the hash of their names,
+// which keeps the output the same from run to run
+func perfettoUuid(key string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	return h.Sum64()
+}
@@ -0,0 +1,525 @@
+package dbexport
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+
+	"git.enflame.cn/hai.bai/dmaster/codec"
+	"git.enflame.cn/hai.bai/dmaster/rtinfo"
+	"git.enflame.cn/hai.bai/dmaster/rtinfo/rtdata"
+	"git.enflame.cn/hai.bai/dmaster/topsdev/mimic/mimicdefs"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// All packets go in one sequence, no interning is used
+const perfettoSequenceId = 1
+
+type perfettoSlice struct {
+	track   string
+	name    string
+	start   uint64 // host ns
+	end     uint64
+	args    []PerfettoArg
+	flowIds []uint64
+}
+
+// PerfettoSession writes the native protobuf trace of Perfetto,
+// each engine gets its own track under the device process.
+// Overlapped slices on one engine are put onto extra lanes,
+// since slices on a track must nest.
+type PerfettoSession struct {
+	targetName string
+	fout       *os.File
+	w          *bufio.Writer
+
+	tracks map[uint64]bool
+	lanes  traceLanes
+	flows  *flowEnds // of the device being dumped
+	// Host cpu ops are the same for all the devices, taken only once
+	cpuOpsDumped bool
+
+	sliceCount   int
+	counterCount int
+}
+
+func NewPerfettoSession(targetName string) (*PerfettoSession, error) {
+	fout, err := os.Create(targetName)
+	if err != nil {
+		return nil, err
+	}
+	ps := &PerfettoSession{
+		targetName: targetName,
+		fout:       fout,
+		w:          bufio.NewWriter(fout),
+		tracks:     make(map[uint64]bool),
+		lanes:      make(traceLanes),
+	}
+	ps.writePacket(pbMsg{}.varint(pfPacket_SequenceFlags,
+		pfSeqFlag_IncrementalStateCleared))
+	return ps, nil
+}
+
+func (ps *PerfettoSession) Close() {
+	if err := ps.w.Flush(); err != nil {
+		log.Printf("error write %v: %v", ps.targetName, err)
+	}
+	ps.fout.Close()
+	log.Printf("# %v slice(s) and %v counter value(s) have been traced into %v",
+		ps.sliceCount, ps.counterCount, ps.targetName)
+}
+
+func (ps *PerfettoSession) writePacket(packet pbMsg) {
+	packet = packet.varint(pfPacket_SequenceId, perfettoSequenceId)
+	buf := protowire.AppendTag(nil, pfTrace_Packet, protowire.BytesType)
+	buf = protowire.AppendBytes(buf, packet)
+	ps.w.Write(buf)
+}
+
+func (ps *PerfettoSession) writeTrackDescriptor(desc pbMsg) {
+	ps.writePacket(pbMsg{}.msg(pfPacket_TrackDescriptor, desc))
+}
+
+func (ps *PerfettoSession) processTrack(pid int, name string) uint64 {
+	uuid := perfettoUuid(fmt.Sprintf("process/%v", pid))
+	if !ps.tracks[uuid] {
+		ps.tracks[uuid] = true
+		ps.writeTrackDescriptor(pbMsg{}.
+			varint(pfTrack_Uuid, uuid).
+			msg(pfTrack_Process, pbMsg{}.
+				varint(pfProcess_Pid, uint64(pid)).
+				str(pfProcess_Name, name)))
+	}
+	return uuid
+}
+
+func (ps *PerfettoSession) deviceTrack(coords rtdata.Coords) uint64 {
+	return ps.processTrack(traceDevicePid(coords),
+		fmt.Sprintf("Node %v Device %v", coords.NodeID, coords.DeviceID))
+}
+
+func (ps *PerfettoSession) childTrack(parent uint64, name string,
+	counterUnit string) uint64 {
+	uuid := perfettoUuid(fmt.Sprintf("%v/%v", parent, name))
+	if !ps.tracks[uuid] {
+		ps.tracks[uuid] = true
+		desc := pbMsg{}.
+			varint(pfTrack_Uuid, uuid).
+			varint(pfTrack_ParentUuid, parent).
+			str(pfTrack_Name, name)
+		if counterUnit != "" {
+			desc = desc.msg(pfTrack_Counter,
+				pbMsg{}.str(pfCounter_UnitName, counterUnit))
+		}
+		ps.writeTrackDescriptor(desc)
+	}
+	return uuid
+}
+
+// The track of the lane the slice is put on
+func (ps *PerfettoSession) laneTrack(parent uint64, name string,
+	start, end uint64) uint64 {
+	base := ps.childTrack(parent, name, "")
+	lane := ps.lanes.alloc(fmt.Sprint(base), start, end)
+	if lane == 0 {
+		return base
+	}
+	return ps.childTrack(parent, fmt.Sprintf("%v #%v", name, lane+1), "")
+}
+
+func (ps *PerfettoSession) writeTrackEvent(ts uint64, event pbMsg) {
+	ps.writePacket(pbMsg{}.
+		varint(pfPacket_Timestamp, ts).
+		msg(pfPacket_TrackEvent, event))
+}
+
+func (ps *PerfettoSession) emitSlices(parent uint64, category string,
+	slices []perfettoSlice) {
+	sort.SliceStable(slices, func(i, j int) bool {
+		return slices[i].start < slices[j].start
+	})
+	for _, s := range slices {
+		uuid := ps.laneTrack(parent, s.track, s.start, s.end)
+		evtType := uint64(pfEventType_SliceBegin)
+		if s.end <= s.start {
+			evtType = pfEventType_Instant
+		}
+		begin := pbMsg{}.
+			varint(pfEvent_Type, evtType).
+			varint(pfEvent_TrackUuid, uuid).
+			str(pfEvent_Categories, category).
+			str(pfEvent_Name, s.name)
+		for _, arg := range s.args {
+			begin = begin.msg(pfEvent_DebugAnnotations, arg.encode())
+		}
+		for _, flowId := range s.flowIds {
+			begin = begin.fixed64(pfEvent_FlowIds, flowId)
+		}
+		ps.writeTrackEvent(s.start, begin)
+		if evtType == pfEventType_SliceBegin {
+			ps.writeTrackEvent(s.end, pbMsg{}.
+				varint(pfEvent_Type, pfEventType_SliceEnd).
+				varint(pfEvent_TrackUuid, uuid))
+		}
+		ps.sliceCount++
+	}
+}
+
+func (ps *PerfettoSession) emitCounter(track uint64, ts uint64, value float64) {
+	ps.writeTrackEvent(ts, pbMsg{}.
+		varint(pfEvent_Type, pfEventType_Counter).
+		varint(pfEvent_TrackUuid, track).
+		double(pfEvent_DoubleCounter, value))
+	ps.counterCount++
+}
+
+// Each link has its own flow id, carried by the slices of both ends
+func (ps *PerfettoSession) DumpFlows(
+	coords rtdata.Coords,
+	links []rtinfo.FlowLink,
+) {
+	ps.flows = newFlowEnds(coords, links)
+}
+
+func (ps *PerfettoSession) flowIds(kind rtinfo.FlowNodeKind,
+	act rtdata.DpfAct) []uint64 {
+	if ps.flows == nil {
+		return nil
+	}
+	var ids []uint64
+	coords := ps.flows.coords
+	for _, i := range ps.flows.claim(rtinfo.NewFlowNode(kind, act), 0) {
+		ids = append(ids, perfettoUuid(fmt.Sprintf("flow/%v/%v/%v",
+			coords.NodeID, coords.DeviceID, i)))
+	}
+	return ids
+}
+
+func engineTrackName(evt codec.DpfEvent, engineIndex int) string {
+	return fmt.Sprintf("%v %v.%v", evt.EngineTypeCode, evt.ClusterID, engineIndex)
+}
+
+type hostSpan struct {
+	start, end uint64
+}
+
+func mapHostSpan(tm *rtinfo.TimelineManager, startCy, endCy uint64) (
+	hostSpan, bool) {
+	start, startOK := tm.MapToHosttime(startCy)
+	end, endOK := tm.MapToHosttime(endCy)
+	return hostSpan{start, end}, startOK && endOK
+}
+
+// Host info has no place on the timeline
+func (ps *PerfettoSession) DumpHostInfo(hostInfo mimicdefs.HostInfo) {}
+
+func (ps *PerfettoSession) DumpDtuOps(
+	coords rtdata.Coords,
+	bundle []rtdata.OpActivity,
+	tm *rtinfo.TimelineManager,
+) {
+	var slices []perfettoSlice
+	for _, act := range bundle {
+		if !act.IsOpRefValid() {
+			continue
+		}
+		span, ok := mapHostSpan(tm, act.StartCycle(), act.EndCycle())
+		if !ok {
+			continue
+		}
+		op, task := act.GetOp(), act.GetTask()
+		slices = append(slices, perfettoSlice{
+			track: engineTrackName(act.Start, act.Start.EngineIndex),
+			name:  fmt.Sprintf("%v.%v", op.OpName, op.OpId),
+			start: span.start,
+			end:   span.end,
+			args: []PerfettoArg{
+				{"op_id", op.OpId},
+				{"task_id", task.TaskID},
+				{"exec_uuid", fmt.Sprintf("0x%016x", task.ExecutableUUID)},
+				{"packet_id", act.Start.PacketID},
+				{"start_cycle", act.StartCycle()},
+				{"end_cycle", act.EndCycle()},
+			},
+			flowIds: ps.flowIds(rtinfo.FlowNode_Op, act.DpfAct),
+		})
+	}
+	ps.emitSlices(ps.deviceTrack(coords), "dtu_op", slices)
+}
+
+func (ps *PerfettoSession) DumpTaskVec(
+	coords rtdata.Coords,
+	taskVec []rtdata.OrderTask,
+	taskActMap map[int]rtdata.FwActivity,
+	tm *rtinfo.TimelineManager,
+) {
+	var slices []perfettoSlice
+	for _, oTask := range taskVec {
+		if !oTask.IsValid() {
+			continue
+		}
+		fwAct, ok := taskActMap[oTask.GetTaskID()]
+		if !ok {
+			continue
+		}
+		span, ok := mapHostSpan(tm, fwAct.StartCycle(), fwAct.EndCycle())
+		if !ok {
+			continue
+		}
+		task := oTask.GetRefToTask()
+		slices = append(slices, perfettoSlice{
+			track: fmt.Sprintf("Pg %06b", task.PgMask),
+			name:  fmt.Sprintf("Task.%v", task.TaskID),
+			start: span.start,
+			end:   span.end,
+			args: []PerfettoArg{
+				{"task_id", task.TaskID},
+				{"exec_uuid", fmt.Sprintf("0x%016x", task.ExecutableUUID)},
+				{"pg_mask", task.PgMask},
+			},
+		})
+	}
+	ps.emitSlices(ps.deviceTrack(coords), "task", slices)
+}
+
+func (ps *PerfettoSession) DumpFwActs(
+	coords rtdata.Coords,
+	bundle []rtdata.FwActivity,
+	taskActMap map[int]rtdata.FwActivity,
+	tm *rtinfo.TimelineManager,
+) {
+	taskIdHashMap := make(map[uint64]int)
+	for taskId, act := range taskActMap {
+		taskIdHashMap[act.GetHashCode()] = taskId
+	}
+	var slices []perfettoSlice
+	for _, act := range bundle {
+		span, ok := mapHostSpan(tm, act.StartCycle(), act.EndCycle())
+		if !ok {
+			continue
+		}
+		var name string
+		switch act.Start.EngineTypeCode {
+		case codec.EngCat_TS:
+			name, _ = rtdata.ToTSEventString(act.Start.Event)
+		case codec.EngCat_CQM, codec.EngCat_GSYNC:
+			name, _ = rtdata.ToCQMEventString(act.Start.Event)
+		default:
+			name = fmt.Sprintf("Engine(%s)", act.Start.EngineTypeCode)
+		}
+		s := perfettoSlice{
+			track: "FW " + engineTrackName(act.Start, act.Start.EngineIndex),
+			name:  name,
+			start: span.start,
+			end:   span.end,
+			args: []PerfettoArg{
+				{"packet_id", act.Start.PacketID},
+				{"start_cycle", act.StartCycle()},
+				{"end_cycle", act.EndCycle()},
+			},
+		}
+		if act.Start.EngineTypeCode == codec.EngCat_CQM &&
+			act.Start.Event == codec.CqmExecutableStart {
+			if taskId, ok := taskIdHashMap[act.GetHashCode()]; ok {
+				s.name = fmt.Sprintf("Task.%v", taskId)
+			}
+		}
+		if kind, ok := rtinfo.FwFlowNodeKind(act); ok {
+			s.flowIds = ps.flowIds(kind, act.DpfAct)
+		}
+		slices = append(slices, s)
+	}
+	ps.emitSlices(ps.deviceTrack(coords), "fw", slices)
+}
+
+func (ps *PerfettoSession) DumpDmaActs(
+	coords rtdata.Coords,
+	bundle []rtdata.CookedDmaActivity,
+	tm *rtinfo.TimelineManager,
+) {
+	device := ps.deviceTrack(coords)
+	var slices []perfettoSlice
+	for _, act := range bundle {
+		span, ok := mapHostSpan(tm, act.StartCycle(), act.EndCycle())
+		if !ok {
+			continue
+		}
+		name, _ := rtdata.ToDmaEventString(act.Start.Event)
+		s := perfettoSlice{
+			track: engineTrackName(act.Start, act.GetEngineIndex()),
+			name:  name,
+			start: span.start,
+			end:   span.end,
+			args: []PerfettoArg{
+				{"packet_id", act.Start.PacketID},
+				{"vc", act.GetVcId()},
+				{"match_status", act.Status.String()},
+			},
+		}
+		if act.IsDmaMetaRefValid() {
+			task := act.GetTask()
+			s.name = act.GetDmaMeta().DmaOpString
+			s.args = append(s.args,
+				PerfettoArg{"task_id", task.TaskID},
+				PerfettoArg{"exec_uuid", fmt.Sprintf("0x%016x", task.ExecutableUUID)})
+		}
+		s.flowIds = ps.flowIds(rtinfo.FlowNode_Dma, act.DpfAct)
+		if act.OwnerOpValid {
+			s.args = append(s.args,
+				PerfettoArg{"op_id", act.OwnerOpId},
+				PerfettoArg{"op_name", act.OwnerOpName})
+		}
+		slices = append(slices, s)
+	}
+	ps.emitSlices(device, "dma", slices)
+}
+
+// Each track is a counter track under the device
+func (ps *PerfettoSession) DumpCounters(
+	coords rtdata.Coords,
+	tracks []rtinfo.CounterTrack,
+	tm *rtinfo.TimelineManager,
+) {
+	device := ps.deviceTrack(coords)
+	for _, track := range tracks {
+		uuid := ps.childTrack(device, track.Name, track.Unit)
+		for _, pt := range track.Points {
+			if hosttime, ok := tm.MapToHosttime(pt.Cycle); ok {
+				ps.emitCounter(uuid, hosttime, pt.Value)
+			}
+		}
+	}
+}
+
+func (ps *PerfettoSession) DumpKernelActs(
+	coords rtdata.Coords,
+	bundle []rtdata.KernelActivity,
+	tm *rtinfo.TimelineManager,
+	rowName string,
+) {
+	var slices []perfettoSlice
+	for _, act := range bundle {
+		span, ok := mapHostSpan(tm, act.StartCycle(), act.EndCycle())
+		if !ok {
+			continue
+		}
+		name, nameOK := act.GetSipOpName()
+		if !nameOK {
+			name = "SIP Act"
+		}
+		s := perfettoSlice{
+			track: rowName + " " + engineTrackName(act.Start, act.GetEngineIndex()),
+			name:  name,
+			start: span.start,
+			end:   span.end,
+			args: []PerfettoArg{
+				{"start_cycle", act.StartCycle()},
+				{"end_cycle", act.EndCycle()},
+			},
+		}
+		if rtInfo := act.RtInfo; rtInfo.SubValid {
+			s.args = append(s.args,
+				PerfettoArg{"task_id", rtInfo.TaskId},
+				PerfettoArg{"op_id", rtInfo.OpId},
+				PerfettoArg{"confidence", rtInfo.Confidence},
+				PerfettoArg{"attrib_reason", rtInfo.Reason.String()})
+			if rtInfo.IsLowConfidence() {
+				s.name += " (?)"
+			}
+		}
+		s.flowIds = ps.flowIds(rtinfo.FlowNode_Kernel, act.DpfAct)
+		slices = append(slices, s)
+	}
+	ps.emitSlices(ps.deviceTrack(coords), "kernel", slices)
+}
+
+func (ps *PerfettoSession) DumpCpuOpTrace(
+	coords rtdata.Coords,
+	cpuOps []rtdata.CpuOpAct,
+	rowName string,
+) {
+	if ps.cpuOpsDumped {
+		return
+	}
+	ps.cpuOpsDumped = true
+	slices := make([]perfettoSlice, len(cpuOps))
+	for i, act := range cpuOps {
+		slices[i] = perfettoSlice{
+			track: rowName + " " + act.Cat,
+			name:  act.Name,
+			start: act.StartTimestamp,
+			end:   act.EndTimestamp,
+		}
+	}
+	ps.emitSlices(ps.processTrack(traceHostPid, "Host"), "cpu_op", slices)
+}
+
+// Coverage has no time, it stays in the vpd only
+func (ps *PerfettoSession) DumpOpCoverage(
+	coords rtdata.Coords,
+	coverage rtinfo.OpCoverageReport,
+) {
+}
+
+func (ps *PerfettoSession) DumpCriticalPaths(
+	coords rtdata.Coords,
+	paths []rtinfo.TaskCriticalPath,
+	tm *rtinfo.TimelineManager,
+) {
+	var slices []perfettoSlice
+	for _, path := range paths {
+		for _, seg := range path.Segments {
+			span, ok := mapHostSpan(tm, seg.StartCycle, seg.EndCycle)
+			if !ok {
+				continue
+			}
+			slices = append(slices, perfettoSlice{
+				track: CriticalPathRowName,
+				name:  fmt.Sprintf("%v: %v", seg.Kind, seg.Name),
+				start: span.start,
+				end:   span.end,
+				args: []PerfettoArg{
+					{"task_id", path.TaskID},
+					{"op_id", seg.OpId},
+					{"cycles", seg.Cycles()},
+				},
+			})
+		}
+	}
+	ps.emitSlices(ps.deviceTrack(coords), "critical_path", slices)
+}
+
+// Utilization is a summary, it stays in the vpd only
+func (ps *PerfettoSession) DumpUtilization(
+	coords rtdata.Coords,
+	report rtinfo.UtilizationReport,
+	tm *rtinfo.TimelineManager,
+) {
+}
+
+func (ps *PerfettoSession) DumpKernelAsserts(
+	coords rtdata.Coords,
+	report rtinfo.KernelAssertReport,
+	tm *rtinfo.TimelineManager,
+) {
+	var slices []perfettoSlice
+	for _, a := range report.Asserts {
+		hostTime, ok := tm.MapToHosttime(a.Event.Cycle)
+		if !ok {
+			continue
+		}
+		slices = append(slices, perfettoSlice{
+			track: KernelAssertRowName,
+			name:  "ASSERT " + a.Location(),
+			start: hostTime,
+			end:   hostTime,
+			args: []PerfettoArg{
+				{"context", a.Context()},
+				{"cause_id", a.CauseId},
+			},
+		})
+	}
+	ps.emitSlices(ps.deviceTrack(coords), "kernel_assert", slices)
+}
@@ -0,0 +1,80 @@
+package dbexport
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"git.enflame.cn/hai.bai/dmaster/rtinfo/rtdata"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Top level fields of each packet, in order
+func readPerfettoPackets(t *testing.T, name string) [][]protowire.Number {
+	buf, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rv [][]protowire.Number
+	for len(buf) > 0 {
+		num, typ, n := protowire.ConsumeTag(buf)
+		if num != pfTrace_Packet || typ != protowire.BytesType {
+			t.Fatalf("unexpected trace field %v", num)
+		}
+		packet, m := protowire.ConsumeBytes(buf[n:])
+		if m < 0 {
+			t.Fatalf("malformed packet")
+		}
+		buf = buf[n+m:]
+		var fields []protowire.Number
+		for len(packet) > 0 {
+			num, typ, n := protowire.ConsumeTag(packet)
+			m := protowire.ConsumeFieldValue(num, typ, packet[n:])
+			if m < 0 {
+				t.Fatalf("malformed field %v", num)
+			}
+			packet = packet[n+m:]
+			fields = append(fields, num)
+		}
+		rv = append(rv, fields)
+	}
+	return rv
+}
+
+func TestPerfettoLanes(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "foo.perfetto-trace")
+	ps, err := NewPerfettoSession(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cpuOps := []rtdata.CpuOpAct{
+		{Cat: "BACKEND", Name: "a", StartTimestamp: 0, EndTimestamp: 100},
+		{Cat: "BACKEND", Name: "b", StartTimestamp: 50, EndTimestamp: 80}, // nested
+		{Cat: "BACKEND", Name: "c", StartTimestamp: 90, EndTimestamp: 120},
+		{Cat: "BACKEND", Name: "d", StartTimestamp: 130, EndTimestamp: 140},
+	}
+	// Every device comes with the same host cpu ops
+	for dev := 0; dev < 2; dev++ {
+		ps.DumpCpuOpTrace(rtdata.Coords{DeviceID: dev}, cpuOps, "CPU Op")
+	}
+	ps.Close()
+
+	var descs, events int
+	for _, fields := range readPerfettoPackets(t, name) {
+		for _, num := range fields {
+			switch num {
+			case pfPacket_TrackDescriptor:
+				descs++
+			case pfPacket_TrackEvent:
+				events++
+			}
+		}
+	}
+	// Host process, the cpu op track and one more lane shared by b and c
+	if descs != 3 {
+		t.Errorf("expecting 3 track descriptors, got %v", descs)
+	}
+	if events != 8 {
+		t.Errorf("expecting 8 track events, got %v", events)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"database/sql"
 
 	"git.enflame.cn/hai.bai/dmaster/assert"
+	"git.enflame.cn/hai.bai/dmaster/topsdev/mimic/mimicdefs"
 )
 
 type PlatformInfoSession struct {
@@ -14,12 +15,18 @@ func NewPlatformInfoSession(db *sql.DB) *PlatformInfoSession {
 	return &PlatformInfoSession{
 		TableSession: NewTableSession(db,
 			`insert into platform(
-				product
-			) values(?)`),
+				product, platform, os_name,
+				os_version, os_release,
+				host_name, arch, cpu_model, cpu_vendor,
+				distribution_name
+			) values(?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`),
 	}
 }
 
-func (platS *PlatformInfoSession) AddPlatform(product string) {
-	_, err := platS.stmt.Exec(product)
+func (platS *PlatformInfoSession) AddPlatform(pl mimicdefs.PlatformInfo) {
+	_, err := platS.stmt.Exec(pl.Product, pl.Platform, pl.OsName,
+		pl.OsVersion, pl.OsRelease,
+		pl.HostName, pl.Arch, pl.CpuModel, pl.CpuVendor,
+		pl.DistributionName)
 	assert.Assert(err == nil, "Must be nil error: %v", err)
 }
@@ -0,0 +1,85 @@
+package dbexport
+
+import (
+	"database/sql"
+	"log"
+
+	"git.enflame.cn/hai.bai/dmaster/assert"
+	"git.enflame.cn/hai.bai/dmaster/rtinfo/rtdata"
+)
+
+// How dmaster made the vpd: inputs, options, version and the quality of
+// decoding and timeline mapping, to tell why two vpds of the same capture
+// differ. One row per item, the run-wide ones with node and device -1.
+const (
+	createProvenanceTable = `
+	CREATE TABLE provenance(node_id INT,device_id INT,
+		scope TEXT,name TEXT,value TEXT);`
+)
+
+const (
+	ProvenanceScope_Run      = "run"      // dmaster version, arch and so on
+	ProvenanceScope_Input    = "input"    // input path to its sha256
+	ProvenanceScope_Flag     = "flag"     // command line flag to its value
+	ProvenanceScope_Decode   = "decode"   // ring buffer items decoded
+	ProvenanceScope_Timeline = "timeline" // timeline mapping of the device
+)
+
+// Coords of the run-wide items
+var ProvenanceRunCoords = rtdata.Coords{NodeID: -1, DeviceID: -1}
+
+type ProvenanceItem struct {
+	Coords rtdata.Coords
+	Scope  string
+	Name   string
+	Value  string
+}
+
+func init() {
+	RegisterTabInitCommand(createProvenanceTable)
+	RegisterSchemaMigration(SchemaMigration{
+		Version:     6,
+		Description: "provenance table",
+		Up: func(tx *sql.Tx) error {
+			return createTablesIfMissing(tx, createProvenanceTable)
+		},
+	})
+}
+
+type ProvenanceSession struct {
+	TableSession
+}
+
+func NewProvenanceSession(db *sql.DB) *ProvenanceSession {
+	return &ProvenanceSession{
+		TableSession: NewTableSession(db, `insert into provenance(
+			node_id, device_id,
+			scope, name, value
+		) values(?, ?,
+				 ?, ?, ?)`),
+	}
+}
+
+func (provS *ProvenanceSession) AddProvenance(nodeID, devID int,
+	scope, name, value string) {
+	_, err := provS.stmt.Exec(nodeID, devID,
+		scope, name, value,
+	)
+	assert.Assert(err == nil, "Must be nil error: %v", err)
+}
+
+// DumpProvenance is called once per run with the items of all devices,
+// after the devices are dumped
+func (dbs *DbSession) DumpProvenance(items []ProvenanceItem) {
+	provS := NewProvenanceSession(dbs.dbObject)
+	defer provS.Close()
+	for _, item := range items {
+		provS.AddProvenance(item.Coords.NodeID, item.Coords.DeviceID,
+			item.Scope, item.Name, item.Value)
+		dbs.itemStat.provenanceCount++
+	}
+	log.Printf("# %v provenance item(s) have been traced into %v",
+		len(items),
+		dbs.targetName,
+	)
+}
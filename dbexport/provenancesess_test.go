@@ -0,0 +1,42 @@
+package dbexport
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"git.enflame.cn/hai.bai/dmaster/rtinfo/rtdata"
+)
+
+func TestDumpProvenance(t *testing.T) {
+	target := filepath.Join(t.TempDir(), "foo.vpd")
+	dbs, err := NewDbSession(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dbs.DumpProvenance([]ProvenanceItem{
+		{ProvenanceRunCoords, ProvenanceScope_Flag, "force1task", "true"},
+		{rtdata.Coords{DeviceID: 1}, ProvenanceScope_Decode, "errors", "3"},
+	})
+	dbs.Close()
+
+	db, err := sql.Open("sqlite3", target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	var devID int
+	var value string
+	if err := db.QueryRow(`select device_id, value from provenance
+		where scope = 'decode' and name = 'errors'`).Scan(&devID, &value); err != nil {
+		t.Fatal(err)
+	}
+	if devID != 1 || value != "3" {
+		t.Errorf("expecting 3 errors of device 1, got %v of %v", value, devID)
+	}
+	var count int
+	db.QueryRow(`select count from header where table_name = 'provenance'`).Scan(&count)
+	if count != 2 {
+		t.Errorf("expecting 2 provenance items in header, got %v", count)
+	}
+}
@@ -0,0 +1,95 @@
+package dbexport
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"os"
+)
+
+// ReadOnlyVpd is a vpd opened for reading only, the vpd itself is never
+// changed. One of an older schema is read through an upgraded copy,
+// which is removed on Close.
+type ReadOnlyVpd struct {
+	*sql.DB
+	scratch string
+}
+
+// Every connection of the pool is read only by the DSN
+func openReadOnly(target string) (*sql.DB, error) {
+	dsn := "file:" + (&url.URL{Path: target}).EscapedPath() +
+		"?mode=ro&_query_only=1"
+	return sql.Open("sqlite3", dsn)
+}
+
+func copyToScratch(target string) (string, error) {
+	fin, err := os.Open(target)
+	if err != nil {
+		return "", err
+	}
+	defer fin.Close()
+	fout, err := os.CreateTemp("", "dmaster-ro-*.vpd")
+	if err != nil {
+		return "", err
+	}
+	scratch := fout.Name()
+	_, err = io.Copy(fout, fin)
+	if cerr := fout.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(scratch)
+		return "", err
+	}
+	return scratch, nil
+}
+
+// OpenVpdReadOnly refuses vpd of versions newer than this build
+func OpenVpdReadOnly(target string) (*ReadOnlyVpd, error) {
+	if !ifFileExist(target) {
+		return nil, fmt.Errorf("no such file: %v", target)
+	}
+	db, err := openReadOnly(target)
+	if err != nil {
+		return nil, err
+	}
+	version, err := DetectSchemaVersion(db)
+	if err == nil && version > CurrentSchemaVersion() {
+		err = fmt.Errorf("vpd schema version %v is newer than %v of this build",
+			version, CurrentSchemaVersion())
+	}
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("%v: %v", target, err)
+	}
+	if version == CurrentSchemaVersion() {
+		return &ReadOnlyVpd{DB: db}, nil
+	}
+	db.Close()
+
+	scratch, err := copyToScratch(target)
+	if err != nil {
+		return nil, err
+	}
+	if _, _, err := MigrateVpd(scratch); err != nil {
+		os.Remove(scratch)
+		return nil, fmt.Errorf("%v: %v", target, err)
+	}
+	if db, err = openReadOnly(scratch); err != nil {
+		os.Remove(scratch)
+		return nil, err
+	}
+	log.Printf("%v of schema version %v is read through an upgraded copy, "+
+		"dmaster migrate upgrades it in place", target, version)
+	return &ReadOnlyVpd{DB: db, scratch: scratch}, nil
+}
+
+func (v *ReadOnlyVpd) Close() error {
+	err := v.DB.Close()
+	if v.scratch != "" {
+		os.Remove(v.scratch)
+	}
+	return err
+}
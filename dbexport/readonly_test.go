@@ -0,0 +1,62 @@
+package dbexport
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestOpenVpdReadOnly(t *testing.T) {
+	target := filepath.Join(t.TempDir(), "old vpd#1.vpd")
+	db, err := sql.Open("sqlite3", target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, err := db.Exec(v1Schema); err != nil {
+		t.Fatal(err)
+	}
+
+	vpd, err := OpenVpdReadOnly(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The columns of now are there to read, in the copy
+	var tagged int
+	if err := vpd.QueryRow(`select count(*) from dtu_op
+		where capture_id = 0`).Scan(&tagged); err != nil || tagged != 2 {
+		t.Errorf("expecting 2 rows in capture 0, got %v: %v", tagged, err)
+	}
+	if _, err := vpd.Exec(`delete from dtu_op`); err == nil {
+		t.Errorf("expecting the vpd read only")
+	}
+	scratch := vpd.scratch
+	vpd.Close()
+	if _, err := os.Stat(scratch); !os.IsNotExist(err) {
+		t.Errorf("expecting the copy %v removed", scratch)
+	}
+	if v, err := DetectSchemaVersion(db); err != nil || v != baseSchemaVersion {
+		t.Errorf("expecting the vpd left at %v, got %v: %v", baseSchemaVersion, v, err)
+	}
+
+	// Of the current version, read as it is
+	if _, _, err := MigrateVpd(target); err != nil {
+		t.Fatal(err)
+	}
+	if vpd, err = OpenVpdReadOnly(target); err != nil {
+		t.Fatal(err)
+	}
+	if vpd.scratch != "" {
+		t.Errorf("expecting no copy of the current version")
+	}
+	vpd.Close()
+
+	recordSchemaVersion(db, CurrentSchemaVersion()+1, "from the future")
+	if _, err := OpenVpdReadOnly(target); err == nil {
+		t.Errorf("expecting newer version refused")
+	}
+	if _, err := OpenVpdReadOnly(target + ".none"); err == nil {
+		t.Errorf("expecting error of the missing vpd")
+	}
+}
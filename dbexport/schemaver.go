@@ -0,0 +1,296 @@
+package dbexport
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+)
+
+// The version of the vpd as a whole, the per-table versions in header
+// are kept for the viewer. One row per migration applied, the vpd is
+// created at the latest version.
+const (
+	createSchemaVersionTable = `
+	CREATE TABLE schema_version(version INT,description TEXT,apply_time TEXT);`
+)
+
+func init() {
+	RegisterTabInitCommand(createSchemaVersionTable)
+}
+
+// A vpd without schema_version is of the first version
+const baseSchemaVersion = 1
+
+// SchemaMigration upgrades a vpd from Version-1 to Version.
+// Migrations must be idempotent, a vpd half upgraded by an older
+// dmaster may see the same step again.
+type SchemaMigration struct {
+	Version     int
+	Description string
+	Up          func(tx *sql.Tx) error
+}
+
+var schemaMigrations []SchemaMigration
+
+// RegisterSchemaMigration is called once per version, in any order
+func RegisterSchemaMigration(m SchemaMigration) {
+	schemaMigrations = append(schemaMigrations, m)
+	sort.SliceStable(schemaMigrations, func(i, j int) bool {
+		return schemaMigrations[i].Version < schemaMigrations[j].Version
+	})
+}
+
+// CurrentSchemaVersion is the version of a vpd created by this build
+func CurrentSchemaVersion() int {
+	if len(schemaMigrations) == 0 {
+		return baseSchemaVersion
+	}
+	return schemaMigrations[len(schemaMigrations)-1].Version
+}
+
+func verifySchemaMigrations() error {
+	for i, m := range schemaMigrations {
+		if m.Version != baseSchemaVersion+i+1 {
+			return fmt.Errorf("schema migration %v(%v) out of order",
+				m.Version, m.Description)
+		}
+	}
+	return nil
+}
+
+func hasTable(db dbQueryer, table string) (bool, error) {
+	var count int
+	err := db.QueryRow(`select count(*) from sqlite_master
+		where type = 'table' and name = ?`, table).Scan(&count)
+	return count > 0, err
+}
+
+// DetectSchemaVersion tells the version of the vpd
+func DetectSchemaVersion(db *sql.DB) (int, error) {
+	withVersion, err := hasTable(db, "schema_version")
+	if err != nil {
+		return 0, err
+	}
+	if withVersion {
+		var version sql.NullInt64
+		if err := db.QueryRow(`select max(version) from schema_version`).
+			Scan(&version); err != nil {
+			return 0, err
+		}
+		if version.Valid {
+			return int(version.Int64), nil
+		}
+	}
+	withDtuOp, err := hasTable(db, "dtu_op")
+	if err != nil {
+		return 0, err
+	}
+	if !withDtuOp {
+		return 0, fmt.Errorf("not a vpd, no dtu_op table")
+	}
+	return baseSchemaVersion, nil
+}
+
+func recordSchemaVersion(db dbQueryer, version int, description string) error {
+	_, err := db.Exec(`insert into schema_version(version, description, apply_time)
+		values(?, ?, ?)`, version, description, time.Now().Format(time.RFC3339))
+	return err
+}
+
+// MigrateSchema upgrades the vpd to the current version in place,
+// each step in its own transaction. It refuses versions newer than
+// this build knows.
+func MigrateSchema(db *sql.DB) (from, to int, err error) {
+	if err = verifySchemaMigrations(); err != nil {
+		return
+	}
+	if from, err = DetectSchemaVersion(db); err != nil {
+		return
+	}
+	to = from
+	if from > CurrentSchemaVersion() {
+		err = fmt.Errorf("vpd schema version %v is newer than %v of this build",
+			from, CurrentSchemaVersion())
+		return
+	}
+	if _, err = db.Exec(
+		strings.Replace(createSchemaVersionTable,
+			"CREATE TABLE ", "CREATE TABLE IF NOT EXISTS ", 1)); err != nil {
+		return
+	}
+	for _, m := range schemaMigrations {
+		if m.Version <= to {
+			continue
+		}
+		var tx *sql.Tx
+		if tx, err = db.Begin(); err != nil {
+			return
+		}
+		if err = m.Up(tx); err == nil {
+			err = recordSchemaVersion(tx, m.Version, m.Description)
+		}
+		if err != nil {
+			tx.Rollback()
+			err = fmt.Errorf("migrate to %v(%v): %v", m.Version, m.Description, err)
+			return
+		}
+		if err = tx.Commit(); err != nil {
+			return
+		}
+		log.Printf("vpd schema migrated to %v: %v", m.Version, m.Description)
+		to = m.Version
+	}
+	return
+}
+
+// MigrateVpd is MigrateSchema on a vpd file
+func MigrateVpd(target string) (from, to int, err error) {
+	if !ifFileExist(target) {
+		return 0, 0, fmt.Errorf("no such file: %v", target)
+	}
+	db, err := sql.Open("sqlite3", target)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer db.Close()
+	return MigrateSchema(db)
+}
+
+// CheckVpdSchema makes a vpd readable by this build, older versions are
+// upgraded in place and newer ones are refused
+func CheckVpdSchema(db *sql.DB, target string) error {
+	from, to, err := MigrateSchema(db)
+	if err != nil {
+		return fmt.Errorf("%v: %v", target, err)
+	}
+	if from != to {
+		log.Printf("%v upgraded from schema version %v to %v", target, from, to)
+	}
+	return nil
+}
+
+// Columns given as "name TYPE", the existing ones are skipped
+func addMissingColumns(tx *sql.Tx, table string, columns ...string) error {
+	cols, err := tableColumns(tx, table)
+	if err != nil {
+		return err
+	}
+	for _, col := range columns {
+		name := strings.Fields(col)[0]
+		if cols[name] {
+			continue
+		}
+		if _, err := tx.Exec(fmt.Sprintf(`alter table %v add column %v`,
+			table, col)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func createTablesIfMissing(tx *sql.Tx, creates ...string) error {
+	for _, create := range creates {
+		if _, err := tx.Exec(strings.Replace(create,
+			"CREATE TABLE ", "CREATE TABLE IF NOT EXISTS ", 1)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func init() {
+	RegisterSchemaMigration(SchemaMigration{
+		Version:     2,
+		Description: "task and attribution columns of dtu_op, memcpy and kernel",
+		Up: func(tx *sql.Tx) error {
+			if err := addMissingColumns(tx, "dtu_op",
+				"task_id INT", "exec_uuid TEXT"); err != nil {
+				return err
+			}
+			if err := addMissingColumns(tx, "memcpy",
+				"dma_op TEXT", "task_id INT", "exec_uuid TEXT",
+				"match_status TEXT"); err != nil {
+				return err
+			}
+			return addMissingColumns(tx, "kernel",
+				"confidence REAL", "attrib_reason TEXT")
+		},
+	})
+	RegisterSchemaMigration(SchemaMigration{
+		Version:     3,
+		Description: "analysis tables",
+		Up: func(tx *sql.Tx) error {
+			return createTablesIfMissing(tx,
+				createOpCoverageTable,
+				createCriticalPathTable,
+				createEngineUtilTable,
+				createPgUtilTable,
+				createDmaBandwidthTable,
+				createKernelAssertTable,
+			)
+		},
+	})
+	RegisterSchemaMigration(SchemaMigration{
+		Version:     4,
+		Description: "captures, rows there before go to capture 0",
+		Up: func(tx *sql.Tx) error {
+			if err := createTablesIfMissing(tx, createCaptureTable); err != nil {
+				return err
+			}
+			var captures int
+			if err := tx.QueryRow(`select count(*) from capture`).
+				Scan(&captures); err != nil {
+				return err
+			}
+			tables, err := listTables(tx)
+			if err != nil {
+				return err
+			}
+			idxEnd, vpIdEnd := -1, 0
+			for _, table := range tables {
+				if untaggedTables[table] {
+					continue
+				}
+				if err := addMissingColumns(tx, table,
+					captureIdColumn+" INT"); err != nil {
+					return err
+				}
+				if captures > 0 {
+					continue
+				}
+				if _, err := tx.Exec(fmt.Sprintf(
+					`update %v set %v = 0 where %v is null`,
+					table, captureIdColumn, captureIdColumn)); err != nil {
+					return err
+				}
+				cols, err := tableColumns(tx, table)
+				if err != nil {
+					return err
+				}
+				for col, end := range map[string]*int{"idx": &idxEnd, "vp_id": &vpIdEnd} {
+					if !cols[col] {
+						continue
+					}
+					v, err := maxOfColumn(tx, table, col)
+					if err != nil {
+						return err
+					}
+					if v.Valid && int(v.Int64) > *end {
+						*end = int(v.Int64)
+					}
+				}
+			}
+			if captures > 0 {
+				return nil
+			}
+			_, err = tx.Exec(`insert into capture(capture_id, source, create_time,
+				idx_begin, idx_end, vp_id_begin, vp_id_end)
+				values(0, 'migrated', ?, 0, ?, 1, ?)`,
+				time.Now().Format(time.RFC3339), idxEnd, vpIdEnd)
+			return err
+		},
+	})
+}
@@ -0,0 +1,170 @@
+package dbexport
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+)
+
+// The tables of a vpd before schema_version, as written by the first versions
+const v1Schema = `
+	CREATE TABLE header(table_name TEXT,version TEXT,category TEXT,count INT,time_unit TEXT);
+	CREATE TABLE dtu_op(idx INT,name TEXT,node_id INT,description TEXT,
+		context_id INT,start_timestamp INT,
+		end_timestamp INT,duration_timestamp INT,
+		start_cycle INT,end_cycle INT,duration_cycle INT,
+		device TEXT,op_id INT,op_name TEXT,kind TEXT,fusion_kind TEXT,
+		input_shape TEXT,output_shape TEXT,layer_kind TEXT,
+		layer_name TEXT,
+		module_id INT,module_name TEXT,meta TEXT,device_id INT,
+		cluster_id INT,vp_id INT,row_name TEXT,tid TEXT);
+	CREATE TABLE fw(idx INT,name TEXT,node_id INT,description TEXT,context_id INT,
+		start_timestamp INT,end_timestamp INT,duration_timestamp INT,
+		start_cycle INT,end_cycle INT,duration_cycle INT,
+		packet_id INT,device_id INT,cluster_id INT,engine_id INT,
+		engine_type TEXT,args TEXT,vp_id INT,row_name TEXT,tid TEXT);
+	CREATE TABLE memcpy(idx INT,name TEXT,node_id INT,description TEXT,context_id INT,
+		start_timestamp INT,end_timestamp INT,duration_timestamp INT,
+		start_cycle INT,end_cycle INT,duration_cycle INT,
+		packet_id INT,device_id INT,cluster_id INT,engine_id INT,
+		engine_type TEXT,op_id INT,op_name TEXT,
+		src_addr INT,dst_addr INT,src_size INT,dst_size INT,
+		direction TEXT,tiling_mode TEXT,vc INT,
+		args TEXT,vp_id INT,row_name TEXT,tid TEXT);
+	CREATE TABLE kernel(idx INT,name TEXT,node_id INT,description TEXT,context_id INT,
+		start_timestamp INT,end_timestamp INT,duration_timestamp INT,
+		start_cycle INT,end_cycle INT,duration_cycle INT,packet_id INT,
+		device_id INT,cluster_id INT,engine_id INT,engine_type TEXT,
+		op_id INT,op_name TEXT,vp_id INT,row_name TEXT,tid TEXT);
+	insert into dtu_op(idx, name, vp_id) values(0, 'a', 1), (1, 'b', 2);`
+
+func TestMigrateV1(t *testing.T) {
+	target := filepath.Join(t.TempDir(), "old.vpd")
+	db, err := sql.Open("sqlite3", target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, err := db.Exec(v1Schema); err != nil {
+		t.Fatal(err)
+	}
+
+	from, to, err := MigrateVpd(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if from != baseSchemaVersion || to != CurrentSchemaVersion() {
+		t.Errorf("expecting %v to %v, got %v to %v",
+			baseSchemaVersion, CurrentSchemaVersion(), from, to)
+	}
+
+	cols, err := tableColumns(db, "dtu_op")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, col := range []string{"task_id", "exec_uuid", captureIdColumn} {
+		if !cols[col] {
+			t.Errorf("expecting column %v in dtu_op", col)
+		}
+	}
+	if ok, _ := hasTable(db, "kernel_assert"); !ok {
+		t.Errorf("expecting kernel_assert created")
+	}
+	if ok, _ := hasTable(db, "dma_bandwidth"); ok {
+		t.Errorf("expecting dma_bandwidth gone to counter")
+	}
+	var untagged, idxEnd int
+	db.QueryRow(`select count(*) from dtu_op where capture_id is null`).Scan(&untagged)
+	db.QueryRow(`select idx_end from capture where capture_id = 0`).Scan(&idxEnd)
+	if untagged != 0 || idxEnd != 1 {
+		t.Errorf("expecting rows in capture 0 up to idx 1, got %v untagged, idx end %v",
+			untagged, idxEnd)
+	}
+
+	// Nothing more to do the second time
+	if from, to, err = MigrateVpd(target); err != nil || from != to {
+		t.Errorf("expecting no migration, got %v to %v: %v", from, to, err)
+	}
+
+	// Appending goes on from there
+	dumpCoverageCapture(t, target, DbSessionOpt{Append: true}, 1)
+	var captureId, idx int
+	db.QueryRow(`select capture_id, idx from op_coverage`).Scan(&captureId, &idx)
+	if captureId != 1 || idx != 2 {
+		t.Errorf("expecting capture 1 from idx 2, got %v, %v", captureId, idx)
+	}
+}
+
+func TestMigrateRefuseNewer(t *testing.T) {
+	target := filepath.Join(t.TempDir(), "new.vpd")
+	dbs, err := NewDbSession(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dbs.Close()
+
+	db, err := sql.Open("sqlite3", target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if v, err := DetectSchemaVersion(db); err != nil || v != CurrentSchemaVersion() {
+		t.Fatalf("expecting a new vpd at %v, got %v: %v", CurrentSchemaVersion(), v, err)
+	}
+	recordSchemaVersion(db, CurrentSchemaVersion()+1, "from the future")
+	if err := CheckVpdSchema(db, target); err == nil {
+		t.Errorf("expecting newer version refused")
+	}
+}
+
+func TestMigrateDmaBandwidthToCounter(t *testing.T) {
+	target := filepath.Join(t.TempDir(), "v8.vpd")
+	dbs, err := NewDbSession(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dbs.Close()
+
+	db, err := sql.Open("sqlite3", target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	// Back to version 8, with the bandwidth in its own table
+	if _, err := db.Exec(`update schema_version set version = 8;` +
+		createDmaBandwidthTable + `
+		alter table dma_bandwidth add column capture_id INT;
+		insert into dma_bandwidth(idx, node_id, device_id, track_name,
+			engine_type, cluster_id, engine_id, direction,
+			timestamp, value, capture_id)
+		values(7, 0, 1, 'CDMA.0.0 L1->L2 GB/s', 'CDMA', 0, 0, 'L1->L2', 100, 10, 0);
+		insert into header values('dma_bandwidth', '1.0', 'DTUMemcpyBandwidth', 1, 'ns');`); err != nil {
+		t.Fatal(err)
+	}
+
+	if from, to, err := MigrateVpd(target); err != nil || from != 8 || to != 9 {
+		t.Fatalf("expecting 8 to 9, got %v to %v: %v", from, to, err)
+	}
+	if ok, _ := hasTable(db, "dma_bandwidth"); ok {
+		t.Errorf("expecting dma_bandwidth dropped")
+	}
+	var name, unit string
+	var idx, captureId int
+	var value float64
+	if err := db.QueryRow(`select idx, track_name, unit, value, capture_id
+		from counter where device_id = 1 and timestamp = 100`).
+		Scan(&idx, &name, &unit, &value, &captureId); err != nil {
+		t.Fatal(err)
+	}
+	if idx != 7 || name != "CDMA.0.0 L1->L2 bandwidth" || unit != "GB/s" ||
+		value != 10 || captureId != 0 {
+		t.Errorf("unexpected counter row: %v %v %v %v %v",
+			idx, name, unit, value, captureId)
+	}
+	var headers int
+	db.QueryRow(`select count(*) from header where table_name = 'dma_bandwidth'`).
+		Scan(&headers)
+	if headers != 0 {
+		t.Errorf("expecting the dma_bandwidth header removed")
+	}
+}
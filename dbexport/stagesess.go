@@ -0,0 +1,200 @@
+package dbexport
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Devices are dumped concurrently each into its own stage, a scratch db
+// with idx and vp id from 0. Stages are merged into the session in the
+// order given, with idx and vp_id offset by what is there before, so
+// the vpd is the same as dumping the devices one after another.
+
+// OpenStages makes count stages of the session, to be dumped into by
+// one goroutine each and then given to MergeStages
+func (dbs *DbSession) OpenStages(count int) ([]*DbSession, error) {
+	var stages []*DbSession
+	closeAll := func() {
+		for _, stage := range stages {
+			stage.Close()
+			os.Remove(stage.targetName)
+		}
+	}
+	for i := 0; i < count; i++ {
+		fout, err := os.CreateTemp("", "dmaster-stage-*.vpd")
+		if err != nil {
+			closeAll()
+			return nil, err
+		}
+		scratch := fout.Name()
+		fout.Close()
+
+		db, err := sql.Open("sqlite3", scratch)
+		if err == nil {
+			_, err = db.Exec(getDbInitSchema())
+		}
+		if err != nil {
+			if db != nil {
+				db.Close()
+			}
+			os.Remove(scratch)
+			closeAll()
+			return nil, fmt.Errorf("stage %v of %v: %v", i, dbs.targetName, err)
+		}
+		stages = append(stages, &DbSession{
+			targetName: scratch,
+			dbObject:   db,
+			vpIds:      &VpIdAllocator{},
+			staged:     true,
+		})
+	}
+	return stages, nil
+}
+
+// MergeStages closes the stages and copies their rows over, the stage
+// files are removed
+func (dbs *DbSession) MergeStages(stages []*DbSession) error {
+	for _, stage := range stages {
+		stage.Close()
+	}
+	defer func() {
+		for _, stage := range stages {
+			os.Remove(stage.targetName)
+		}
+	}()
+
+	ctx := context.Background()
+	// Attached db is seen by the connection attaching it only
+	conn, err := dbs.dbObject.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	for i, stage := range stages {
+		if err := dbs.mergeStage(ctx, conn, stage); err != nil {
+			return fmt.Errorf("merge stage %v into %v: %v",
+				i, dbs.targetName, err)
+		}
+	}
+	return nil
+}
+
+func (dbs *DbSession) mergeStage(ctx context.Context, conn *sql.Conn,
+	stage *DbSession) error {
+	if _, err := conn.ExecContext(ctx, `attach database ? as stage`,
+		stage.targetName); err != nil {
+		return err
+	}
+	defer conn.ExecContext(ctx, `detach database stage`)
+
+	tables, err := stageTables(ctx, conn)
+	if err != nil {
+		return err
+	}
+	idxBase, vpIdBase := dbs.idx, dbs.vpIds.Current()
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	for _, table := range tables {
+		if untaggedTables[table] {
+			continue
+		}
+		cols, err := stageColumns(ctx, tx, table)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+		var exprs []string
+		for _, col := range cols {
+			switch col {
+			case "idx", "src_idx", "dst_idx":
+				exprs = append(exprs, fmt.Sprintf("%v + %d", col, idxBase))
+			case "vp_id":
+				exprs = append(exprs, fmt.Sprintf("vp_id + %d", vpIdBase))
+			default:
+				exprs = append(exprs, col)
+			}
+		}
+		if _, err := tx.ExecContext(ctx, fmt.Sprintf(
+			`insert into main.%v(%v) select %v from stage.%v order by rowid`,
+			table, strings.Join(cols, ", "),
+			strings.Join(exprs, ", "), table)); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	dbs.idx += stage.idx
+	dbs.vpIds.ContinueAfter(vpIdBase + stage.vpIds.Current())
+	dbs.itemStat.add(stage.itemStat)
+	log.Printf("# stage %v merged into %v", stage.targetName, dbs.targetName)
+	return nil
+}
+
+func stageTables(ctx context.Context, conn *sql.Conn) ([]string, error) {
+	rows, err := conn.QueryContext(ctx, `select name from stage.sqlite_master
+		where type = 'table' order by name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var rv []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		rv = append(rv, name)
+	}
+	return rv, rows.Err()
+}
+
+func stageColumns(ctx context.Context, tx *sql.Tx, table string) ([]string, error) {
+	rows, err := tx.QueryContext(ctx, fmt.Sprintf(
+		`select name from pragma_table_info('%v', 'stage')`, table))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var rv []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		rv = append(rv, name)
+	}
+	sort.Strings(rv)
+	return rv, rows.Err()
+}
+
+func (item *ItemStat) add(rhs ItemStat) {
+	item.dtuOpCount += rhs.dtuOpCount
+	item.taskActCount += rhs.taskActCount
+	item.fwOpCount += rhs.fwOpCount
+	item.dmaOpCount += rhs.dmaOpCount
+	item.kernelOpCount += rhs.kernelOpCount
+	item.cmdInfoCount += rhs.cmdInfoCount
+	item.verInfoCount += rhs.verInfoCount
+	item.platformCount += rhs.platformCount
+	item.cpuOpCount += rhs.cpuOpCount
+	item.opCovCount += rhs.opCovCount
+	item.critStepCount += rhs.critStepCount
+	item.critPathCount += rhs.critPathCount
+	item.engUtilCount += rhs.engUtilCount
+	item.pgUtilCount += rhs.pgUtilCount
+	item.assertCount += rhs.assertCount
+	item.assertMarks += rhs.assertMarks
+	item.provenanceCount += rhs.provenanceCount
+	item.flowCount += rhs.flowCount
+	item.counterCount += rhs.counterCount
+}
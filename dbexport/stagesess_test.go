@@ -0,0 +1,124 @@
+package dbexport
+
+import (
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"git.enflame.cn/hai.bai/dmaster/rtinfo"
+	"git.enflame.cn/hai.bai/dmaster/rtinfo/rtdata"
+	"git.enflame.cn/hai.bai/dmaster/topsdev/mimic/mimicdefs"
+)
+
+const stageDeviceCount = 3
+
+func dumpStageDevice(dbs *DbSession, dev int) {
+	coords := rtdata.Coords{DeviceID: dev}
+	dbs.DumpHostInfo(mimicdefs.HostInfo{
+		CommandInfo:  mimicdefs.CommandInfo{Command: fmt.Sprint("dev", dev)},
+		PlatformInfo: []mimicdefs.PlatformInfo{{Product: "i20"}},
+	})
+	cpuOps := []rtdata.CpuOpAct{
+		{Cat: "CPU Op", Name: "a", StartTimestamp: 10, EndTimestamp: 20},
+		{Cat: "CPU Op", Name: "b", StartTimestamp: 30, EndTimestamp: 40},
+	}
+	dbs.DumpCpuOpTrace(coords, cpuOps, "CPU Op")
+	var report rtinfo.OpCoverageReport
+	for i := 0; i <= dev; i++ {
+		report.Tasks = append(report.Tasks, rtinfo.TaskOpCoverage{TaskID: i})
+	}
+	dbs.DumpOpCoverage(coords, report)
+	dbs.DumpCpuOpTrace(coords, cpuOps[:1], "CPU Op")
+}
+
+// All the rows of the vpd but the times of creation
+func snapshotVpd(t *testing.T, target string) string {
+	db, err := sql.Open("sqlite3", target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	tables, err := listTables(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sb strings.Builder
+	for _, table := range tables {
+		query := fmt.Sprintf(`select * from %v order by rowid`, table)
+		switch table {
+		case "capture":
+			query = `select capture_id, source, idx_begin, idx_end,
+				vp_id_begin, vp_id_end from capture`
+		case "schema_version":
+			query = `select version, description from schema_version`
+		}
+		rows, err := db.Query(query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cols, _ := rows.Columns()
+		for rows.Next() {
+			vals := make([]interface{}, len(cols))
+			ptrs := make([]interface{}, len(cols))
+			for i := range vals {
+				ptrs[i] = &vals[i]
+			}
+			if err := rows.Scan(ptrs...); err != nil {
+				t.Fatal(err)
+			}
+			fmt.Fprintf(&sb, "%v: %v\n", table, vals)
+		}
+		rows.Close()
+	}
+	return sb.String()
+}
+
+func TestStagesMatchSequential(t *testing.T) {
+	dir := t.TempDir()
+	opt := DbSessionOpt{Source: "capture"}
+
+	seqTarget := filepath.Join(dir, "seq.vpd")
+	dbs, err := OpenDbSession(seqTarget, opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for dev := 0; dev < stageDeviceCount; dev++ {
+		dumpStageDevice(dbs, dev)
+	}
+	dbs.Close()
+
+	parTarget := filepath.Join(dir, "par.vpd")
+	dbs, err = OpenDbSession(parTarget, opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stages, err := dbs.OpenStages(stageDeviceCount)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	for dev, stage := range stages {
+		wg.Add(1)
+		go func(dev int, stage *DbSession) {
+			defer wg.Done()
+			dumpStageDevice(stage, dev)
+		}(dev, stage)
+	}
+	wg.Wait()
+	if err := dbs.MergeStages(stages); err != nil {
+		t.Fatal(err)
+	}
+	dbs.Close()
+
+	seq, par := snapshotVpd(t, seqTarget), snapshotVpd(t, parTarget)
+	if seq != par {
+		t.Errorf("expecting the same as sequential:\n%v\ngot:\n%v", seq, par)
+	}
+	// Coverage rows take an idx each, CPU ops a vp id each
+	if !strings.Contains(seq, "capture: [0 capture 0 5 1 9]") {
+		t.Errorf("expecting idx 0 to 5 and vp ids 1 to 9 in capture 0:\n%v", seq)
+	}
+}
@@ -0,0 +1,31 @@
+package dbexport
+
+import "git.enflame.cn/hai.bai/dmaster/rtinfo/rtdata"
+
+// Host process for the CPU ops, devices are numbered from 1
+const traceHostPid = 1 << 20
+
+func traceDevicePid(coords rtdata.Coords) int {
+	return coords.NodeID*1000 + coords.DeviceID + 1
+}
+
+// traceLanes spreads overlapped slices of one row onto lanes,
+// since slices on a track or thread must nest.
+// Key to the end time of each lane
+type traceLanes map[string][]uint64
+
+// The first lane free at the start time, slices must come in start order
+func (l traceLanes) alloc(key string, start, end uint64) int {
+	lanes := l[key]
+	lane := 0
+	for lane < len(lanes) && lanes[lane] > start {
+		lane++
+	}
+	if lane == len(lanes) {
+		lanes = append(lanes, end)
+	} else {
+		lanes[lane] = end
+	}
+	l[key] = lanes
+	return lane
+}
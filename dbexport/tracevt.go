@@ -1,239 +1,611 @@
 package dbexport
 
 import (
+	"bufio"
 	"encoding/json"
 	"fmt"
 	"log"
 	"os"
 	"sort"
 
+	"git.enflame.cn/hai.bai/dmaster/codec"
 	"git.enflame.cn/hai.bai/dmaster/rtinfo"
 	"git.enflame.cn/hai.bai/dmaster/rtinfo/rtdata"
+	"git.enflame.cn/hai.bai/dmaster/topsdev/mimic/mimicdefs"
 )
 
 /*
-[ {"name": "出方案", "ph": "B", "pid": "Main", "tid": "工作", "ts": 0},
-  {"name": "出方案", "ph": "E", "pid": "Main", "tid": "工作", "ts": 28800000000},
-  {"name": "看电影", "ph": "B", "pid": "Main", "tid": "休闲", "ts": 28800000000},
-  {"name": "看电影", "ph": "E", "pid": "Main", "tid": "休闲", "ts": 32400000000},
-  {"name": "写代码", "ph": "B", "pid": "Main", "tid": "工作", "ts": 32400000000},
-  {"name": "写代码", "ph": "E", "pid": "Main", "tid": "工作", "ts": 36000000000},
-  {"name": "遛狗", "ph": "B", "pid": "Main", "tid": "休闲", "ts": 36000000000},
-  {"name": "遛狗", "ph": "E", "pid": "Main", "tid": "休闲", "ts": 37800000000}
+{"traceEvents": [
+  {"name": "process_name", "ph": "M", "pid": 1, "tid": 0, "args": {"name": "Node 0 Device 0"}},
+  {"name": "thread_name", "ph": "M", "pid": 1, "tid": 1, "args": {"name": "CQM 0.0"}},
+  {"name": "Conv.3", "cat": "dtu_op", "ph": "X", "pid": 1, "tid": 1, "ts": 10.5, "dur": 2.25,
+   "args": {"op_id": 3, "packet_id": 17, "exec_uuid": "0x...", "start_cycle": 100, "end_cycle": 400}}
+],
+"displayTimeUnit": "ns"}
 */
 
 type TraceEvent struct {
-	Name string  `json:"name"`
-	Ph   string  `json:"ph"`
-	Pid  string  `json:"pid"`
-	Tid  string  `json:"tid"`
-	Ts   float64 `json:"ts"`
+	Name  string                 `json:"name"`
+	Cat   string                 `json:"cat,omitempty"`
+	Ph    string                 `json:"ph"`
+	Pid   int                    `json:"pid"`
+	Tid   int                    `json:"tid"`
+	Ts    float64                `json:"ts"`
+	Dur   float64                `json:"dur,omitempty"`
+	Scope string                 `json:"s,omitempty"`  // instant events only
+	Id    string                 `json:"id,omitempty"` // flow events only
+	Bp    string                 `json:"bp,omitempty"`
+	Args  map[string]interface{} `json:"args,omitempty"`
 }
 
-type TraceEvents []TraceEvent
+// Host time is in ns, trace time is in us
+func toUs(hosttime uint64) float64 {
+	return float64(hosttime) / 1000
+}
 
-func (t TraceEvents) Len() int {
-	return len(t)
+type traceSlice struct {
+	thread string
+	name   string
+	start  uint64 // host ns
+	end    uint64
+	args   map[string]interface{}
+	flow   *rtinfo.FlowNode // if it may be an end of a link
 }
 
-func (t TraceEvents) Swap(i, j int) {
-	t[i], t[j] = t[j], t[i]
+// Where a slice of a link end is, the flow events bind to it
+type traceFlowSpot struct {
+	pid, tid int
+	ts       float64
 }
 
-func (t TraceEvents) Less(i, j int) bool {
-	return t[i].Ts < t[j].Ts
+type EventTraceItemGen interface {
+	GetPidAndName(rtdata.OpActivity) (bool, string, string, string)
 }
 
-func toMs(hosttime uint64) float64 {
-	return float64(hosttime) / (1000)
+// TraceEventSession streams the Chrome Trace Event format(JSON) into the
+// target file, events are written as soon as they are dumped.
+// Devices are processes and engines are threads, each named by a
+// metadata event on first use.
+type TraceEventSession struct {
+	targetName string
+	fout       *os.File
+	w          *bufio.Writer
+	enc        *json.Encoder
+
+	namedPids map[int]bool
+	tids      map[int]map[string]int // pid to thread name to tid
+	lanes     traceLanes
+
+	flows     *flowEnds // of the device being dumped
+	flowSpots []traceFlowSpot
+	// Host cpu ops are the same for all the devices, taken only once
+	cpuOpsDumped bool
+
+	eventCount int
 }
 
-func NewTraceEventBegin(
-	pid string,
-	tid string,
-	name string,
-	ts uint64,
-) TraceEvent {
-	return TraceEvent{
-		Ph:   "B",
-		Ts:   toMs(ts),
-		Pid:  pid,
-		Tid:  tid,
-		Name: name,
+func NewTraceEventSession(targetName string) (*TraceEventSession, error) {
+	fout, err := os.Create(targetName)
+	if err != nil {
+		return nil, err
+	}
+	tr := &TraceEventSession{
+		targetName: targetName,
+		fout:       fout,
+		w:          bufio.NewWriter(fout),
+		namedPids:  make(map[int]bool),
+		tids:       make(map[int]map[string]int),
+		lanes:      make(traceLanes),
+	}
+	tr.enc = json.NewEncoder(tr.w)
+	tr.w.WriteString("{\"traceEvents\": [\n")
+	return tr, nil
+}
+
+func (tr *TraceEventSession) Close() {
+	tr.flushFlows()
+	tr.w.WriteString("],\n\"displayTimeUnit\": \"ns\"}\n")
+	if err := tr.w.Flush(); err != nil {
+		log.Printf("error write %v: %v", tr.targetName, err)
 	}
+	tr.fout.Close()
+	log.Printf("# %v event(s) have been traced into %v",
+		tr.eventCount, tr.targetName)
 }
 
-func NewTraceEventEnd(
-	pid string,
-	tid string,
-	name string,
-	ts uint64,
-) TraceEvent {
-	return TraceEvent{
-		Ph:   "E",
-		Ts:   toMs(ts),
+func (tr *TraceEventSession) writeEvent(evt TraceEvent) {
+	if tr.eventCount > 0 {
+		tr.w.WriteString(",")
+	}
+	// Encode appends the newline, one event per line
+	if err := tr.enc.Encode(evt); err != nil {
+		log.Printf("error encode trace event: %v", err)
+	}
+	tr.eventCount++
+}
+
+func (tr *TraceEventSession) process(pid int, name string) int {
+	if !tr.namedPids[pid] {
+		tr.namedPids[pid] = true
+		tr.writeEvent(TraceEvent{
+			Name: "process_name",
+			Ph:   "M",
+			Pid:  pid,
+			Args: map[string]interface{}{"name": name},
+		})
+	}
+	return pid
+}
+
+func (tr *TraceEventSession) device(coords rtdata.Coords) int {
+	return tr.process(traceDevicePid(coords),
+		fmt.Sprintf("Node %v Device %v", coords.NodeID, coords.DeviceID))
+}
+
+// Threads are numbered from 1 in order of first use within the process
+func (tr *TraceEventSession) thread(pid int, name string) int {
+	threads, ok := tr.tids[pid]
+	if !ok {
+		threads = make(map[string]int)
+		tr.tids[pid] = threads
+	}
+	if tid, ok := threads[name]; ok {
+		return tid
+	}
+	tid := len(threads) + 1
+	threads[name] = tid
+	tr.writeEvent(TraceEvent{
+		Name: "thread_name",
+		Ph:   "M",
 		Pid:  pid,
 		Tid:  tid,
-		Name: name,
+		Args: map[string]interface{}{"name": name},
+	})
+	return tid
+}
+
+func (tr *TraceEventSession) laneThread(pid int, name string,
+	start, end uint64) int {
+	lane := tr.lanes.alloc(fmt.Sprintf("%v/%v", pid, name), start, end)
+	if lane == 0 {
+		return tr.thread(pid, name)
 	}
+	return tr.thread(pid, fmt.Sprintf("%v #%v", name, lane+1))
 }
 
-func NewTraceEventStartUnk(ts uint64,
-	sub string,
-	name string,
-) TraceEvent {
-	return TraceEvent{
-		Ph:   "B",
-		Ts:   toMs(ts),
-		Pid:  name,
-		Tid:  name,
-		Name: sub,
+func (tr *TraceEventSession) emitSlices(pid int, category string,
+	slices []traceSlice) {
+	sort.SliceStable(slices, func(i, j int) bool {
+		return slices[i].start < slices[j].start
+	})
+	for _, s := range slices {
+		evt := TraceEvent{
+			Name: s.name,
+			Cat:  category,
+			Ph:   "X",
+			Pid:  pid,
+			Tid:  tr.laneThread(pid, s.thread, s.start, s.end),
+			Ts:   toUs(s.start),
+			Args: s.args,
+		}
+		if s.end > s.start {
+			evt.Dur = toUs(s.end - s.start)
+		} else {
+			evt.Ph, evt.Scope = "i", "t"
+		}
+		tr.writeEvent(evt)
+		if s.flow != nil && tr.flows != nil {
+			tr.flows.claim(*s.flow, len(tr.flowSpots))
+			tr.flowSpots = append(tr.flowSpots,
+				traceFlowSpot{evt.Pid, evt.Tid, evt.Ts})
+		}
 	}
 }
 
-func NewTraceEventEndUnk(ts uint64,
-	sub string,
-	name string,
-) TraceEvent {
-	return TraceEvent{
-		Ph:   "E",
-		Ts:   toMs(ts),
-		Pid:  name,
-		Tid:  name,
-		Name: sub,
+// DumpFlows comes before the activities of the device, the flow events
+// are written once the slices are, by the next DumpFlows or Close
+func (tr *TraceEventSession) DumpFlows(
+	coords rtdata.Coords,
+	links []rtinfo.FlowLink,
+) {
+	tr.flushFlows()
+	tr.flows = newFlowEnds(coords, links)
+}
+
+func (tr *TraceEventSession) flushFlows() {
+	if tr.flows == nil {
+		return
 	}
+	coords := tr.flows.coords
+	linkIdx := 0
+	tr.flows.resolved(func(link rtinfo.FlowLink, src, dst int) {
+		id := fmt.Sprintf("%v.%v.%v", coords.NodeID, coords.DeviceID, linkIdx)
+		linkIdx++
+		from, to := tr.flowSpots[src], tr.flowSpots[dst]
+		tr.writeEvent(TraceEvent{
+			Name: string(link.Kind), Cat: "flow", Ph: "s",
+			Pid: from.pid, Tid: from.tid, Ts: from.ts, Id: id,
+		})
+		tr.writeEvent(TraceEvent{
+			Name: string(link.Kind), Cat: "flow", Ph: "f", Bp: "e",
+			Pid: to.pid, Tid: to.tid, Ts: to.ts, Id: id,
+		})
+	})
+	tr.flows, tr.flowSpots = nil, nil
 }
 
-type TraceEventSession struct {
-	eventVec []TraceEvent
+func flowNodeOf(kind rtinfo.FlowNodeKind, act rtdata.DpfAct) *rtinfo.FlowNode {
+	node := rtinfo.NewFlowNode(kind, act)
+	return &node
 }
 
-func (tr *TraceEventSession) appendEvt(evt TraceEvent) {
-	tr.eventVec = append(tr.eventVec, evt)
+// Host info has no place on the timeline
+func (tr *TraceEventSession) DumpHostInfo(hostInfo mimicdefs.HostInfo) {}
+
+func (tr *TraceEventSession) DumpDtuOps(
+	coords rtdata.Coords,
+	bundle []rtdata.OpActivity,
+	tm *rtinfo.TimelineManager,
+) {
+	var slices []traceSlice
+	convertToHostError := 0
+	for _, act := range bundle {
+		if !act.IsOpRefValid() {
+			continue
+		}
+		span, ok := mapHostSpan(tm, act.StartCycle(), act.EndCycle())
+		if !ok {
+			convertToHostError++
+			continue
+		}
+		op, task := act.GetOp(), act.GetTask()
+		slices = append(slices, traceSlice{
+			thread: engineTrackName(act.Start, act.Start.EngineIndex),
+			name:   fmt.Sprintf("%v.%v", op.OpName, op.OpId),
+			start:  span.start,
+			end:    span.end,
+			args: map[string]interface{}{
+				"op_id":       op.OpId,
+				"task_id":     task.TaskID,
+				"exec_uuid":   fmt.Sprintf("0x%016x", task.ExecutableUUID),
+				"packet_id":   act.Start.PacketID,
+				"start_cycle": act.StartCycle(),
+				"end_cycle":   act.EndCycle(),
+				"cycles":      act.EndCycle() - act.StartCycle(),
+			},
+			flow: flowNodeOf(rtinfo.FlowNode_Op, act.DpfAct),
+		})
+	}
+	if convertToHostError > 0 {
+		log.Printf("convert-to-hosttime-error count: %v", convertToHostError)
+	}
+	tr.emitSlices(tr.device(coords), "dtu_op", slices)
 }
 
-type EventTraceItemGen interface {
-	GetPidAndName(rtdata.OpActivity) (bool, string, string, string)
+// DumpWildOps puts the ops named by the generator onto their own rows,
+// the pid of the generator becomes the prefix of the row.
+func (tr *TraceEventSession) DumpWildOps(
+	coords rtdata.Coords,
+	bundle []rtdata.OpActivity,
+	tm *rtinfo.TimelineManager,
+	evtG EventTraceItemGen,
+) {
+	var slices []traceSlice
+	for _, act := range bundle {
+		okToShow, pid, tid, name := evtG.GetPidAndName(act)
+		if !okToShow {
+			continue
+		}
+		span, ok := mapHostSpan(tm, act.StartCycle(), act.EndCycle())
+		if !ok {
+			continue
+		}
+		slices = append(slices, traceSlice{
+			thread: pid + " " + tid,
+			name:   name,
+			start:  span.start,
+			end:    span.end,
+			args: map[string]interface{}{
+				"packet_id":   act.Start.PacketID,
+				"start_cycle": act.StartCycle(),
+				"end_cycle":   act.EndCycle(),
+				"cycles":      act.EndCycle() - act.StartCycle(),
+			},
+		})
+	}
+	tr.emitSlices(tr.device(coords), "wild_op", slices)
 }
 
 func (tr *TraceEventSession) DumpTaskVec(
-	taskMap map[int]rtdata.FwActivity,
-	taskOrderVec []rtdata.OrderTask,
+	coords rtdata.Coords,
+	taskVec []rtdata.OrderTask,
+	taskActMap map[int]rtdata.FwActivity,
 	tm *rtinfo.TimelineManager,
 ) {
-	const pid = "Task Distribution"
-	for _, task := range taskOrderVec {
-		if !task.IsValid() {
+	var slices []traceSlice
+	for _, oTask := range taskVec {
+		if !oTask.IsValid() {
 			continue
 		}
-		fwAct, ok := taskMap[task.GetTaskID()]
+		fwAct, ok := taskActMap[oTask.GetTaskID()]
 		if !ok {
 			continue
 		}
-		startHostTime, startOK := tm.MapToHosttime(fwAct.StartCycle())
-		endHostTime, endOK := tm.MapToHosttime(fwAct.EndCycle())
-		if !startOK || !endOK {
+		span, ok := mapHostSpan(tm, fwAct.StartCycle(), fwAct.EndCycle())
+		if !ok {
 			continue
 		}
-
-		// OK, all conditions met
-		tid := fmt.Sprintf("PG %06b", task.GetRefToTask().PgMask)
+		task := oTask.GetRefToTask()
 		name := fmt.Sprintf("Task.%v 0x%s",
-			task.GetTaskID(),
-			fmt.Sprintf("%016x", task.GetExecUuid())[:8])
+			task.TaskID,
+			fmt.Sprintf("%016x", task.ExecutableUUID)[:8])
 		if fwAct.End.Event < 0 {
 			name += "  ->..."
 		}
-		tr.appendEvt(NewTraceEventBegin(
-			pid,
-			tid,
-			name,
-			startHostTime,
-		))
-		tr.appendEvt(NewTraceEventEnd(
-			pid,
-			tid,
-			name,
-			endHostTime,
-		))
+		slices = append(slices, traceSlice{
+			thread: fmt.Sprintf("PG %06b", task.PgMask),
+			name:   name,
+			start:  span.start,
+			end:    span.end,
+			args: map[string]interface{}{
+				"task_id":     task.TaskID,
+				"exec_uuid":   fmt.Sprintf("0x%016x", task.ExecutableUUID),
+				"pg_mask":     task.PgMask,
+				"start_cycle": fwAct.StartCycle(),
+				"end_cycle":   fwAct.EndCycle(),
+				"cycles":      fwAct.EndCycle() - fwAct.StartCycle(),
+			},
+		})
 	}
+	tr.emitSlices(tr.device(coords), "task", slices)
 }
 
-func (tr *TraceEventSession) DumpToEventTrace(
-	bundle []rtdata.OpActivity,
+func (tr *TraceEventSession) DumpFwActs(
+	coords rtdata.Coords,
+	bundle []rtdata.FwActivity,
+	taskActMap map[int]rtdata.FwActivity,
 	tm *rtinfo.TimelineManager,
-	evtG EventTraceItemGen,
-	dumpWild bool,
 ) {
-	rtdata.CheckTimespanOverlapping(bundle)
-
-	var dtuOpCount = 0
-	var convertToHostError = 0
+	taskIdHashMap := make(map[uint64]int)
+	for taskId, act := range taskActMap {
+		taskIdHashMap[act.GetHashCode()] = taskId
+	}
+	var slices []traceSlice
+	for _, act := range bundle {
+		span, ok := mapHostSpan(tm, act.StartCycle(), act.EndCycle())
+		if !ok {
+			continue
+		}
+		var name string
+		switch act.Start.EngineTypeCode {
+		case codec.EngCat_TS:
+			name, _ = rtdata.ToTSEventString(act.Start.Event)
+		case codec.EngCat_CQM, codec.EngCat_GSYNC:
+			name, _ = rtdata.ToCQMEventString(act.Start.Event)
+		default:
+			name = fmt.Sprintf("Engine(%s)", act.Start.EngineTypeCode)
+		}
+		s := traceSlice{
+			thread: "FW " + engineTrackName(act.Start, act.Start.EngineIndex),
+			name:   name,
+			start:  span.start,
+			end:    span.end,
+			args: map[string]interface{}{
+				"packet_id":   act.Start.PacketID,
+				"start_cycle": act.StartCycle(),
+				"end_cycle":   act.EndCycle(),
+				"cycles":      act.EndCycle() - act.StartCycle(),
+			},
+		}
+		if act.Start.EngineTypeCode == codec.EngCat_CQM &&
+			act.Start.Event == codec.CqmExecutableStart {
+			if taskId, ok := taskIdHashMap[act.GetHashCode()]; ok {
+				s.name = fmt.Sprintf("Task.%v", taskId)
+				s.args["task_id"] = taskId
+			}
+		}
+		if kind, ok := rtinfo.FwFlowNodeKind(act); ok {
+			s.flow = flowNodeOf(kind, act.DpfAct)
+		}
+		slices = append(slices, s)
+	}
+	tr.emitSlices(tr.device(coords), "fw", slices)
+}
 
-	subSampleCount := 0
+func (tr *TraceEventSession) DumpDmaActs(
+	coords rtdata.Coords,
+	bundle []rtdata.CookedDmaActivity,
+	tm *rtinfo.TimelineManager,
+) {
+	var slices []traceSlice
 	for _, act := range bundle {
-		if okToShow, pid, tid, name := evtG.GetPidAndName(act); okToShow {
-			dtuOpCount++
-			startHostTime, startOK := tm.MapToHosttime(act.StartCycle())
-			endHostTime, endOK := tm.MapToHosttime(act.EndCycle())
-			if startOK && endOK {
-				tr.appendEvt(NewTraceEventBegin(
-					pid,
-					tid,
-					name,
-					startHostTime,
-				))
-				tr.appendEvt(NewTraceEventEnd(
-					pid,
-					tid,
-					name,
-					endHostTime,
-				))
-			} else {
-				convertToHostError++
+		span, ok := mapHostSpan(tm, act.StartCycle(), act.EndCycle())
+		if !ok {
+			continue
+		}
+		name, _ := rtdata.ToDmaEventString(act.Start.Event)
+		s := traceSlice{
+			thread: engineTrackName(act.Start, act.GetEngineIndex()),
+			name:   name,
+			start:  span.start,
+			end:    span.end,
+			args: map[string]interface{}{
+				"packet_id":    act.Start.PacketID,
+				"vc":           act.GetVcId(),
+				"match_status": act.Status.String(),
+				"start_cycle":  act.StartCycle(),
+				"end_cycle":    act.EndCycle(),
+				"cycles":       act.EndCycle() - act.StartCycle(),
+			},
+		}
+		if act.IsDmaMetaRefValid() {
+			task := act.GetTask()
+			s.name = act.GetDmaMeta().DmaOpString
+			s.args["task_id"] = task.TaskID
+			s.args["exec_uuid"] = fmt.Sprintf("0x%016x", task.ExecutableUUID)
+		}
+		if act.OwnerOpValid {
+			s.args["op_id"] = act.OwnerOpId
+			s.args["op_name"] = act.OwnerOpName
+		}
+		s.flow = flowNodeOf(rtinfo.FlowNode_Dma, act.DpfAct)
+		slices = append(slices, s)
+	}
+	tr.emitSlices(tr.device(coords), "dma", slices)
+}
+
+// Counter events of a name make a track of the device process
+func (tr *TraceEventSession) DumpCounters(
+	coords rtdata.Coords,
+	tracks []rtinfo.CounterTrack,
+	tm *rtinfo.TimelineManager,
+) {
+	pid := tr.device(coords)
+	for _, track := range tracks {
+		for _, pt := range track.Points {
+			hosttime, ok := tm.MapToHosttime(pt.Cycle)
+			if !ok {
+				continue
 			}
-		} else {
-			subSampleCount++
-			if dumpWild {
-				startHostTime, startOK := tm.MapToHosttime(act.StartCycle())
-				endHostTime, endOK := tm.MapToHosttime(act.EndCycle())
-				if startOK && endOK && subSampleCount%30 == 0 {
-					tr.appendEvt(NewTraceEventStartUnk(startHostTime, pid, name))
-					tr.appendEvt(NewTraceEventEndUnk(endHostTime, pid, name))
-				}
+			tr.writeEvent(TraceEvent{
+				Name: track.Name,
+				Cat:  "counter",
+				Ph:   "C",
+				Pid:  pid,
+				Ts:   toUs(hosttime),
+				Args: map[string]interface{}{track.Unit: pt.Value},
+			})
+		}
+	}
+}
+
+func (tr *TraceEventSession) DumpKernelActs(
+	coords rtdata.Coords,
+	bundle []rtdata.KernelActivity,
+	tm *rtinfo.TimelineManager,
+	rowName string,
+) {
+	var slices []traceSlice
+	for _, act := range bundle {
+		span, ok := mapHostSpan(tm, act.StartCycle(), act.EndCycle())
+		if !ok {
+			continue
+		}
+		name, nameOK := act.GetSipOpName()
+		if !nameOK {
+			name = "SIP Act"
+		}
+		s := traceSlice{
+			thread: rowName + " " + engineTrackName(act.Start, act.GetEngineIndex()),
+			name:   name,
+			start:  span.start,
+			end:    span.end,
+			args: map[string]interface{}{
+				"start_cycle": act.StartCycle(),
+				"end_cycle":   act.EndCycle(),
+				"cycles":      act.EndCycle() - act.StartCycle(),
+			},
+		}
+		if rtInfo := act.RtInfo; rtInfo.SubValid {
+			s.args["task_id"] = rtInfo.TaskId
+			s.args["op_id"] = rtInfo.OpId
+			s.args["confidence"] = rtInfo.Confidence
+			s.args["attrib_reason"] = rtInfo.Reason.String()
+			if rtInfo.IsLowConfidence() {
+				s.name += " (?)"
 			}
 		}
+		s.flow = flowNodeOf(rtinfo.FlowNode_Kernel, act.DpfAct)
+		slices = append(slices, s)
 	}
-	if convertToHostError > 0 {
-		log.Printf("convert-to-hosttime-error count: %v", convertToHostError)
+	tr.emitSlices(tr.device(coords), "kernel", slices)
+}
+
+func (tr *TraceEventSession) DumpCpuOpTrace(
+	coords rtdata.Coords,
+	cpuOps []rtdata.CpuOpAct,
+	rowName string,
+) {
+	if tr.cpuOpsDumped {
+		return
+	}
+	tr.cpuOpsDumped = true
+	slices := make([]traceSlice, len(cpuOps))
+	for i, act := range cpuOps {
+		slices[i] = traceSlice{
+			thread: rowName + " " + act.Cat,
+			name:   act.Name,
+			start:  act.StartTimestamp,
+			end:    act.EndTimestamp,
+		}
 	}
+	tr.emitSlices(tr.process(traceHostPid, "Host"), "cpu_op", slices)
 }
 
-func (tr TraceEventSession) DumpToFile(out string) {
+// Coverage has no time, it stays in the vpd only
+func (tr *TraceEventSession) DumpOpCoverage(
+	coords rtdata.Coords,
+	coverage rtinfo.OpCoverageReport,
+) {
+}
 
-	sort.Sort(TraceEvents(tr.eventVec))
+func (tr *TraceEventSession) DumpCriticalPaths(
+	coords rtdata.Coords,
+	paths []rtinfo.TaskCriticalPath,
+	tm *rtinfo.TimelineManager,
+) {
+	var slices []traceSlice
+	for _, path := range paths {
+		for _, seg := range path.Segments {
+			span, ok := mapHostSpan(tm, seg.StartCycle, seg.EndCycle)
+			if !ok {
+				continue
+			}
+			slices = append(slices, traceSlice{
+				thread: CriticalPathRowName,
+				name:   fmt.Sprintf("%v: %v", seg.Kind, seg.Name),
+				start:  span.start,
+				end:    span.end,
+				args: map[string]interface{}{
+					"task_id": path.TaskID,
+					"op_id":   seg.OpId,
+					"cycles":  seg.Cycles(),
+				},
+			})
+		}
+	}
+	tr.emitSlices(tr.device(coords), "critical_path", slices)
+}
 
-	// const HourMes uint64 = 60 * 1000 * 1000
-	// const MinMes uint64 = 1000 * 1000
-	// for i := 0; i < len(eventVec); i += 2 {
-	// 	idx := i / 2
-	// 	eventVec[i].Ts = uint64(idx) * HourMes
-	// 	eventVec[i+1].Ts = uint64(idx+1)*HourMes - MinMes
-	// }
+// Utilization is a summary, it stays in the vpd only
+func (tr *TraceEventSession) DumpUtilization(
+	coords rtdata.Coords,
+	report rtinfo.UtilizationReport,
+	tm *rtinfo.TimelineManager,
+) {
+}
 
-	chunk, err := json.MarshalIndent(tr.eventVec, "", "  ")
-	if err != nil {
-		panic(err)
+func (tr *TraceEventSession) DumpKernelAsserts(
+	coords rtdata.Coords,
+	report rtinfo.KernelAssertReport,
+	tm *rtinfo.TimelineManager,
+) {
+	var slices []traceSlice
+	for _, a := range report.Asserts {
+		hostTime, ok := tm.MapToHosttime(a.Event.Cycle)
+		if !ok {
+			continue
+		}
+		slices = append(slices, traceSlice{
+			thread: KernelAssertRowName,
+			name:   "ASSERT " + a.Location(),
+			start:  hostTime,
+			end:    hostTime,
+			args: map[string]interface{}{
+				"context":  a.Context(),
+				"cause_id": a.CauseId,
+			},
+		})
 	}
-
-	fout, err := os.Create(out)
-	if err != nil {
-		panic(err)
-	}
-	defer fout.Close()
-	fout.Write(chunk)
-	log.Printf("%v dtuop(s) have been written to %v successfully\n",
-		len(tr.eventVec),
-		out,
-	)
+	tr.emitSlices(tr.device(coords), "kernel_assert", slices)
 }
@@ -0,0 +1,68 @@
+package dbexport
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"git.enflame.cn/hai.bai/dmaster/rtinfo/rtdata"
+)
+
+func TestTraceEventStreaming(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "foo.json")
+	tr, err := NewTraceEventSession(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cpuOps := []rtdata.CpuOpAct{
+		{Cat: "BACKEND", Name: "a", StartTimestamp: 0, EndTimestamp: 100000},
+		{Cat: "BACKEND", Name: "b", StartTimestamp: 50000, EndTimestamp: 80000},
+		{Cat: "BACKEND", Name: "c", StartTimestamp: 90000, EndTimestamp: 90000},
+	}
+	// Every device comes with the same host cpu ops
+	for dev := 0; dev < 3; dev++ {
+		tr.DumpCpuOpTrace(rtdata.Coords{DeviceID: dev}, cpuOps, "CPU Op")
+	}
+	tr.Close()
+
+	buf, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var trace struct {
+		TraceEvents []TraceEvent `json:"traceEvents"`
+	}
+	if err := json.Unmarshal(buf, &trace); err != nil {
+		t.Fatalf("malformed trace: %v", err)
+	}
+
+	threadNames := make(map[int]string)
+	var slices []TraceEvent
+	for _, evt := range trace.TraceEvents {
+		switch evt.Ph {
+		case "M":
+			if evt.Name == "thread_name" {
+				threadNames[evt.Tid] = evt.Args["name"].(string)
+			}
+		default:
+			slices = append(slices, evt)
+		}
+	}
+	if len(threadNames) != 2 {
+		t.Errorf("expecting 2 threads, got %v", threadNames)
+	}
+	if len(slices) != 3 {
+		t.Fatalf("expecting 3 slices, got %v", len(slices))
+	}
+	a, b, c := slices[0], slices[1], slices[2]
+	if a.Ph != "X" || a.Ts != 0 || a.Dur != 100 || a.Pid != traceHostPid {
+		t.Errorf("unexpected a: %+v", a)
+	}
+	if threadNames[b.Tid] != "CPU Op BACKEND #2" {
+		t.Errorf("expecting b on the second lane, got %v", threadNames[b.Tid])
+	}
+	if c.Ph != "i" || c.Ts != 90 {
+		t.Errorf("expecting c as instant, got %+v", c)
+	}
+}
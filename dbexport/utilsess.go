@@ -0,0 +1,108 @@
+package dbexport
+
+import (
+	"database/sql"
+
+	"git.enflame.cn/hai.bai/dmaster/assert"
+)
+
+const (
+	createEngineUtilTable = `
+	CREATE TABLE engine_utilization(idx INT,node_id INT,device_id INT,
+		engine_type TEXT,cluster_id INT,engine_index INT,vc_id INT,
+		pg_idx INT,act_count INT,busy_cycle INT,span_cycle INT,
+		utilization REAL);`
+	createPgUtilTable = `
+	CREATE TABLE pg_utilization(idx INT,node_id INT,device_id INT,
+		pg_idx INT,task_id INT,
+		start_timestamp INT,end_timestamp INT,
+		start_cycle INT,end_cycle INT,
+		sip_busy_cycle INT,dma_busy_cycle INT,cqm_busy_cycle INT,
+		idle_cycle INT,idle_gap_count INT,
+		idle_cqm_sleep_cycle INT,idle_wait_dma_cycle INT,
+		idle_wait_launch_cycle INT,idle_cqm_cycle INT,
+		utilization REAL);`
+)
+
+func init() {
+	RegisterTabInitCommand(createEngineUtilTable)
+	RegisterTabInitCommand(createPgUtilTable)
+}
+
+type EngineUtilSession struct {
+	TableSession
+}
+
+func NewEngineUtilSession(db *sql.DB) *EngineUtilSession {
+	return &EngineUtilSession{
+		TableSession: NewTableSession(db, `insert into engine_utilization(
+			idx, node_id, device_id,
+			engine_type, cluster_id, engine_index, vc_id,
+			pg_idx, act_count, busy_cycle, span_cycle,
+			utilization
+		) values(?, ?, ?,
+				 ?, ?, ?, ?,
+				 ?, ?, ?, ?,
+				 ?)`),
+	}
+}
+
+func (euS *EngineUtilSession) AddEngineUtil(idx, nodeID, devID int,
+	engineType string, clusterID, engineIndex, vcId int,
+	pgIdx, actCount int, busyCy, spanCy uint64,
+	utilization float64) {
+	_, err := euS.stmt.Exec(idx, nodeID, devID,
+		engineType, clusterID, engineIndex, vcId,
+		pgIdx, actCount, busyCy, spanCy,
+		utilization,
+	)
+	assert.Assert(err == nil, "Must be nil error: %v", err)
+}
+
+type PgUtilSession struct {
+	TableSession
+}
+
+func NewPgUtilSession(db *sql.DB) *PgUtilSession {
+	return &PgUtilSession{
+		TableSession: NewTableSession(db, `insert into pg_utilization(
+			idx, node_id, device_id,
+			pg_idx, task_id,
+			start_timestamp, end_timestamp,
+			start_cycle, end_cycle,
+			sip_busy_cycle, dma_busy_cycle, cqm_busy_cycle,
+			idle_cycle, idle_gap_count,
+			idle_cqm_sleep_cycle, idle_wait_dma_cycle,
+			idle_wait_launch_cycle, idle_cqm_cycle,
+			utilization
+		) values(?, ?, ?,
+				 ?, ?,
+				 ?, ?,
+				 ?, ?,
+				 ?, ?, ?,
+				 ?, ?,
+				 ?, ?,
+				 ?, ?,
+				 ?)`),
+	}
+}
+
+func (puS *PgUtilSession) AddPgUtil(idx, nodeID, devID int,
+	pgIdx, taskId int,
+	startTS, endTS uint64,
+	startCy, endCy uint64,
+	sipBusyCy, dmaBusyCy, cqmBusyCy uint64,
+	idleCy uint64, idleGapCount int,
+	sleepCy, waitDmaCy, waitLaunchCy, cqmCy uint64,
+	utilization float64) {
+	_, err := puS.stmt.Exec(idx, nodeID, devID,
+		pgIdx, taskId,
+		startTS, endTS,
+		startCy, endCy,
+		sipBusyCy, dmaBusyCy, cqmBusyCy,
+		idleCy, idleGapCount,
+		sleepCy, waitDmaCy, waitLaunchCy, cqmCy,
+		utilization,
+	)
+	assert.Assert(err == nil, "Must be nil error: %v", err)
+}
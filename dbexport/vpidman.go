@@ -2,10 +2,29 @@ package dbexport
 
 import "sync/atomic"
 
-var (
-	__vpid int32
-)
+// VpIdAllocator hands out the vp ids of one vpd, starting from 1.
+// Each DbSession has its own, so that sessions written concurrently
+// get the same ids as written one after another.
+type VpIdAllocator struct {
+	last int32
+}
+
+func (a *VpIdAllocator) Next() int {
+	return int(atomic.AddInt32(&a.last, 1))
+}
+
+func (a *VpIdAllocator) Current() int {
+	return int(atomic.LoadInt32(&a.last))
+}
 
-func GetNextVpId() int {
-	return int(atomic.AddInt32(&__vpid, 1))
+// ContinueAfter makes the next vp id greater than last,
+// for appending onto a vpd already with vp ids
+func (a *VpIdAllocator) ContinueAfter(last int) {
+	for {
+		cur := atomic.LoadInt32(&a.last)
+		if int(cur) >= last ||
+			atomic.CompareAndSwapInt32(&a.last, cur, int32(last)) {
+			return
+		}
+	}
 }
@@ -15,6 +15,7 @@ import (
 	"git.enflame.cn/hai.bai/dmaster/dbexport"
 	"git.enflame.cn/hai.bai/dmaster/efintf"
 	"git.enflame.cn/hai.bai/dmaster/inspector"
+	"git.enflame.cn/hai.bai/dmaster/rtinfo"
 	"git.enflame.cn/hai.bai/dmaster/rtinfo/archdetect"
 	"git.enflame.cn/hai.bai/dmaster/rtinfo/infoloader"
 	"git.enflame.cn/hai.bai/dmaster/rtinfo/rtdata"
@@ -40,6 +41,7 @@ var (
 	fRawDpf = flag.Bool("rawdpf", false, "raw dpf buffer content from file")
 
 	fEnableExTime = flag.Bool("extimeline", false, "enable extended timeline")
+	fTimelineMap  = flag.String("tlmap", "offset", "timeline mapping: offset, piecewise or linfit")
 	fWithoutDma   = flag.Bool("nodma", false, "disable dma event parsing")
 	fWithoutSip   = flag.Bool("nosip", false, "disable sip event parsing")
 	fJob          = flag.Int("job", 7, "jobs to go concurrent")
@@ -67,6 +69,48 @@ var (
 	fDumpOpDebug = flag.Bool("dumpopdebug", false, "dump op cycle info for debug")
 
 	fPgMaskEncoded = flag.Bool("pgmtsk", false, "pgmask is encoded in payload of task act")
+
+	// Not defined by any firmware header here, set it to the firmware's
+	fAssertEvent = flag.Int("assertevt", codec.SipEventKernelAssert, "event id of the kernel assert SIP events")
+
+	// Multi-device: shift every device onto the shared host timeline,
+	// the timestamps dumped are changed, so it is off unless asked
+	fDevAlign = flag.Bool("devalign", false, "shift multiple devices by their measured bias onto the shared host timeline")
+
+	// A/B comparison of vpd files, the first one is the base
+	fAbCompare = flag.Bool("ab", false, "compare vpd runs to the first one, exit 1 on failure")
+	fAbOpPct   = flag.Float64("abop", 5, "op slower than this percentage fails A/B")
+	fAbOpMinNs = flag.Uint64("abopns", 1000, "op slower by less than this ns never fails A/B")
+	fAbTaskPct = flag.Float64("abtask", 5, "task slower than this percentage fails A/B")
+	fAbDmaPct  = flag.Float64("abdma", 0, "DMA count change over this percentage fails A/B")
+	fAbMissing = flag.Int("abmiss", 0, "missing ops allowed in A/B, negative to skip")
+	fAbNew     = flag.Int("abnew", -1, "new ops allowed in A/B, negative to skip")
+
+	// Table comparison of vpd files, the default without -ab. It exits 1
+	// on differences over tolerance, 2 on error, where the DMA VC report
+	// before it always exited 0. That report is now
+	// -cmptables memcpy -cmpkey engine,tiling_mode,packet_id -cmpname 'DMA VC%'
+	fCmpKey    = flag.String("cmpkey", "name", "key to group the rows by: name, op_id, packet_id, engine, tiling_mode, comma separated")
+	fCmpTables = flag.String("cmptables", "dtu_op,fw,kernel,memcpy,tasks", "tables to compare, comma separated")
+	fCmpCount  = flag.Float64("cmpcount", 0, "row count change of a group over this percentage differs")
+	fCmpDur    = flag.Float64("cmpdur", 5, "total duration change of a group over this percentage differs")
+	fCmpDurNs  = flag.Uint64("cmpdurns", 1000, "total duration change of less than this ns never differs")
+	fCmpName   = flag.String("cmpname", "", "only compare the rows of name LIKE this, such as 'DMA VC%'")
+	fCmpJson   = flag.Bool("cmpjson", false, "write the comparison as JSON")
+
+	// Outputs other than the vpd
+	fPerfetto  = flag.String("perfetto", "", "also write a Perfetto protobuf trace to the path")
+	fChrome    = flag.String("chrome", "dtuop_trace.json", "also write a Chrome trace(JSON) to the path, none if empty")
+	fCsvDir    = flag.String("csv", "", "also write one CSV per table into the directory")
+	fTsv       = flag.Bool("tsv", false, "tab separated instead of CSV, with -csv")
+	fNoVpd     = flag.Bool("novpd", false, "skip the vpd, only with other outputs")
+	fReportDir = flag.String("reportdir", "", "also write the text reports of analysis into the directory")
+	fDbSeq     = flag.Bool("dbseq", false, "write the devices into the vpd one after another instead of concurrently")
+
+	// Merging captures into one vpd
+	fOutVpd  = flag.String("o", "", "the vpd to write, named after the first input if empty")
+	fAppend  = flag.Bool("append", false, "append to the vpd as a new capture instead of overwriting")
+	fCapture = flag.String("capture", "", "source name of the capture, the first input if empty")
 )
 
 // package
@@ -78,6 +122,7 @@ var (
 func init() {
 	flag.Parse()
 	log.SetFlags(log.Lshortfile)
+	codec.SetKernelAssertEvent(*fAssertEvent)
 
 	// Override
 	if *fDoradoRun && *fPavoRun {
@@ -92,6 +137,11 @@ func init() {
 		*fDump = true
 	}
 
+	if _, err := rtinfo.ParseTimelineMapMode(*fTimelineMap); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+
 	switch *fArch {
 	case "auto":
 	case "pavo":
@@ -140,6 +190,7 @@ func DoProcess(jobCount int, sess *sess.SessBroadcaster,
 	durationTime := endTime.Sub(startTime)
 	log.Printf("dispatching cost %v", durationTime)
 	processer.DoPostProcessing()
+	processer.decodeStat = sess.GetDecodeStat()
 	return processer
 }
 
@@ -147,10 +198,70 @@ func getOutputName(a string) string {
 	return filepath.Base(a) + ".vpd"
 }
 
+// dmaster migrate a.vpd b.vpd ...
+func migrateMain(files []string) {
+	if len(files) == 0 {
+		log.Fatalf("no vpd to migrate")
+	}
+	failed := false
+	for _, f := range files {
+		from, to, err := dbexport.MigrateVpd(f)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v: %v\n", f, err)
+			failed = true
+			continue
+		}
+		if from == to {
+			fmt.Printf("%v: already at schema version %v\n", f, to)
+		} else {
+			fmt.Printf("%v: migrated from schema version %v to %v\n", f, from, to)
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
 func main() {
 
+	if len(flag.Args()) > 0 && flag.Args()[0] == "migrate" {
+		migrateMain(flag.Args()[1:])
+		return
+	}
+	if len(flag.Args()) > 0 && flag.Args()[0] == "query" {
+		queryMain(flag.Args()[1:])
+		return
+	}
+
 	if len(flag.Args()) > 0 && strings.HasSuffix(flag.Args()[0], ".vpd") {
-		inspector.InspectMain(flag.Args(), os.Stdout)
+		if *fAbCompare {
+			th := inspector.DefaultABThreshold()
+			th.OpDeltaPct, th.OpDeltaMinNs = *fAbOpPct, *fAbOpMinNs
+			th.TaskDeltaPct, th.DmaDeltaPct = *fAbTaskPct, *fAbDmaPct
+			th.MaxMissingOps, th.MaxNewOps = *fAbMissing, *fAbNew
+			pass, err := inspector.CompareMain(flag.Args(), th, os.Stdout)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%v\n", err)
+				os.Exit(2)
+			}
+			if !pass {
+				os.Exit(1)
+			}
+			return
+		}
+		opt := inspector.DefaultInspectOpt()
+		opt.Keys = strings.Split(*fCmpKey, ",")
+		opt.Tables = strings.Split(*fCmpTables, ",")
+		opt.CountPct, opt.DurPct, opt.DurMinNs = *fCmpCount, *fCmpDur, *fCmpDurNs
+		opt.NameLike = *fCmpName
+		same, err := inspector.InspectMain(flag.Args(), opt, *fCmpJson, os.Stdout)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(2)
+		}
+		if !same {
+			os.Exit(1)
+		}
 		return
 	}
 
@@ -168,7 +279,8 @@ func main() {
 	if len(flag.Args()) >= 1 {
 		if *fExec && *fDumpmeta {
 			for _, inputFile := range flag.Args() {
-				topsdev.DumpSectionsFromExecutable(inputFile, *fCheckFlg)
+				topsdev.DumpSectionsFromExecutable(inputFile, *fMetaStartup,
+					*fCheckFlg)
 			}
 			return
 		}
@@ -261,6 +373,16 @@ func main() {
 		return
 	}
 
+	if *fNoVpd && len(*fPerfetto) == 0 && len(*fChrome) == 0 &&
+		len(*fCsvDir) == 0 {
+		log.Fatalf("no output at all with -novpd")
+	}
+	if len(*fReportDir) > 0 {
+		if err := os.MkdirAll(*fReportDir, 0755); err != nil {
+			log.Fatalf("could not create %v: %v", *fReportDir, err)
+		}
+	}
+
 	// Start concurrency
 	rbCount := contentLoader.GetRingBufferCount()
 	resChan := make(chan PostProcessor, rbCount)
@@ -285,6 +407,8 @@ func main() {
 			NoSubop:       *fNoSubop,
 			CpuOps:        cpuOps,
 			DumpOpDebug:   *fDumpOpDebug,
+			TimelineMap:   rtinfo.TimelineMapMode(*fTimelineMap),
+			ReportDir:     *fReportDir,
 		})
 	}
 	for i := 0; i < rbCount; i++ {
@@ -300,14 +424,71 @@ func main() {
 	}
 	sort.Sort(PostProcessors(ps))
 
+	if len(ps) > 1 {
+		devReport := PostProcessors(ps).AlignDevices(*fDevAlign)
+		devReport.Dump(os.Stdout)
+		for _, d := range devReport.Devices {
+			if d.CorrectionUsed != 0 {
+				log.Printf("-devalign: device %v timestamps shifted by %v ns",
+					d.DeviceID, d.CorrectionUsed)
+			}
+		}
+		writeReport(*fReportDir, "devices_timeline.txt", devReport.Dump)
+	}
+
 	// Dump to DB
 	// Use the first input file as the output filename
+	// The vpd and CSV go through DbSession, the devices written
+	// concurrently. The traces are streamed, in device order.
+	var dumpers DbDumpers
+	var dbSessions []*dbexport.DbSession
 	outputVpd := getOutputName(flag.Args()[0])
-	dbObj, err := dbexport.NewDbSession(outputVpd)
-	if err != nil {
-		panic(err)
+	if len(*fOutVpd) > 0 {
+		outputVpd = *fOutVpd
+	}
+	captureSource := *fCapture
+	if len(captureSource) == 0 {
+		captureSource = flag.Args()[0]
+	}
+	if !*fNoVpd {
+		dbObj, err := dbexport.OpenDbSession(outputVpd, dbexport.DbSessionOpt{
+			Append: *fAppend,
+			Source: captureSource,
+		})
+		if err != nil {
+			panic(err)
+		}
+		defer dbObj.Close()
+		dbSessions = append(dbSessions, dbObj)
+	}
+	if len(*fPerfetto) > 0 {
+		pfObj, err := dbexport.NewPerfettoSession(*fPerfetto)
+		if err != nil {
+			log.Fatalf("error create perfetto trace: %v", err)
+		}
+		defer pfObj.Close()
+		dumpers = append(dumpers, pfObj)
+	}
+	if len(*fChrome) > 0 {
+		trObj, err := dbexport.NewTraceEventSession(*fChrome)
+		if err != nil {
+			log.Fatalf("error create chrome trace: %v", err)
+		}
+		defer trObj.Close()
+		dumpers = append(dumpers, trObj)
+	}
+	if len(*fCsvDir) > 0 {
+		comma := ','
+		if *fTsv {
+			comma = '\t'
+		}
+		csvObj, err := dbexport.NewCsvBundleSession(*fCsvDir, comma)
+		if err != nil {
+			log.Fatalf("error create csv bundle: %v", err)
+		}
+		defer csvObj.Close()
+		dbSessions = append(dbSessions, csvObj.DbSession)
 	}
-	defer dbObj.Close()
 
 	var coord = rtdata.Coords{
 		NodeID:   0,
@@ -316,10 +497,39 @@ func main() {
 	var dOpt = DumpOpt{
 		CpuOp: *fDumpCpuOp,
 	}
+	// The vpd and CSV are staged apart from the traces, so each device
+	// is dumped twice then, once into its stages and once into the traces
+	if *fDbSeq {
+		for _, dbs := range dbSessions {
+			dumpers = append(dumpers, dbs)
+		}
+	} else {
+		dumpDevicesStaged(ps, coord, dOpt, dbSessions)
+	}
 	for i := 0; i < rbCount; i++ {
-		ps[i].DumpToDb(coord, dOpt, dbObj)
+		ps[i].DumpToDb(coord, dOpt, dumpers)
 		coord.DeviceID++
 	}
 
-	fmt.Printf("dumped to %v\n", outputVpd)
+	provenance := runProvenance(archDetector)
+	for i := 0; i < rbCount; i++ {
+		provenance = append(provenance, deviceProvenance(
+			rtdata.Coords{NodeID: 0, DeviceID: i}, ps[i])...)
+	}
+	for _, dbs := range dbSessions {
+		dbs.DumpProvenance(provenance)
+	}
+
+	if !*fNoVpd {
+		fmt.Printf("dumped to %v\n", outputVpd)
+	}
+	if len(*fPerfetto) > 0 {
+		fmt.Printf("dumped to %v\n", *fPerfetto)
+	}
+	if len(*fChrome) > 0 {
+		fmt.Printf("dumped to %v\n", *fChrome)
+	}
+	if len(*fCsvDir) > 0 {
+		fmt.Printf("dumped to %v\n", *fCsvDir)
+	}
 }
@@ -2,8 +2,10 @@ package main
 
 import (
 	"fmt"
+	"io"
 	"log"
 	"os"
+	"path/filepath"
 
 	"git.enflame.cn/hai.bai/dmaster/codec"
 	"git.enflame.cn/hai.bai/dmaster/rtinfo/rtdata"
@@ -87,3 +89,19 @@ func dumpFullCycles(bundle []rtdata.OpActivity) {
 		)
 	}
 }
+
+// writeReport writes a text report into the report directory,
+// nothing is written if the directory is not given
+func writeReport(reportDir, name string, dump func(io.Writer)) {
+	if reportDir == "" {
+		return
+	}
+	target := filepath.Join(reportDir, name)
+	fout, err := os.Create(target)
+	if err != nil {
+		log.Printf("error %v: %v", target, err)
+		return
+	}
+	defer fout.Close()
+	dump(fout)
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"log"
+	"sync"
+
+	"git.enflame.cn/hai.bai/dmaster/dbexport"
+	"git.enflame.cn/hai.bai/dmaster/rtinfo"
+	"git.enflame.cn/hai.bai/dmaster/rtinfo/rtdata"
+	"git.enflame.cn/hai.bai/dmaster/topsdev/mimic/mimicdefs"
+)
+
+// DbDumpers fans out to every output, in the order given
+type DbDumpers []DbDumper
+
+func (ds DbDumpers) DumpHostInfo(hostInfo mimicdefs.HostInfo) {
+	for _, d := range ds {
+		d.DumpHostInfo(hostInfo)
+	}
+}
+
+func (ds DbDumpers) DumpFlows(coords rtdata.Coords,
+	links []rtinfo.FlowLink) {
+	for _, d := range ds {
+		d.DumpFlows(coords, links)
+	}
+}
+
+func (ds DbDumpers) DumpDtuOps(coords rtdata.Coords,
+	bundle []rtdata.OpActivity, tm *rtinfo.TimelineManager) {
+	for _, d := range ds {
+		d.DumpDtuOps(coords, bundle, tm)
+	}
+}
+
+func (ds DbDumpers) DumpTaskVec(coords rtdata.Coords,
+	taskVec []rtdata.OrderTask, taskActMap map[int]rtdata.FwActivity,
+	tm *rtinfo.TimelineManager) {
+	for _, d := range ds {
+		d.DumpTaskVec(coords, taskVec, taskActMap, tm)
+	}
+}
+
+func (ds DbDumpers) DumpFwActs(coords rtdata.Coords,
+	bundle []rtdata.FwActivity, taskActMap map[int]rtdata.FwActivity,
+	tm *rtinfo.TimelineManager) {
+	for _, d := range ds {
+		d.DumpFwActs(coords, bundle, taskActMap, tm)
+	}
+}
+
+func (ds DbDumpers) DumpDmaActs(coords rtdata.Coords,
+	bundle []rtdata.CookedDmaActivity, tm *rtinfo.TimelineManager) {
+	for _, d := range ds {
+		d.DumpDmaActs(coords, bundle, tm)
+	}
+}
+
+func (ds DbDumpers) DumpKernelActs(coords rtdata.Coords,
+	bundle []rtdata.KernelActivity, tm *rtinfo.TimelineManager,
+	rowName string) {
+	for _, d := range ds {
+		d.DumpKernelActs(coords, bundle, tm, rowName)
+	}
+}
+
+func (ds DbDumpers) DumpCpuOpTrace(coords rtdata.Coords,
+	cpuOps []rtdata.CpuOpAct, rowName string) {
+	for _, d := range ds {
+		d.DumpCpuOpTrace(coords, cpuOps, rowName)
+	}
+}
+
+func (ds DbDumpers) DumpOpCoverage(coords rtdata.Coords,
+	coverage rtinfo.OpCoverageReport) {
+	for _, d := range ds {
+		d.DumpOpCoverage(coords, coverage)
+	}
+}
+
+func (ds DbDumpers) DumpCriticalPaths(coords rtdata.Coords,
+	paths []rtinfo.TaskCriticalPath, tm *rtinfo.TimelineManager) {
+	for _, d := range ds {
+		d.DumpCriticalPaths(coords, paths, tm)
+	}
+}
+
+func (ds DbDumpers) DumpUtilization(coords rtdata.Coords,
+	report rtinfo.UtilizationReport, tm *rtinfo.TimelineManager) {
+	for _, d := range ds {
+		d.DumpUtilization(coords, report, tm)
+	}
+}
+
+func (ds DbDumpers) DumpKernelAsserts(coords rtdata.Coords,
+	report rtinfo.KernelAssertReport, tm *rtinfo.TimelineManager) {
+	for _, d := range ds {
+		d.DumpKernelAsserts(coords, report, tm)
+	}
+}
+
+func (ds DbDumpers) DumpCounters(coords rtdata.Coords,
+	tracks []rtinfo.CounterTrack, tm *rtinfo.TimelineManager) {
+	for _, d := range ds {
+		d.DumpCounters(coords, tracks, tm)
+	}
+}
+
+// Only the outputs knowing the wild rows get them
+func (ds DbDumpers) DumpWildOps(coords rtdata.Coords,
+	bundle []rtdata.OpActivity, tm *rtinfo.TimelineManager,
+	evtG dbexport.EventTraceItemGen) {
+	for _, d := range ds {
+		if wd, ok := d.(WildOpDumper); ok {
+			wd.DumpWildOps(coords, bundle, tm, evtG)
+		}
+	}
+}
+
+// dumpDevicesStaged writes each device into its own stage of every
+// session concurrently, the stages are merged in device order so that
+// the sessions end up as if written one device after another
+func dumpDevicesStaged(ps []PostProcessor, coord rtdata.Coords,
+	dOpt DumpOpt, sessions []*dbexport.DbSession) {
+	if len(sessions) == 0 {
+		return
+	}
+	stages := make([][]*dbexport.DbSession, len(sessions))
+	for i, dbs := range sessions {
+		var err error
+		if stages[i], err = dbs.OpenStages(len(ps)); err != nil {
+			log.Fatalf("error open stages: %v", err)
+		}
+	}
+
+	var wg sync.WaitGroup
+	for dev := range ps {
+		var devDumpers DbDumpers
+		for i := range sessions {
+			devDumpers = append(devDumpers, stages[i][dev])
+		}
+		wg.Add(1)
+		go func(p PostProcessor, coord rtdata.Coords, d DbDumpers) {
+			defer wg.Done()
+			p.DumpToDb(coord, dOpt, d)
+		}(ps[dev], coord, devDumpers)
+		coord.DeviceID++
+	}
+	wg.Wait()
+
+	for i, dbs := range sessions {
+		if err := dbs.MergeStages(stages[i]); err != nil {
+			log.Fatalf("error merge stages: %v", err)
+		}
+	}
+}
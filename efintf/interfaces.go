@@ -30,6 +30,11 @@ type ExecScopeLoader interface {
 	LoadExecScope(execUuid uint64) *metadata.ExecScope
 }
 
+// Optional for InfoReceiver, only the ones knowing SHT_KERN_ASSERT_INFO
+type KernelAssertLoader interface {
+	LoadKernelAsserts(execUuid uint64) (metadata.KernelAssertDict, bool)
+}
+
 type InfoReceiver interface {
 	TaskLoader
 	ArchTypeGet
@@ -0,0 +1,402 @@
+package inspector
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"sort"
+
+	"git.enflame.cn/hai.bai/dmaster/dbexport"
+)
+
+// Ops of two runs are matched by (exec, op id, instance),
+// instance is the order of the op among the same ones of the run.
+type RunOpKey struct {
+	ExecUuid string
+	OpId     int
+	Instance int
+}
+
+func (k RunOpKey) ToString() string {
+	if k.OpId < 0 {
+		return fmt.Sprintf("%v task #%v", k.ExecUuid, k.Instance)
+	}
+	return fmt.Sprintf("%v op %v #%v", k.ExecUuid, k.OpId, k.Instance)
+}
+
+// Tasks are matched by (exec, instance), op id is left -1
+type RunRecord struct {
+	Key      RunOpKey
+	Name     string
+	Duration uint64
+}
+
+type RunSnapshot struct {
+	Filename string
+	Ops      map[RunOpKey]RunRecord
+	Tasks    map[RunOpKey]RunRecord
+	DmaCount map[string]int // by engine type and dma op
+}
+
+func queryRunRecords(db *sql.DB, withOpId bool, cmd string,
+	args ...interface{}) (map[RunOpKey]RunRecord, error) {
+	rows, err := db.Query(cmd, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	instanceMap := make(map[RunOpKey]int)
+	rv := make(map[RunOpKey]RunRecord)
+	for rows.Next() {
+		var execUuid, name string
+		var opId int
+		var duration uint64
+		if err := rows.Scan(&execUuid, &opId, &name, &duration); err != nil {
+			return nil, err
+		}
+		if !withOpId {
+			opId = -1
+		}
+		key := RunOpKey{ExecUuid: execUuid, OpId: opId}
+		key.Instance = instanceMap[key]
+		instanceMap[key]++
+		rv[key] = RunRecord{Key: key, Name: name, Duration: duration}
+	}
+	return rv, rows.Err()
+}
+
+func queryDmaCount(db *sql.DB) (map[string]int, error) {
+	rows, err := db.Query(`SELECT engine_type, IFNULL(dma_op, ''), COUNT(*)
+		FROM memcpy GROUP BY engine_type, dma_op`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	rv := make(map[string]int)
+	for rows.Next() {
+		var engineType, dmaOp string
+		var count int
+		if err := rows.Scan(&engineType, &dmaOp, &count); err != nil {
+			return nil, err
+		}
+		rv[engineType+" "+dmaOp] = count
+	}
+	return rv, rows.Err()
+}
+
+func LoadRunSnapshot(targetName string) (RunSnapshot, error) {
+	rv := RunSnapshot{Filename: targetName}
+	vpd, err := dbexport.OpenVpdReadOnly(targetName)
+	if err != nil {
+		return rv, err
+	}
+	defer vpd.Close()
+	db := vpd.DB
+
+	if rv.Ops, err = queryRunRecords(db, true,
+		`SELECT exec_uuid, op_id, op_name, duration_timestamp FROM dtu_op
+		WHERE row_name = ? AND exec_uuid IS NOT NULL
+		ORDER BY device_id, start_timestamp, idx`,
+		dbexport.DtuOpRowName); err != nil {
+		return rv, fmt.Errorf("ops of %v: %v", targetName, err)
+	}
+	if rv.Tasks, err = queryRunRecords(db, false,
+		`SELECT exec_uuid, op_id, name, duration_timestamp FROM dtu_op
+		WHERE row_name LIKE ? AND exec_uuid IS NOT NULL
+		ORDER BY device_id, start_timestamp, idx`,
+		"Pg %"); err != nil {
+		return rv, fmt.Errorf("tasks of %v: %v", targetName, err)
+	}
+	if rv.DmaCount, err = queryDmaCount(db); err != nil {
+		return rv, fmt.Errorf("DMAs of %v: %v", targetName, err)
+	}
+	return rv, nil
+}
+
+// A delta only counts as regression if it is over both the ratio and
+// the absolute limit, so that tiny ops do not flip the result.
+type ABThreshold struct {
+	OpDeltaPct     float64
+	OpDeltaMinNs   uint64
+	TaskDeltaPct   float64
+	DmaDeltaPct    float64
+	MaxMissingOps  int
+	MaxNewOps      int
+	MaxReportLines int
+}
+
+func DefaultABThreshold() ABThreshold {
+	return ABThreshold{
+		OpDeltaPct:     5,
+		OpDeltaMinNs:   1000,
+		TaskDeltaPct:   5,
+		DmaDeltaPct:    0,
+		MaxMissingOps:  0,
+		MaxNewOps:      -1, // not checked
+		MaxReportLines: 20,
+	}
+}
+
+type ABDelta struct {
+	Key      RunOpKey
+	Name     string
+	Base     uint64
+	Test     uint64
+	DeltaPct float64
+	Regress  bool
+}
+
+func (d ABDelta) Delta() int64 {
+	return int64(d.Test) - int64(d.Base)
+}
+
+type ABCountDelta struct {
+	Name     string
+	Base     int
+	Test     int
+	DeltaPct float64
+	Regress  bool
+}
+
+type ABReport struct {
+	BaseFile, TestFile string
+	Threshold          ABThreshold
+
+	MatchedOps  int
+	OpDeltas    []ABDelta // sorted by delta, the worst first
+	MissingOps  []RunOpKey
+	NewOps      []RunOpKey
+	TaskDeltas  []ABDelta
+	DmaDeltas   []ABCountDelta
+	BaseOpTotal uint64
+	TestOpTotal uint64
+
+	Failures []string
+}
+
+func (r ABReport) Pass() bool {
+	return len(r.Failures) == 0
+}
+
+func deltaPct(base, test float64) float64 {
+	if base == 0 {
+		if test == 0 {
+			return 0
+		}
+		return 100
+	}
+	return (test - base) / base * 100
+}
+
+func compareRecords(base, test map[RunOpKey]RunRecord,
+	regress func(ABDelta) bool) ([]ABDelta, []RunOpKey, []RunOpKey) {
+	var deltas []ABDelta
+	var missing, added []RunOpKey
+	for key, b := range base {
+		t, ok := test[key]
+		if !ok {
+			missing = append(missing, key)
+			continue
+		}
+		d := ABDelta{
+			Key:      key,
+			Name:     b.Name,
+			Base:     b.Duration,
+			Test:     t.Duration,
+			DeltaPct: deltaPct(float64(b.Duration), float64(t.Duration)),
+		}
+		d.Regress = regress(d)
+		deltas = append(deltas, d)
+	}
+	for key := range test {
+		if _, ok := base[key]; !ok {
+			added = append(added, key)
+		}
+	}
+	sort.Slice(deltas, func(i, j int) bool {
+		if deltas[i].Delta() != deltas[j].Delta() {
+			return deltas[i].Delta() > deltas[j].Delta()
+		}
+		return deltas[i].Key.ToString() < deltas[j].Key.ToString()
+	})
+	sortKeys := func(keys []RunOpKey) {
+		sort.Slice(keys, func(i, j int) bool {
+			return keys[i].ToString() < keys[j].ToString()
+		})
+	}
+	sortKeys(missing)
+	sortKeys(added)
+	return deltas, missing, added
+}
+
+func CompareRuns(base, test RunSnapshot, th ABThreshold) ABReport {
+	rv := ABReport{
+		BaseFile:  base.Filename,
+		TestFile:  test.Filename,
+		Threshold: th,
+	}
+
+	var regressOps, regressTasks, regressDma int
+	rv.OpDeltas, rv.MissingOps, rv.NewOps = compareRecords(base.Ops, test.Ops,
+		func(d ABDelta) bool {
+			return d.DeltaPct > th.OpDeltaPct &&
+				d.Delta() > int64(th.OpDeltaMinNs)
+		})
+	rv.MatchedOps = len(rv.OpDeltas)
+	for _, d := range rv.OpDeltas {
+		rv.BaseOpTotal += d.Base
+		rv.TestOpTotal += d.Test
+		if d.Regress {
+			regressOps++
+		}
+	}
+	rv.TaskDeltas, _, _ = compareRecords(base.Tasks, test.Tasks,
+		func(d ABDelta) bool {
+			return d.DeltaPct > th.TaskDeltaPct
+		})
+	for _, d := range rv.TaskDeltas {
+		if d.Regress {
+			regressTasks++
+		}
+	}
+
+	allDma := make(map[string]bool)
+	for k := range base.DmaCount {
+		allDma[k] = true
+	}
+	for k := range test.DmaCount {
+		allDma[k] = true
+	}
+	for k := range allDma {
+		b, t := base.DmaCount[k], test.DmaCount[k]
+		if b == t {
+			continue
+		}
+		d := ABCountDelta{
+			Name: k, Base: b, Test: t,
+			DeltaPct: deltaPct(float64(b), float64(t)),
+		}
+		pct := d.DeltaPct
+		if pct < 0 {
+			pct = -pct
+		}
+		d.Regress = pct > th.DmaDeltaPct
+		if d.Regress {
+			regressDma++
+		}
+		rv.DmaDeltas = append(rv.DmaDeltas, d)
+	}
+	sort.Slice(rv.DmaDeltas, func(i, j int) bool {
+		return rv.DmaDeltas[i].Name < rv.DmaDeltas[j].Name
+	})
+
+	if regressOps > 0 {
+		rv.Failures = append(rv.Failures,
+			fmt.Sprintf("%v op(s) slower than %.2f%%", regressOps, th.OpDeltaPct))
+	}
+	if regressTasks > 0 {
+		rv.Failures = append(rv.Failures,
+			fmt.Sprintf("%v task(s) slower than %.2f%%", regressTasks, th.TaskDeltaPct))
+	}
+	if th.MaxMissingOps >= 0 && len(rv.MissingOps) > th.MaxMissingOps {
+		rv.Failures = append(rv.Failures,
+			fmt.Sprintf("%v op(s) missing, %v allowed", len(rv.MissingOps), th.MaxMissingOps))
+	}
+	if th.MaxNewOps >= 0 && len(rv.NewOps) > th.MaxNewOps {
+		rv.Failures = append(rv.Failures,
+			fmt.Sprintf("%v new op(s), %v allowed", len(rv.NewOps), th.MaxNewOps))
+	}
+	if regressDma > 0 {
+		rv.Failures = append(rv.Failures,
+			fmt.Sprintf("%v DMA count(s) changed over %.2f%%", regressDma, th.DmaDeltaPct))
+	}
+	return rv
+}
+
+func (r ABReport) Dump(out io.Writer) {
+	limit := r.Threshold.MaxReportLines
+	fmt.Fprintf(out, "# A/B: base \"%v\", test \"%v\"\n", r.BaseFile, r.TestFile)
+	fmt.Fprintf(out, "# ops matched: %v, missing: %v, new: %v\n",
+		r.MatchedOps, len(r.MissingOps), len(r.NewOps))
+	fmt.Fprintf(out, "# op total: %v ns -> %v ns (%+.2f%%)\n",
+		r.BaseOpTotal, r.TestOpTotal,
+		deltaPct(float64(r.BaseOpTotal), float64(r.TestOpTotal)))
+
+	dumpDeltas := func(title string, deltas []ABDelta) {
+		fmt.Fprintf(out, "\n### %v ###\n", title)
+		for i, d := range deltas {
+			if i >= limit {
+				fmt.Fprintf(out, ".... %v more\n", len(deltas)-limit)
+				break
+			}
+			mark := ""
+			if d.Regress {
+				mark = " REGRESS"
+			}
+			fmt.Fprintf(out, "%v %v: %v -> %v (%+d ns, %+.2f%%)%v\n",
+				d.Key.ToString(), d.Name, d.Base, d.Test,
+				d.Delta(), d.DeltaPct, mark)
+		}
+	}
+	dumpKeys := func(title string, keys []RunOpKey) {
+		if len(keys) == 0 {
+			return
+		}
+		fmt.Fprintf(out, "\n### %v ###\n", title)
+		for i, k := range keys {
+			if i >= limit {
+				fmt.Fprintf(out, ".... %v more\n", len(keys)-limit)
+				break
+			}
+			fmt.Fprintf(out, "%v\n", k.ToString())
+		}
+	}
+
+	dumpDeltas("op duration delta", r.OpDeltas)
+	dumpKeys("missing ops", r.MissingOps)
+	dumpKeys("new ops", r.NewOps)
+	dumpDeltas("task duration delta", r.TaskDeltas)
+	if len(r.DmaDeltas) > 0 {
+		fmt.Fprintf(out, "\n### DMA count delta ###\n")
+		for _, d := range r.DmaDeltas {
+			mark := ""
+			if d.Regress {
+				mark = " CHANGED"
+			}
+			fmt.Fprintf(out, "%v: %v -> %v (%+.2f%%)%v\n",
+				d.Name, d.Base, d.Test, d.DeltaPct, mark)
+		}
+	}
+
+	fmt.Fprintf(out, "\n")
+	if r.Pass() {
+		fmt.Fprintf(out, "# PASS\n")
+		return
+	}
+	for _, f := range r.Failures {
+		fmt.Fprintf(out, "# FAIL: %v\n", f)
+	}
+}
+
+// CompareMain compares the test run(s) to the first one
+// and returns false if any fails the threshold.
+func CompareMain(files []string, th ABThreshold, out io.Writer) (bool, error) {
+	if len(files) < 2 {
+		return false, fmt.Errorf("at least 2 vpd files are required for A/B")
+	}
+	base, err := LoadRunSnapshot(files[0])
+	if err != nil {
+		return false, err
+	}
+	pass := true
+	for _, f := range files[1:] {
+		test, err := LoadRunSnapshot(f)
+		if err != nil {
+			return false, err
+		}
+		report := CompareRuns(base, test, th)
+		report.Dump(out)
+		pass = pass && report.Pass()
+	}
+	return pass, nil
+}
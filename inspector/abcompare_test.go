@@ -0,0 +1,116 @@
+package inspector
+
+import (
+	"bytes"
+	"database/sql"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"git.enflame.cn/hai.bai/dmaster/dbexport"
+)
+
+// Two runs of op 3 and one of op 4 in a task
+func newRunVpd(t *testing.T, name string, opNs int) string {
+	target := filepath.Join(t.TempDir(), name)
+	dbs, err := dbexport.NewDbSession(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dbs.Close()
+	db, err := sql.Open("sqlite3", target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	for i, r := range []struct {
+		opId     int
+		name     string
+		rowName  string
+		start    int
+		duration int
+	}{
+		{3, "conv", dbexport.DtuOpRowName, 0, opNs},
+		{4, "relu", dbexport.DtuOpRowName, 10000, 500},
+		{3, "conv", dbexport.DtuOpRowName, 20000, 1000},
+		{-1, "Task.1", "Pg 000001", 0, 30000},
+	} {
+		if _, err := db.Exec(`insert into dtu_op(idx, device_id, exec_uuid,
+			op_id, op_name, name, row_name, start_timestamp, duration_timestamp)
+			values(?, 0, '0xa', ?, ?, ?, ?, ?, ?)`,
+			i, r.opId, r.name, r.name, r.rowName, r.start, r.duration); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := db.Exec(`insert into memcpy(idx, engine_type, dma_op)
+		values(10, 'CDMA', 'factor.Slice')`); err != nil {
+		t.Fatal(err)
+	}
+	return target
+}
+
+func TestCompareRuns(t *testing.T) {
+	base := newRunVpd(t, "base.vpd", 1000)
+	same := newRunVpd(t, "same.vpd", 1010)
+	slow := newRunVpd(t, "slow.vpd", 3000)
+
+	snapshot, err := LoadRunSnapshot(base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snapshot.Ops) != 3 || len(snapshot.Tasks) != 1 ||
+		snapshot.DmaCount["CDMA factor.Slice"] != 1 {
+		t.Errorf("unexpected snapshot: %+v", snapshot)
+	}
+	second := RunOpKey{ExecUuid: "0xa", OpId: 3, Instance: 1}
+	if r := snapshot.Ops[second]; r.Duration != 1000 || r.Name != "conv" {
+		t.Errorf("unexpected 2nd run of op 3: %+v", r)
+	}
+
+	out := &bytes.Buffer{}
+	pass, err := CompareMain([]string{base, same}, DefaultABThreshold(), out)
+	if err != nil || !pass {
+		t.Fatalf("expecting pass, got %v, %v:\n%v", pass, err, out.String())
+	}
+
+	out.Reset()
+	pass, err = CompareMain([]string{base, slow}, DefaultABThreshold(), out)
+	if err != nil || pass {
+		t.Fatalf("expecting fail, got %v, %v:\n%v", pass, err, out.String())
+	}
+	if !strings.Contains(out.String(), "# FAIL: 1 op(s) slower than 5.00%") {
+		t.Errorf("unexpected report:\n%v", out.String())
+	}
+
+	if _, err := CompareMain([]string{base}, DefaultABThreshold(), out); err == nil {
+		t.Errorf("expecting error of a single vpd")
+	}
+	missing := filepath.Join(t.TempDir(), "no", "such.vpd")
+	if _, err := CompareMain([]string{base, missing}, DefaultABThreshold(), out); err == nil {
+		t.Errorf("expecting error of the missing vpd")
+	}
+}
+
+func TestLoadRunLeavesVpdUnchanged(t *testing.T) {
+	base := newRunVpd(t, "base.vpd", 1000)
+	db, err := sql.Open("sqlite3", base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	older := dbexport.CurrentSchemaVersion() - 1
+	if _, err := db.Exec(`update schema_version set version = ?`, older); err != nil {
+		t.Fatal(err)
+	}
+
+	run, err := LoadRunSnapshot(base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(run.Ops) == 0 {
+		t.Errorf("expecting ops loaded from the upgraded copy")
+	}
+	if v, err := dbexport.DetectSchemaVersion(db); err != nil || v != older {
+		t.Errorf("expecting the vpd left at %v, got %v: %v", older, v, err)
+	}
+}
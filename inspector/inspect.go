@@ -1,329 +1,484 @@
 package inspector
 
 import (
-	"bytes"
 	"database/sql"
+	"encoding/json"
 	"fmt"
 	"io"
-	"log"
+	"math"
 	"sort"
+	"strings"
 
+	"git.enflame.cn/hai.bai/dmaster/dbexport"
 	_ "github.com/mattn/go-sqlite3"
 )
 
-const ExtraCond = " and name like \"DMA VC%%\""
+// Rows of a table are grouped by the key, the groups of two vpds are
+// compared by row count and total duration
 
-// const ExtraCond = " and name like \"DMA BUSY%%\""
+const (
+	CompareKey_Name     = "name"
+	CompareKey_OpId     = "op_id"
+	CompareKey_PacketId = "packet_id"
+	CompareKey_Engine   = "engine"
+	// Empty for the DMAs without meta restored
+	CompareKey_TilingMode = "tiling_mode"
+)
 
-// packet id distribution
-func InspectMemcpy(out io.Writer, db *sql.DB, engineType string) map[int]int {
-	rows, err := db.Query(
-		fmt.Sprintf("SELECT distinct(tiling_mode) FROM memcpy where engine_type=\"%v\""+ExtraCond,
-			engineType),
-	)
-	if err != nil {
-		panic(err)
+// Columns making up the key field, those missing in a table are left out
+var compareKeyColumns = map[string][]string{
+	CompareKey_Name:       {"name"},
+	CompareKey_OpId:       {"op_id"},
+	CompareKey_PacketId:   {"packet_id"},
+	CompareKey_Engine:     {"engine_type", "cluster_id", "engine_id"},
+	CompareKey_TilingMode: {"tiling_mode"},
+}
+
+func compareKeyNames() []string {
+	var rv []string
+	for key := range compareKeyColumns {
+		rv = append(rv, key)
 	}
-	hasEmpty := false
-	var tilingSet = make(map[string]bool)
-	for rows.Next() {
-		var tilingMode string
-		err = rows.Scan(&tilingMode)
-		if err != nil {
-			panic(err)
-		}
-		if tilingMode == "" {
-			hasEmpty = true
-			continue
-		}
-		tilingSet[tilingMode] = true
+	sort.Strings(rv)
+	return rv
+}
+
+// What rows of the vpd make a comparable table, tasks are the Pg rows
+// of dtu_op. The names of some tables are indexed per row by the
+// NameConverter, the index is left out of the key.
+type compareTable struct {
+	table       string
+	where       string
+	args        []interface{}
+	indexedName bool
+}
+
+var compareTables = map[string]compareTable{
+	"dtu_op": {"dtu_op", "row_name = ?", []interface{}{dbexport.DtuOpRowName}, true},
+	"tasks":  {"dtu_op", "row_name LIKE 'Pg %'", nil, false},
+	"fw":     {"fw", "", nil, true},
+	"kernel": {"kernel", "", nil, true},
+	"memcpy": {"memcpy", "", nil, false},
+}
+
+func CompareTableNames() []string {
+	var rv []string
+	for name := range compareTables {
+		rv = append(rv, name)
 	}
-	rows.Close()
+	sort.Strings(rv)
+	return rv
+}
 
-	//
-	tilingCount := make(map[string]int)
-	for tiling := range tilingSet {
-		rows, err = db.Query(
-			fmt.Sprintf("SELECT COUNT(*) FROM memcpy WHERE tiling_mode=\"%v\" AND engine_type=\"%v\""+ExtraCond,
-				tiling,
-				engineType),
-		)
-		if err != nil {
-			panic(err)
+// A group differs if its count changes over CountPct, or its total
+// duration changes over both DurPct and DurMinNs. Only the rows of
+// name LIKE NameLike are compared, all of them if empty.
+type InspectOpt struct {
+	Keys           []string
+	Tables         []string
+	NameLike       string
+	CountPct       float64
+	DurPct         float64
+	DurMinNs       uint64
+	MaxReportLines int
+}
+
+func DefaultInspectOpt() InspectOpt {
+	return InspectOpt{
+		Keys:           []string{CompareKey_Name},
+		Tables:         CompareTableNames(),
+		CountPct:       0,
+		DurPct:         5,
+		DurMinNs:       1000,
+		MaxReportLines: 20,
+	}
+}
+
+func (opt InspectOpt) validate() error {
+	if len(opt.Keys) == 0 {
+		return fmt.Errorf("no key to group the rows by")
+	}
+	for _, key := range opt.Keys {
+		if _, ok := compareKeyColumns[key]; !ok {
+			return fmt.Errorf("unknown key %q, expecting one of %v",
+				key, compareKeyNames())
 		}
-		for rows.Next() {
-			var count int
-			err = rows.Scan(&count)
-			if err != nil {
-				panic(err)
-			}
-			tilingCount[tiling] = count
+	}
+	for _, table := range opt.Tables {
+		if _, ok := compareTables[table]; !ok {
+			return fmt.Errorf("unknown table %q, expecting one of %v",
+				table, CompareTableNames())
 		}
-		rows.Close()
 	}
+	return nil
+}
+
+type TableGroup struct {
+	Count   int
+	TotalNs uint64
+}
 
-	var tiles []string
-	for t := range tilingSet {
-		tiles = append(tiles, t)
+type TableSnapshot struct {
+	Columns []string // the key is made of
+	Groups  map[string]TableGroup
+}
+
+type VpdSnapshot struct {
+	Filename string
+	Tables   map[string]TableSnapshot
+}
+
+func tableColumnSet(db *sql.DB, table string) (map[string]bool, error) {
+	rows, err := db.Query(`SELECT name FROM pragma_table_info(?)`, table)
+	if err != nil {
+		return nil, err
 	}
-	sort.Strings(tiles)
-	fmt.Fprintf(out, "### Engine type for %v ###\n", engineType)
-	for _, t := range tiles {
-		fmt.Fprintf(out, "%20v\t%v\n", t, tilingCount[t])
+	defer rows.Close()
+	rv := make(map[string]bool)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		rv[name] = true
 	}
+	return rv, rows.Err()
+}
 
-	fmt.Fprintf(out, "### Engine type for %v in details ###\n", engineType)
-	pidSet := (func() map[int]bool {
-		cmd := fmt.Sprintf("SELECT distinct(packet_id) FROM memcpy WHERE engine_type=\"%v\""+ExtraCond, engineType)
-		rows, err := db.Query(cmd)
-		if err != nil {
-			panic(err)
-		}
-		pidSet := make(map[int]bool)
-		for rows.Next() {
-			var pktId int
-			err = rows.Scan(&pktId)
-			if err != nil {
-				panic(err)
-			}
-			pidSet[pktId] = true
+// trimNameIndex strips the ".<seq>" of an indexed name
+func trimNameIndex(name string) string {
+	dot := strings.LastIndexByte(name, '.')
+	if dot < 0 || dot == len(name)-1 {
+		return name
+	}
+	for _, c := range name[dot+1:] {
+		if c < '0' || c > '9' {
+			return name
 		}
-		rows.Close()
-		return pidSet
-	})()
+	}
+	return name[:dot]
+}
 
-	pidCount := make(map[int]int)
-	for pid := range pidSet {
-		cmd :=
-			fmt.Sprintf("SELECT count(*) FROM memcpy WHERE packet_id=\"%v\" and engine_type=\"%v\""+ExtraCond,
-				pid, engineType)
-		rows, err := db.Query(cmd)
-		if err != nil {
-			panic(err)
-		}
-		var count int
-		for rows.Next() {
-			err = rows.Scan(&count)
-			if err != nil {
-				panic(err)
+func loadTableSnapshot(db *sql.DB, ct compareTable,
+	keys []string, nameLike string) (TableSnapshot, error) {
+	var rv TableSnapshot
+	colSet, err := tableColumnSet(db, ct.table)
+	if err != nil {
+		return rv, err
+	}
+	var exprs []string
+	for _, key := range keys {
+		for _, col := range compareKeyColumns[key] {
+			if colSet[col] {
+				rv.Columns = append(rv.Columns, col)
+				exprs = append(exprs, fmt.Sprintf("IFNULL(%v, '')", col))
 			}
 		}
-		pidCount[pid] = count
 	}
-
-	if hasEmpty {
-		cmd := fmt.Sprintf(
-			"SELECT distinct(packet_id) FROM memcpy WHERE (tiling_mode is null or TRIM(tiling_mode)=\"\") and engine_type=\"%v\""+ExtraCond,
-			engineType)
-		// fmt.Fprintf(out, "cmd is %v\n", cmd)
-		rows, err = db.Query(cmd)
-		if err != nil {
-			panic(err)
+	cmd := fmt.Sprintf(`SELECT COUNT(*), IFNULL(SUM(duration_timestamp), 0)
+		FROM %v`, ct.table)
+	if len(exprs) > 0 {
+		cmd = fmt.Sprintf(`SELECT %v, COUNT(*),
+			IFNULL(SUM(duration_timestamp), 0) FROM %v`,
+			strings.Join(exprs, ", "), ct.table)
+	}
+	var conds []string
+	args := ct.args
+	if ct.where != "" {
+		conds = append(conds, ct.where)
+	}
+	if nameLike != "" && colSet["name"] {
+		conds = append(conds, "name LIKE ?")
+		args = append(append([]interface{}{}, args...), nameLike)
+	}
+	if len(conds) > 0 {
+		cmd += " WHERE " + strings.Join(conds, " AND ")
+	}
+	if len(exprs) > 0 {
+		cmd += " GROUP BY " + strings.Join(exprs, ", ")
+	}
+	rows, err := db.Query(cmd, args...)
+	if err != nil {
+		return rv, err
+	}
+	defer rows.Close()
+	rv.Groups = make(map[string]TableGroup)
+	parts := make([]string, len(exprs))
+	for rows.Next() {
+		var group TableGroup
+		dest := make([]interface{}, 0, len(parts)+2)
+		for i := range parts {
+			dest = append(dest, &parts[i])
 		}
-
-		pids := make(map[int]bool)
-		for rows.Next() {
-			var packetId int
-			err = rows.Scan(&packetId)
-			if err != nil {
-				panic(err)
-			}
-			pids[packetId] = true
+		dest = append(dest, &group.Count, &group.TotalNs)
+		if err := rows.Scan(dest...); err != nil {
+			return rv, err
 		}
-		if len(pids) > 0 {
-			fmt.Fprintf(out, "# Packet without meta found, distinct(pid) is #\n")
-			printCc := 5
-			for pid := range pids {
-				fmt.Fprintf(out, "%v\n", pid)
-				printCc--
-				if printCc < 0 {
-					break
-				}
-			}
-			if printCc < 0 {
-				fmt.Fprintf(out, ".... too many\n")
+		if group.Count == 0 {
+			continue
+		}
+		for i, col := range rv.Columns {
+			if col == "name" && ct.indexedName {
+				parts[i] = trimNameIndex(parts[i])
 			}
-		} else {
-			fmt.Fprintf(out, "all DMA meta restored\n")
 		}
-
-		// for pid := range pids {
-		// 	rows, err = db.Query(
-		// 		fmt.Sprintf("SELECT count(*) from memcpy where (TRIM(tiling_mode)=\"\" or tiling_mode is null) and engine_type=\"%v\" and packet_id=%v",
-		// 			engineType, pid),
-		// 	)
-		// 	if err != nil {
-		// 		panic(err)
-		// 	}
-		// 	for rows.Next() {
-		// 		var count int
-		// 		err = rows.Scan(&count)
-		// 		if err != nil {
-		// 			panic(err)
-		// 		}
-		// 		fmt.Fprintf(out, "%v counts to %v\n", pid, count)
-		// 	}
-		//  rows.Close()
-		// }
+		// Rows of the same name apart from the index add up
+		key := strings.Join(parts, " ")
+		sum := rv.Groups[key]
+		sum.Count += group.Count
+		sum.TotalNs += group.TotalNs
+		rv.Groups[key] = sum
 	}
-	fmt.Fprintf(out, "\n")
-	return pidCount
+	return rv, rows.Err()
 }
 
-func GetDistinctEngineTypes(db *sql.DB) map[string]bool {
-	rows, err := db.Query(
-		"SELECT DISTINCT(engine_type) FROM memcpy",
-	)
+// LoadVpdSnapshot groups the rows of the tables, a table missing from the
+// vpd is left out
+func LoadVpdSnapshot(targetName string, opt InspectOpt) (VpdSnapshot, error) {
+	rv := VpdSnapshot{Filename: targetName, Tables: make(map[string]TableSnapshot)}
+	vpd, err := dbexport.OpenVpdReadOnly(targetName)
 	if err != nil {
-		panic(err)
+		return rv, err
 	}
-	rv := make(map[string]bool)
-	for rows.Next() {
-		var engineStr string
-		err = rows.Scan(&engineStr)
+	defer vpd.Close()
+	db := vpd.DB
+	for _, name := range opt.Tables {
+		ct := compareTables[name]
+		colSet, err := tableColumnSet(db, ct.table)
 		if err != nil {
-			panic(err)
+			return rv, err
+		}
+		if len(colSet) == 0 {
+			continue
 		}
-		rv[engineStr] = true
+		snapshot, err := loadTableSnapshot(db, ct, opt.Keys, opt.NameLike)
+		if err != nil {
+			return rv, fmt.Errorf("%v of %v: %v", name, targetName, err)
+		}
+		rv.Tables[name] = snapshot
 	}
-	return rv
+	return rv, nil
 }
 
-func InspectXdma(out io.Writer, targetName string) map[string]map[int]int {
-	db, err := sql.Open("sqlite3", targetName)
-	if err != nil {
-		log.Fatal(err)
-	}
-	defer db.Close()
+const (
+	GroupStatus_Changed = "changed"
+	GroupStatus_Missing = "missing" // in test
+	GroupStatus_New     = "new"     // in test
+)
 
-	engines := GetDistinctEngineTypes(db)
-	var engineArr []string
-	for e := range engines {
-		engineArr = append(engineArr, e)
-	}
+type GroupDiff struct {
+	Key       string  `json:"key"`
+	Status    string  `json:"status"`
+	BaseCount int     `json:"base_count"`
+	TestCount int     `json:"test_count"`
+	CountPct  float64 `json:"count_pct"`
+	BaseNs    uint64  `json:"base_ns"`
+	TestNs    uint64  `json:"test_ns"`
+	DurPct    float64 `json:"dur_pct"`
+	Exceeds   bool    `json:"exceeds"`
+}
 
-	distri := make(map[string]map[int]int)
-	sort.Strings(engineArr)
-	for _, engine := range engineArr {
-		dis := InspectMemcpy(out, db, engine)
-		distri[engine] = dis
-	}
-	return distri
+func (d GroupDiff) DeltaNs() int64 {
+	return int64(d.TestNs) - int64(d.BaseNs)
 }
 
-// return true:  two map are exactly the same
-func compareDicts(uObj, vObj string, lhs, rhs map[string]map[int]int, out io.Writer) bool {
-	isSame := true
+type TableDiff struct {
+	Table      string      `json:"table"`
+	KeyColumns []string    `json:"key_columns"`
+	Missing    string      `json:"missing,omitempty"` // file without the table
+	BaseRows   int         `json:"base_rows"`
+	TestRows   int         `json:"test_rows"`
+	BaseNs     uint64      `json:"base_ns"`
+	TestNs     uint64      `json:"test_ns"`
+	SameGroups int         `json:"same_groups"`
+	Groups     []GroupDiff `json:"groups"` // the differing ones, the worst first
+	Exceeded   int         `json:"exceeded"`
+}
 
-	allEngine := make(map[string]bool)
-	for k := range lhs {
-		allEngine[k] = true
-	}
-	for k := range rhs {
-		allEngine[k] = true
-	}
-	for k := range allEngine {
-		fmt.Fprintf(out, "# For engine(%v)\n", k)
-		if _, ok := lhs[k]; !ok {
-			fmt.Fprintf(out, "  %v is missing for %v\n", k, uObj)
-			isSame = false
+type InspectReport struct {
+	BaseFile string      `json:"base_file"`
+	TestFile string      `json:"test_file"`
+	Keys     []string    `json:"keys"`
+	Opt      InspectOpt  `json:"-"`
+	Tables   []TableDiff `json:"tables"`
+	Failures []string    `json:"failures"`
+}
+
+func (r InspectReport) Same() bool {
+	return len(r.Failures) == 0
+}
+
+func compareTableSnapshots(name string, base, test TableSnapshot,
+	opt InspectOpt) TableDiff {
+	rv := TableDiff{Table: name, KeyColumns: base.Columns}
+	allKeys := make(map[string]bool)
+	for k, g := range base.Groups {
+		allKeys[k] = true
+		rv.BaseRows += g.Count
+		rv.BaseNs += g.TotalNs
+	}
+	for k, g := range test.Groups {
+		allKeys[k] = true
+		rv.TestRows += g.Count
+		rv.TestNs += g.TotalNs
+	}
+	for k := range allKeys {
+		b, inBase := base.Groups[k]
+		t, inTest := test.Groups[k]
+		if b == t {
+			rv.SameGroups++
 			continue
 		}
-		if _, ok := rhs[k]; !ok {
-			fmt.Fprintf(out, "  %v is missing for %v\n", k, vObj)
-			isSame = false
-			continue
+		d := GroupDiff{
+			Key:       k,
+			Status:    GroupStatus_Changed,
+			BaseCount: b.Count, TestCount: t.Count,
+			CountPct: deltaPct(float64(b.Count), float64(t.Count)),
+			BaseNs:   b.TotalNs, TestNs: t.TotalNs,
+			DurPct: deltaPct(float64(b.TotalNs), float64(t.TotalNs)),
 		}
-		lset, rset := lhs[k], rhs[k]
-		allPids := make(map[int]bool)
-		for p := range lset {
-			allPids[p] = true
+		if !inTest {
+			d.Status = GroupStatus_Missing
+		} else if !inBase {
+			d.Status = GroupStatus_New
 		}
-		for p := range rset {
-			allPids[p] = true
+		absDelta := d.DeltaNs()
+		if absDelta < 0 {
+			absDelta = -absDelta
 		}
-		diffCount := 0
-		sameCount := 0
-		for p := range allPids {
-			if lset[p] != rset[p] {
-				diffCount++
-				if diffCount < 5 {
-					fmt.Fprintf(out, "  %v Pid(%v) diffs in %v, %v\n", k, p, lset[p], rset[p])
-				}
-			} else {
-				sameCount++
-			}
+		d.Exceeds = math.Abs(d.CountPct) > opt.CountPct ||
+			(math.Abs(d.DurPct) > opt.DurPct && absDelta > int64(opt.DurMinNs))
+		if d.Exceeds {
+			rv.Exceeded++
 		}
-		if diffCount == 0 && sameCount > 0 {
-			fmt.Fprintf(out, "  Entries distribution are the same, %v in all\n",
-				sameCount)
-		} else {
-			fmt.Fprintf(out, "  Same entries count: %v\n", sameCount)
-			fmt.Fprintf(out, "  Diff entries count: %v\n", diffCount)
+		rv.Groups = append(rv.Groups, d)
+	}
+	sort.Slice(rv.Groups, func(i, j int) bool {
+		lhs, rhs := rv.Groups[i], rv.Groups[j]
+		if lhs.Exceeds != rhs.Exceeds {
+			return lhs.Exceeds
 		}
-
-		if diffCount > 0 {
-			isSame = false
+		ld, rd := math.Abs(float64(lhs.DeltaNs())), math.Abs(float64(rhs.DeltaNs()))
+		if ld != rd {
+			return ld > rd
 		}
-	}
-	return isSame
+		return lhs.Key < rhs.Key
+	})
+	return rv
 }
 
-func countElement(distr map[string]map[int]int) int {
-	rv := 0
-	for _, dis := range distr {
-		for _, cc := range dis {
-			rv += cc
+// CompareVpds diffs the tables of test to those of base, the tables are in
+// the order of the options
+func CompareVpds(base, test VpdSnapshot, opt InspectOpt) InspectReport {
+	rv := InspectReport{
+		BaseFile: base.Filename,
+		TestFile: test.Filename,
+		Keys:     opt.Keys,
+		Opt:      opt,
+	}
+	for _, name := range opt.Tables {
+		b, inBase := base.Tables[name]
+		t, inTest := test.Tables[name]
+		switch {
+		case !inBase && !inTest:
+			continue
+		case !inBase || !inTest:
+			diff := TableDiff{Table: name, Missing: base.Filename}
+			if inBase {
+				diff.Missing = test.Filename
+			}
+			rv.Tables = append(rv.Tables, diff)
+			rv.Failures = append(rv.Failures,
+				fmt.Sprintf("%v is missing in %v", name, diff.Missing))
+			continue
+		}
+		diff := compareTableSnapshots(name, b, t, opt)
+		rv.Tables = append(rv.Tables, diff)
+		if diff.Exceeded > 0 {
+			rv.Failures = append(rv.Failures,
+				fmt.Sprintf("%v: %v group(s) differ over the tolerance",
+					name, diff.Exceeded))
 		}
 	}
 	return rv
 }
 
-type CmpRecord struct {
-	TextLog    string
-	Filename   string
-	EntryCount int
+func (r InspectReport) Dump(out io.Writer) {
+	limit := r.Opt.MaxReportLines
+	fmt.Fprintf(out, "# Compare \"%v\" to \"%v\" by %v\n",
+		r.BaseFile, r.TestFile, strings.Join(r.Keys, ","))
+	for _, t := range r.Tables {
+		fmt.Fprintf(out, "\n### %v ###\n", t.Table)
+		if t.Missing != "" {
+			fmt.Fprintf(out, "missing in %v\n", t.Missing)
+			continue
+		}
+		fmt.Fprintf(out, "# key: %v\n", strings.Join(t.KeyColumns, " "))
+		fmt.Fprintf(out, "# rows: %v -> %v, total: %v ns -> %v ns (%+.2f%%)\n",
+			t.BaseRows, t.TestRows, t.BaseNs, t.TestNs,
+			deltaPct(float64(t.BaseNs), float64(t.TestNs)))
+		fmt.Fprintf(out, "# same groups: %v, differing: %v, over tolerance: %v\n",
+			t.SameGroups, len(t.Groups), t.Exceeded)
+		for i, g := range t.Groups {
+			if i >= limit {
+				fmt.Fprintf(out, ".... %v more\n", len(t.Groups)-limit)
+				break
+			}
+			mark := ""
+			if g.Exceeds {
+				mark = " DIFF"
+			}
+			fmt.Fprintf(out, "%q %v: count %v -> %v (%+.2f%%), %v ns -> %v ns (%+.2f%%)%v\n",
+				g.Key, g.Status, g.BaseCount, g.TestCount, g.CountPct,
+				g.BaseNs, g.TestNs, g.DurPct, mark)
+		}
+	}
+	fmt.Fprintf(out, "\n")
+	if r.Same() {
+		fmt.Fprintf(out, "# SAME\n")
+		return
+	}
+	for _, f := range r.Failures {
+		fmt.Fprintf(out, "# DIFF: %v\n", f)
+	}
 }
 
-func InspectMain(files []string, out io.Writer) {
-	var disArr []map[string]map[int]int
-
-	var inspectRes []CmpRecord
-	for i := 0; i < len(files); i++ {
-		textOut := bytes.NewBuffer(nil)
-		dis := InspectXdma(textOut, files[i])
-		disArr = append(disArr, dis)
-		inspectRes = append(inspectRes, CmpRecord{
-			TextLog:    textOut.String(),
-			Filename:   files[i],
-			EntryCount: countElement(dis),
-		})
+// InspectMain compares the vpd(s) to the first one, as text or as JSON
+// array of the reports. It returns false if any differs over tolerance,
+// which dmaster exits 1 on; the DMA VC report before it always exited 0.
+func InspectMain(files []string, opt InspectOpt, asJSON bool,
+	out io.Writer) (bool, error) {
+	if err := opt.validate(); err != nil {
+		return false, err
 	}
-
-	anyDiff := false
-	n := len(disArr)
-	for i := 0; i < n; i++ {
-		u := files[i]
-		us := disArr[i]
-		for j := i + 1; j < n; j++ {
-			v := files[j]
-			vs := disArr[j]
-			textOut := bytes.NewBuffer(nil)
-			fmt.Fprintf(textOut, "# Compare \"%v\" to \"%v\"\n", u, v)
-			isEqual := compareDicts(u, v, us, vs, textOut)
-			if isEqual {
-				fmt.Fprintf(out, "# \"%v\" and \"%v\" are the same, in %v entries\n", u, v, inspectRes[i].EntryCount)
-			} else {
-				anyDiff = true
-				fmt.Fprint(out, textOut.String())
-			}
+	if len(files) < 2 {
+		return false, fmt.Errorf("at least 2 vpd files are required to compare")
+	}
+	base, err := LoadVpdSnapshot(files[0], opt)
+	if err != nil {
+		return false, err
+	}
+	same := true
+	var reports []InspectReport
+	for _, f := range files[1:] {
+		test, err := LoadVpdSnapshot(f, opt)
+		if err != nil {
+			return false, err
+		}
+		report := CompareVpds(base, test, opt)
+		same = same && report.Same()
+		if asJSON {
+			reports = append(reports, report)
+		} else {
+			report.Dump(out)
 		}
 	}
-
-	if anyDiff {
-		for _, res := range inspectRes {
-			fmt.Fprintf(out, "# Res for %v\n", res.Filename)
-			fmt.Fprint(out, res.TextLog)
+	if asJSON {
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(reports); err != nil {
+			return false, err
 		}
 	}
+	return same, nil
 }
@@ -0,0 +1,228 @@
+package inspector
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"git.enflame.cn/hai.bai/dmaster/codec"
+	"git.enflame.cn/hai.bai/dmaster/dbexport"
+	"git.enflame.cn/hai.bai/dmaster/rtinfo"
+	"git.enflame.cn/hai.bai/dmaster/rtinfo/rtdata"
+)
+
+func newInspectVpd(t *testing.T, name string, kernelNs []int) string {
+	target := filepath.Join(t.TempDir(), name)
+	dbs, err := dbexport.NewDbSession(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dbs.Close()
+	db, err := sql.Open("sqlite3", target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	for i, ns := range kernelNs {
+		if _, err := db.Exec(`insert into kernel(idx, name, op_id,
+			engine_type, cluster_id, engine_id, duration_timestamp)
+			values(?, 'conv', 3, 'SIP', 0, ?, ?)`, i, i%2, ns); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return target
+}
+
+func TestInspectTables(t *testing.T) {
+	base := newInspectVpd(t, "base.vpd", []int{1000, 1000, 1000})
+	same := newInspectVpd(t, "same.vpd", []int{1000, 1000, 1000})
+	slow := newInspectVpd(t, "slow.vpd", []int{1000, 1000, 5000})
+
+	opt := DefaultInspectOpt()
+	opt.Keys = []string{CompareKey_Engine}
+	ok, err := InspectMain([]string{base, same}, opt, false, &bytes.Buffer{})
+	if err != nil || !ok {
+		t.Fatalf("expecting the same, got %v, %v", ok, err)
+	}
+
+	out := &bytes.Buffer{}
+	ok, err = InspectMain([]string{base, slow}, opt, true, out)
+	if err != nil || ok {
+		t.Fatalf("expecting differing, got %v, %v", ok, err)
+	}
+	var reports []InspectReport
+	if err := json.Unmarshal(out.Bytes(), &reports); err != nil {
+		t.Fatal(err)
+	}
+	var kernel TableDiff
+	for _, diff := range reports[0].Tables {
+		if diff.Table == "kernel" {
+			kernel = diff
+		} else if len(diff.Groups) > 0 {
+			t.Errorf("%v: expecting no differing group, got %v",
+				diff.Table, diff.Groups)
+		}
+	}
+	// Engine 0 has kernels 0 and 2
+	if len(kernel.Groups) != 1 || kernel.SameGroups != 1 ||
+		kernel.Groups[0].Key != "SIP 0 0" || !kernel.Groups[0].Exceeds ||
+		kernel.Groups[0].BaseNs != 2000 || kernel.Groups[0].TestNs != 6000 {
+		t.Errorf("unexpected kernel diff: %+v", kernel)
+	}
+
+	opt.Keys = []string{"vc"}
+	if _, err := InspectMain([]string{base, same}, opt, false, out); err == nil {
+		t.Errorf("expecting error of unknown key")
+	}
+}
+
+// The kernels are named by the dump, "SIP Act.<seq>" without an op name
+func newDumpedVpd(t *testing.T, name string, kernelNs []uint64) string {
+	target := filepath.Join(t.TempDir(), name)
+	dbs, err := dbexport.NewDbSession(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var acts []rtdata.KernelActivity
+	var start uint64
+	for _, ns := range kernelNs {
+		acts = append(acts, rtdata.KernelActivity{DpfAct: rtdata.DpfAct{
+			Start: codec.DpfEvent{EngineTypeCode: codec.EngCat_SIP, Cycle: start},
+			End:   codec.DpfEvent{EngineTypeCode: codec.EngCat_SIP, Cycle: start + ns},
+		}})
+		start += ns
+	}
+	dbs.DumpKernelActs(rtdata.Coords{}, acts, &rtinfo.TimelineManager{}, "SIP")
+	dbs.Close()
+	return target
+}
+
+func TestInspectIndexedNames(t *testing.T) {
+	base := newDumpedVpd(t, "base.vpd", []uint64{1000, 1000, 1000})
+	same := newDumpedVpd(t, "same.vpd", []uint64{1000, 1000, 1000})
+	more := newDumpedVpd(t, "more.vpd", []uint64{1000, 1000, 1000, 1000})
+
+	opt := DefaultInspectOpt()
+	opt.Tables = []string{"kernel"}
+	ok, err := InspectMain([]string{base, same}, opt, false, &bytes.Buffer{})
+	if err != nil || !ok {
+		t.Fatalf("expecting the same, got %v, %v", ok, err)
+	}
+
+	baseSnap, err := LoadVpdSnapshot(base, opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	moreSnap, err := LoadVpdSnapshot(more, opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kernel := CompareVpds(baseSnap, moreSnap, opt).Tables[0]
+	// One more kernel of the same name, not a new group of its own
+	if len(kernel.Groups) != 1 || kernel.SameGroups != 0 ||
+		kernel.Groups[0].Key != "SIP Act" ||
+		kernel.Groups[0].Status != GroupStatus_Changed ||
+		kernel.Groups[0].BaseCount != 3 || kernel.Groups[0].TestCount != 4 {
+		t.Errorf("unexpected kernel diff: %+v", kernel)
+	}
+}
+
+func TestTrimNameIndex(t *testing.T) {
+	for name, expected := range map[string]string{
+		"conv.3.12":  "conv.3",
+		"SIP Act.0":  "SIP Act",
+		"Task.2 0x1": "Task.2 0x1",
+		"conv.":      "conv.",
+		"conv":       "conv",
+	} {
+		if got := trimNameIndex(name); got != expected {
+			t.Errorf("%q: expecting %q, got %q", name, expected, got)
+		}
+	}
+}
+
+func newMemcpyVpd(t *testing.T, name string, tilings []string) string {
+	target := filepath.Join(t.TempDir(), name)
+	dbs, err := dbexport.NewDbSession(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dbs.Close()
+	db, err := sql.Open("sqlite3", target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	for i, tiling := range tilings {
+		if _, err := db.Exec(`insert into memcpy(idx, name, engine_type,
+			cluster_id, engine_id, tiling_mode, duration_timestamp)
+			values(?, 'DMA VC', 'CDMA', 0, 0, NULLIF(?, ''), 100),
+			(?, 'DMA BUSY', 'CDMA', 0, 0, 'slice', 100)`,
+			2*i, tiling, 2*i+1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return target
+}
+
+func TestInspectTilingMode(t *testing.T) {
+	base := newMemcpyVpd(t, "base.vpd", []string{"slice", "slice", "transpose"})
+	test := newMemcpyVpd(t, "test.vpd", []string{"slice", "slice", ""})
+
+	opt := DefaultInspectOpt()
+	opt.Tables = []string{"memcpy"}
+	opt.Keys = []string{CompareKey_Engine, CompareKey_TilingMode}
+	opt.NameLike = "DMA VC%"
+	baseSnap, err := LoadVpdSnapshot(base, opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testSnap, err := LoadVpdSnapshot(test, opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The DMA BUSY rows are left out, the DMA without meta has no tiling
+	memcpy := CompareVpds(baseSnap, testSnap, opt).Tables[0]
+	if memcpy.BaseRows != 3 || memcpy.SameGroups != 1 || len(memcpy.Groups) != 2 {
+		t.Fatalf("unexpected memcpy diff: %+v", memcpy)
+	}
+	statuses := map[string]string{}
+	for _, g := range memcpy.Groups {
+		statuses[g.Key] = g.Status
+	}
+	if statuses["CDMA 0 0 transpose"] != GroupStatus_Missing ||
+		statuses["CDMA 0 0 "] != GroupStatus_New {
+		t.Errorf("unexpected groups: %v", statuses)
+	}
+}
+
+func TestInspectLeavesVpdUnchanged(t *testing.T) {
+	base := newInspectVpd(t, "base.vpd", []int{1000})
+	db, err := sql.Open("sqlite3", base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	older := dbexport.CurrentSchemaVersion() - 1
+	if _, err := db.Exec(`update schema_version set version = ?`, older); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := LoadVpdSnapshot(base, DefaultInspectOpt()); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := dbexport.DetectSchemaVersion(db); err != nil || v != older {
+		t.Errorf("expecting the vpd left at %v, got %v: %v", older, v, err)
+	}
+
+	missing := filepath.Join(t.TempDir(), "typo.vpd")
+	if _, err := LoadVpdSnapshot(missing, DefaultInspectOpt()); err == nil {
+		t.Errorf("expecting error of a missing vpd")
+	}
+	if _, err := os.Stat(missing); err == nil {
+		t.Errorf("expecting no file left for a missing vpd")
+	}
+}
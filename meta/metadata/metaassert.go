@@ -0,0 +1,70 @@
+package metadata
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// KernelAssertInfo is one clause of SHT_KERN_ASSERT_INFO
+type KernelAssertInfo struct {
+	CauseId int
+	SrcFile string
+	LineNo  int
+	UserMsg string
+}
+
+func (k KernelAssertInfo) String() string {
+	return fmt.Sprintf("%v:%v: %v", k.SrcFile, k.LineNo, k.UserMsg)
+}
+
+// Cause id to clauses, a cause id may be duplicated
+type KernelAssertDict map[int][]KernelAssertInfo
+
+// KernelAssertFileName is named with the full exec uuid,
+// not the higher 32 bits as the other meta files
+func KernelAssertFileName(execUuid uint64) string {
+	return fmt.Sprintf("0x%016x_assert.pbdumptxt", execUuid)
+}
+
+// The text line in *_assert.pbdumptxt
+//
+//	12 "user message,some/kernel.cc,305"
+func FormatKernelAssertLine(k KernelAssertInfo) string {
+	return fmt.Sprintf("%v \"%v,%v,%v\"", k.CauseId, k.UserMsg, k.SrcFile, k.LineNo)
+}
+
+// The user message may have commas, file and line are taken from the tail
+func ParseKernelAssertLine(line string) (KernelAssertInfo, bool) {
+	vs := strings.SplitN(strings.TrimSpace(line), " ", 2)
+	if len(vs) != 2 {
+		return KernelAssertInfo{}, false
+	}
+	causeId, err := strconv.Atoi(vs[0])
+	if err != nil {
+		return KernelAssertInfo{}, false
+	}
+	body := strings.TrimSpace(vs[1])
+	if len(body) < 2 || body[0] != '"' || body[len(body)-1] != '"' {
+		return KernelAssertInfo{}, false
+	}
+	body = body[1 : len(body)-1]
+	lineIdx := strings.LastIndex(body, ",")
+	if lineIdx < 0 {
+		return KernelAssertInfo{}, false
+	}
+	lineNo, err := strconv.Atoi(body[lineIdx+1:])
+	if err != nil {
+		return KernelAssertInfo{}, false
+	}
+	fileIdx := strings.LastIndex(body[:lineIdx], ",")
+	if fileIdx < 0 {
+		return KernelAssertInfo{}, false
+	}
+	return KernelAssertInfo{
+		CauseId: causeId,
+		SrcFile: body[fileIdx+1 : lineIdx],
+		LineNo:  lineNo,
+		UserMsg: body[:fileIdx],
+	}, true
+}
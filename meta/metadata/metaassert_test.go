@@ -0,0 +1,22 @@
+package metadata
+
+import (
+	"testing"
+)
+
+func TestKernelAssertLine(t *testing.T) {
+	info := KernelAssertInfo{
+		CauseId: 12,
+		SrcFile: "kernel/conv.cc",
+		LineNo:  305,
+		UserMsg: "bad shape, dim=3",
+	}
+	line := FormatKernelAssertLine(info)
+	parsed, ok := ParseKernelAssertLine(line)
+	if !ok || parsed != info {
+		t.Errorf("expecting %v, got %v from %v", info, parsed, line)
+	}
+	if _, ok := ParseKernelAssertLine("12 \"no line\""); ok {
+		t.Errorf("must fail without line number")
+	}
+}
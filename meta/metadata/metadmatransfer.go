@@ -0,0 +1,205 @@
+package metadata
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// DmaMemRef is the decoded form of the input/output of a dma op, like
+//
+//	memref<5x5x1x32xf32, 1>
+//	memref<?xf32, affine_map<(d0)[s0] -> (d0 + s0)>, 3>
+//	!dtu.tensor<32x1x5x5xf32:L3>
+type DmaMemRef struct {
+	Shape     []int // -1 for dynamic dim
+	ElemType  string
+	ElemBytes int
+	MemLevel  int // 0 if unknown
+}
+
+func (m DmaMemRef) IsDynamic() bool {
+	for _, dim := range m.Shape {
+		if dim < 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func (m DmaMemRef) Bytes() (int64, bool) {
+	if m.ElemBytes <= 0 || m.IsDynamic() {
+		return 0, false
+	}
+	rv := int64(m.ElemBytes)
+	for _, dim := range m.Shape {
+		rv *= int64(dim)
+	}
+	return rv, true
+}
+
+func (m DmaMemRef) LevelString() string {
+	if m.MemLevel <= 0 {
+		return "L?"
+	}
+	return fmt.Sprintf("L%v", m.MemLevel)
+}
+
+// f32 -> 4, bf16 -> 2, i1 -> 1, index is taken as 64 bits
+func elemTypeBytes(elemType string) int {
+	if elemType == "index" {
+		return 8
+	}
+	pos := strings.LastIndexFunc(elemType, func(r rune) bool {
+		return r < '0' || r > '9'
+	})
+	bits, err := strconv.Atoi(elemType[pos+1:])
+	if err != nil || bits <= 0 {
+		return 0
+	}
+	return (bits + 7) / 8
+}
+
+// "5x5x1x32xf32", the last one is element type
+func parseShapeAndType(text string) ([]int, string, bool) {
+	vs := strings.Split(strings.TrimSpace(text), "x")
+	if len(vs) < 1 || vs[len(vs)-1] == "" {
+		return nil, "", false
+	}
+	var shape []int
+	for _, v := range vs[:len(vs)-1] {
+		if v == "?" {
+			shape = append(shape, -1)
+			continue
+		}
+		dim, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, "", false
+		}
+		shape = append(shape, dim)
+	}
+	return shape, vs[len(vs)-1], true
+}
+
+func parseMemLevel(text string) int {
+	text = strings.TrimPrefix(strings.TrimSpace(text), "L")
+	if level, err := strconv.Atoi(text); err == nil {
+		return level
+	}
+	return 0
+}
+
+func ParseDmaMemRef(text string) (DmaMemRef, bool) {
+	text = strings.TrimSpace(text)
+	var shapeText, levelText string
+	switch {
+	case strings.HasPrefix(text, "memref<") && strings.HasSuffix(text, ">"):
+		body := text[len("memref<") : len(text)-1]
+		// The layout may have commas, level comes last anyway
+		first := strings.Index(body, ",")
+		if first < 0 {
+			shapeText = body
+		} else {
+			shapeText = body[:first]
+			levelText = body[strings.LastIndex(body, ",")+1:]
+		}
+	case strings.HasPrefix(text, "!dtu.tensor<") && strings.HasSuffix(text, ">"):
+		body := text[len("!dtu.tensor<") : len(text)-1]
+		vs := strings.SplitN(body, ":", 2)
+		shapeText = vs[0]
+		if len(vs) == 2 {
+			levelText = vs[1]
+		}
+	default:
+		return DmaMemRef{}, false
+	}
+	shape, elemType, ok := parseShapeAndType(shapeText)
+	if !ok {
+		return DmaMemRef{}, false
+	}
+	return DmaMemRef{
+		Shape:     shape,
+		ElemType:  elemType,
+		ElemBytes: elemTypeBytes(elemType),
+		MemLevel:  parseMemLevel(levelText),
+	}, true
+}
+
+type DmaTransfer struct {
+	Src, Dst           DmaMemRef
+	SrcValid, DstValid bool
+	SrcSize, DstSize   int64 // 0 if unknown
+	SrcAddr, DstAddr   int64
+	AddrValid          bool
+	Direction          string
+}
+
+// Bytes moved, the smaller side is taken for slice/deslice alike
+func (t DmaTransfer) Bytes() (int64, bool) {
+	switch {
+	case t.SrcSize > 0 && t.DstSize > 0:
+		if t.SrcSize < t.DstSize {
+			return t.SrcSize, true
+		}
+		return t.DstSize, true
+	case t.SrcSize > 0:
+		return t.SrcSize, true
+	case t.DstSize > 0:
+		return t.DstSize, true
+	}
+	return 0, false
+}
+
+// Text format keeps input/output in fields, pb format keeps them in attrs
+func (d DmaOp) lookupAttr(field string, key string) string {
+	if field != "" {
+		return field
+	}
+	return d.Attrs[key]
+}
+
+func parseAddrAttr(text string) (int64, bool) {
+	addr, err := strconv.ParseInt(strings.TrimSpace(text), 0, 64)
+	return addr, err == nil
+}
+
+// dir is kept in attrs directly, or in dma_attrs for pb format
+func (d DmaOp) dirAttr() (string, bool) {
+	if dir, ok := d.Attrs["dir"]; ok {
+		return dir, true
+	}
+	for _, chunk := range strings.Split(d.Attrs["dma_attrs"], ",") {
+		vs := strings.Split(strings.TrimSpace(chunk), "=")
+		if len(vs) == 2 && vs[0] == "dir" {
+			return vs[1], true
+		}
+	}
+	return "", false
+}
+
+func (d DmaOp) GetTransfer() DmaTransfer {
+	var rv DmaTransfer
+	rv.Src, rv.SrcValid = ParseDmaMemRef(d.lookupAttr(d.Input, "input"))
+	rv.Dst, rv.DstValid = ParseDmaMemRef(d.lookupAttr(d.Output, "output"))
+	if rv.SrcValid {
+		rv.SrcSize, _ = rv.Src.Bytes()
+	}
+	if rv.DstValid {
+		rv.DstSize, _ = rv.Dst.Bytes()
+	}
+	srcAddr, srcOK := parseAddrAttr(d.Attrs["src_addr"])
+	dstAddr, dstOK := parseAddrAttr(d.Attrs["dst_addr"])
+	if srcOK && dstOK {
+		rv.SrcAddr, rv.DstAddr, rv.AddrValid = srcAddr, dstAddr, true
+	}
+	switch {
+	case rv.SrcValid && rv.DstValid &&
+		(rv.Src.MemLevel > 0 || rv.Dst.MemLevel > 0):
+		rv.Direction = rv.Src.LevelString() + "->" + rv.Dst.LevelString()
+	default:
+		if dir, ok := d.dirAttr(); ok {
+			rv.Direction = "dir" + dir
+		}
+	}
+	return rv
+}
@@ -0,0 +1,45 @@
+package metadata
+
+import (
+	"testing"
+)
+
+func TestDmaTransferParse(t *testing.T) {
+	dmaOp := DmaOp{
+		DmaOpString: "factor.LinearCopy, factor.Slice",
+		Input:       "memref<1344x40xf32, 1>",
+		Output:      "memref<28x40xf32, 2>",
+		Attrs:       map[string]string{"dir": "1"},
+	}
+	tr := dmaOp.GetTransfer()
+	if tr.SrcSize != 1344*40*4 || tr.DstSize != 28*40*4 {
+		t.Errorf("unexpected size: %v %v", tr.SrcSize, tr.DstSize)
+	}
+	if bytes, ok := tr.Bytes(); !ok || bytes != 28*40*4 {
+		t.Errorf("unexpected bytes: %v", bytes)
+	}
+	if tr.Direction != "L1->L2" {
+		t.Errorf("unexpected direction: %v", tr.Direction)
+	}
+
+	// pb format, dynamic shape
+	dmaOp = DmaOp{
+		Attrs: map[string]string{
+			"dma_attrs": "dir=2, src_compressed=0, dst_decompressed=0",
+			"input":     "memref<?xf32, affine_map<(d0)[s0] -> (d0 + s0)>, 3>",
+			"output":    "!dtu.tensor<32x1x5x5xbf16:L2>",
+		},
+	}
+	tr = dmaOp.GetTransfer()
+	if !tr.SrcValid || tr.SrcSize != 0 || tr.Src.MemLevel != 3 {
+		t.Errorf("unexpected src: %+v", tr.Src)
+	}
+	if tr.DstSize != 32*5*5*2 || tr.Direction != "L3->L2" {
+		t.Errorf("unexpected dst: %v %v", tr.DstSize, tr.Direction)
+	}
+
+	if tr = (DmaOp{Input: "unk", Output: "unk"}).GetTransfer(); tr.SrcValid ||
+		tr.Direction != "" {
+		t.Errorf("unk must be invalid: %+v", tr)
+	}
+}
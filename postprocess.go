@@ -1,8 +1,11 @@
 package main
 
 import (
+	"bytes"
 	"fmt"
+	"io"
 	"log"
+	"os"
 	"time"
 
 	"git.enflame.cn/hai.bai/dmaster/codec"
@@ -12,6 +15,7 @@ import (
 	"git.enflame.cn/hai.bai/dmaster/meta"
 	"git.enflame.cn/hai.bai/dmaster/rtinfo"
 	"git.enflame.cn/hai.bai/dmaster/rtinfo/rtdata"
+	"git.enflame.cn/hai.bai/dmaster/sess"
 	"git.enflame.cn/hai.bai/dmaster/topsdev/mimic/mimicdefs"
 	"git.enflame.cn/hai.bai/dmaster/vgrule"
 )
@@ -24,6 +28,8 @@ type PostProcessOpt struct {
 	NoSubop       bool
 	DumpOpDebug   bool
 	CpuOps        []rtdata.CpuOpAct
+	TimelineMap   rtinfo.TimelineMapMode
+	ReportDir     string // text reports of the device, none if empty
 }
 
 type PostProcessor struct {
@@ -33,6 +39,7 @@ type PostProcessor struct {
 	dmaVec    *rtdata.EventQueue
 	taskVec   *rtdata.EventQueue
 	kernelVec *rtdata.EventQueue
+	assertQ   *rtinfo.KernelAssertQueue
 	tm        *rtinfo.TimelineManager
 
 	curAlgo vgrule.ActMatchAlgo
@@ -44,6 +51,41 @@ type PostProcessor struct {
 	subOps     []rtdata.KernelActivity
 	taskActMap map[int]rtdata.FwActivity
 	hostInfo   mimicdefs.HostInfo
+	opCoverage rtinfo.OpCoverageReport
+	critPaths  []rtinfo.TaskCriticalPath
+	util       rtinfo.UtilizationReport
+	dmaCooked  rtinfo.DmaCookResult
+	subAttrib  rtinfo.SubOpAttribReport
+	wildIn     []rtdata.OpActivity // left over by GenerateDtuOps
+	wildAttrib rtinfo.WildAttribReport
+	asserts    rtinfo.KernelAssertReport
+	decodeStat sess.DecodeStat
+	flows      []rtinfo.FlowLink
+	counters   []rtinfo.CounterTrack
+}
+
+// Reports of the devices are told apart by the device order
+func (p PostProcessor) dumpReport(name string, dump func(io.Writer)) {
+	writeReport(p.procOpt.ReportDir,
+		fmt.Sprintf("dev%v_%v", p.procOpt.SeqIdx, name), dump)
+}
+
+func (p PostProcessor) dumpOpCoverage() {
+	for _, out := range []struct {
+		name  string
+		write func(io.Writer) error
+	}{
+		{"opcoverage.json", p.opCoverage.WriteJSON},
+		{"opcoverage_task.csv", p.opCoverage.WriteTaskCSV},
+		{"opcoverage_exec.csv", p.opCoverage.WriteExecCSV},
+	} {
+		write, name := out.write, out.name
+		p.dumpReport(name, func(fout io.Writer) {
+			if err := write(fout); err != nil {
+				log.Printf("error write %v: %v", name, err)
+			}
+		})
+	}
 }
 
 type DumpOpt struct {
@@ -76,6 +118,7 @@ func NewPostProcesser(loader efintf.InfoReceiver,
 	tm := rtinfo.NewTimelineManager(
 		rtinfo.TimeLineManagerOpt{
 			EnableExtendedTimeline: enableExtendedTimeline,
+			MapMode:                ppOpt.TimelineMap,
 		})
 	tm.LoadTimepoints(loader)
 
@@ -93,6 +136,7 @@ func NewPostProcesser(loader efintf.InfoReceiver,
 		dmaVec:    dmaVec,
 		taskVec:   taskVec,
 		kernelVec: kernelVec,
+		assertQ:   rtinfo.NewKernelAssertQueue(),
 		tm:        tm,
 		procOpt:   ppOpt,
 		hostInfo:  hostInfo,
@@ -112,6 +156,7 @@ func (p PostProcessor) GetSinkers(
 		p.qm,
 		p.fwVec,
 		p.tm,
+		p.assertQ,
 	}
 	if !dopts.NoDma {
 		rv = append(rv, p.dmaVec)
@@ -130,6 +175,7 @@ func (p PostProcessor) GetConcurSinkers(
 		p.qm,
 		p.fwVec,
 		p.tm,
+		p.assertQ,
 	}
 	if !dopts.NoDma {
 		rv = append(rv, p.dmaVec)
@@ -144,6 +190,11 @@ type DbDumper interface {
 	DumpHostInfo(
 		hostInfo mimicdefs.HostInfo,
 	)
+	// Before the activities of the device, which are the ends of links
+	DumpFlows(
+		coords rtdata.Coords,
+		links []rtinfo.FlowLink,
+	)
 	DumpDtuOps(
 		coords rtdata.Coords,
 		bundle []rtdata.OpActivity,
@@ -163,7 +214,7 @@ type DbDumper interface {
 	)
 	DumpDmaActs(
 		coords rtdata.Coords,
-		bundle []rtdata.DmaActivity,
+		bundle []rtdata.CookedDmaActivity,
 		tm *rtinfo.TimelineManager,
 	)
 	DumpKernelActs(
@@ -177,14 +228,56 @@ type DbDumper interface {
 		cpuOps []rtdata.CpuOpAct,
 		rowName string,
 	)
+	DumpOpCoverage(
+		coords rtdata.Coords,
+		coverage rtinfo.OpCoverageReport,
+	)
+	DumpCriticalPaths(
+		coords rtdata.Coords,
+		paths []rtinfo.TaskCriticalPath,
+		tm *rtinfo.TimelineManager,
+	)
+	DumpUtilization(
+		coords rtdata.Coords,
+		report rtinfo.UtilizationReport,
+		tm *rtinfo.TimelineManager,
+	)
+	DumpKernelAsserts(
+		coords rtdata.Coords,
+		report rtinfo.KernelAssertReport,
+		tm *rtinfo.TimelineManager,
+	)
+	DumpCounters(
+		coords rtdata.Coords,
+		tracks []rtinfo.CounterTrack,
+		tm *rtinfo.TimelineManager,
+	)
+}
+
+// WildOpDumper is implemented by the trace outputs only, the wild ops
+// are put onto the debug rows named by the generator
+type WildOpDumper interface {
+	DumpWildOps(
+		coords rtdata.Coords,
+		bundle []rtdata.OpActivity,
+		tm *rtinfo.TimelineManager,
+		evtG dbexport.EventTraceItemGen,
+	)
 }
 
+// DumpToDb only reads the results of the processing. It runs more than
+// once for a device, into the vpd stages and then into the traces,
+// so it must stay free of side effects on the processor and its inputs.
 func (p PostProcessor) DumpToDb(coord rtdata.Coords,
 	dOpt DumpOpt, dbe DbDumper) {
 
 	dbe.DumpHostInfo(
 		p.hostInfo,
 	)
+	dbe.DumpFlows(
+		coord,
+		p.flows,
+	)
 
 	dbe.DumpDtuOps(
 		coord,
@@ -212,7 +305,7 @@ func (p PostProcessor) DumpToDb(coord rtdata.Coords,
 	)
 	dbe.DumpDmaActs(
 		coord,
-		p.dmaVec.DmaActivity(), p.tm,
+		p.dmaCooked.Acts, p.tm,
 	)
 	dbe.DumpKernelActs(
 		coord,
@@ -226,6 +319,38 @@ func (p PostProcessor) DumpToDb(coord rtdata.Coords,
 			"SIP BUSY",
 		)
 	}
+	dbe.DumpOpCoverage(
+		coord,
+		p.opCoverage,
+	)
+	dbe.DumpCriticalPaths(
+		coord,
+		p.critPaths, p.tm,
+	)
+	dbe.DumpUtilization(
+		coord,
+		p.util, p.tm,
+	)
+	dbe.DumpKernelAsserts(
+		coord,
+		p.asserts, p.tm,
+	)
+	dbe.DumpCounters(
+		coord,
+		p.counters, p.tm,
+	)
+	if wd, ok := dbe.(WildOpDumper); ok {
+		wd.DumpWildOps(
+			coord,
+			p.wildIn, p.tm,
+			&wildInDumper{},
+		)
+		wd.DumpWildOps(
+			coord,
+			p.wildAttrib.OpActivity(), p.tm,
+			newWildOutDumper(p.wildAttrib),
+		)
+	}
 }
 
 func (p *PostProcessor) DoPostProcessing() {
@@ -238,10 +363,11 @@ func (p *PostProcessor) DoPostProcessing() {
 	if p.tm.Verify() {
 		log.Printf("timeline aligned verified successfully")
 	} else {
-		log.Printf("timeline aligned verified error")
-		panic("shall stop")
+		// Shall not happen after cleaning, carry on anyway
+		log.Printf("warning: timeline aligned verified error")
 	}
 	p.tm.DumpInfo()
+	p.dumpReport("syncpoints_fit.txt", p.tm.GetFitReport().Dump)
 
 	if p.rtDict != nil {
 		p.rtDict.ProcessTaskActVector(p.taskVec.TaskActivity())
@@ -250,8 +376,6 @@ func (p *PostProcessor) DoPostProcessing() {
 		p.rtDict.DumpInfo()
 		meta.TestExecRaw(p.rtDict.GetExecRaw())
 
-		var tr dbexport.TraceEventSession
-
 		// Generate op runtime info
 		dtuOps, unProcessed := p.rtDict.GenerateDtuOps(p.qm.OpActivity(),
 			p.curAlgo)
@@ -259,10 +383,23 @@ func (p *PostProcessor) DoPostProcessing() {
 
 		var subOps []rtdata.KernelActivity
 		if !p.procOpt.NoSubop {
-			subOps = p.rtDict.GenerateKernelActs(
+			subOps, p.subAttrib = p.rtDict.GenerateKernelActs(
 				p.kernelVec.KernelActivity(),
 				p.qm.OpActivity(),
 				p.curAlgo)
+			log.Printf("# %v low confidence sub op attribution(s)",
+				len(p.subAttrib.LowConfidence))
+			p.dumpReport("subop_attribution.txt", p.subAttrib.Dump)
+		}
+
+		// Kernel asserts with the op context of sub ops
+		p.asserts = p.rtDict.ResolveKernelAsserts(p.assertQ.Events(),
+			p.loader,
+			subOps,
+			p.curAlgo)
+		if len(p.asserts.Asserts) > 0 {
+			p.asserts.Dump(os.Stdout)
+			p.dumpReport("kernel_assert.txt", p.asserts.Dump)
 		}
 
 		// Generate task timeline(depends on OPs information)
@@ -274,13 +411,12 @@ func (p *PostProcessor) DoPostProcessing() {
 
 		p.dtuOps = dtuOps
 		p.subOps = subOps
-		var wildProcess []rtdata.OpActivity
-		if false {
-			p.rtDict.OvercookCqm(unProcessed, p.curAlgo)
-			wildProcess = p.rtDict.WildCookCqm(unProcessed)
-		} else {
-			p.rtDict.CookCqmEverSince(unProcessed, p.curAlgo)
-		}
+		p.wildIn = unProcessed
+		p.wildAttrib = p.rtDict.AttributeWildCqm(
+			p.rtDict.CookCqmEverSince(unProcessed, p.curAlgo),
+			dtuOps)
+		p.wildAttrib.DumpInfo()
+		p.dumpReport("wild_attribution.txt", p.wildAttrib.Dump)
 
 		dumpFullCycles(dtuOps)
 
@@ -288,42 +424,34 @@ func (p *PostProcessor) DoPostProcessing() {
 			// Only valid for vg mode
 			// There is no true One-Task session.
 			// There is only session with a bundle of task without host trace
-			rtinfo.GenerateBriefOpsStat(
+			tasklist := &bytes.Buffer{}
+			p.opCoverage = rtinfo.GenerateBriefOpsStat(
 				p.rtDict.FindExecFor,
 				dtuOps,
 				p.taskActMap,
 				p.rtDict.GetOrderedTaskVec(),
 				p.rtDict.CopyTaskVec(),
+				tasklist,
 			)
+			p.dumpReport("tasklist.txt", func(fout io.Writer) {
+				fout.Write(tasklist.Bytes())
+			})
+			p.dumpOpCoverage()
 		}
 
 		if p.procOpt.DumpOpDebug {
 			DumpOpsToPythonDebugCode(dtuOps)
 		}
 
-		tr.DumpTaskVec(p.taskActMap,
-			p.rtDict.GetOrderedTaskVec(),
-			p.tm,
-		)
-
-		tr.DumpToEventTrace(dtuOps, p.tm,
-			NewNormalDumper(),
-			true,
-		)
-		wildInDumper0 := wildInDumper{}
-		tr.DumpToEventTrace(unProcessed, p.tm,
-			&wildInDumper0,
-			false,
-		)
-		wildOutDumper0 := wildOutDumper{}
-		tr.DumpToEventTrace(wildProcess, p.tm,
-			&wildOutDumper0,
-			false,
-		)
-		fmt.Printf("# notWildInCount: %v\n", wildInDumper0.notWildInCount)
+		notWildInCount := 0
+		for _, act := range unProcessed {
+			if !act.IsOpRefValid() {
+				notWildInCount++
+			}
+		}
+		fmt.Printf("# notWildInCount: %v\n", notWildInCount)
 		fmt.Printf("# uncertained (could not detmerined at all): %v\n",
-			len(wildProcess))
-		tr.DumpToFile("dtuop_trace.json")
+			p.wildAttrib.ByAmbiguity[rtinfo.WildAmbiguity_NoCandidate])
 
 		startDmaTs := time.Now()
 
@@ -333,10 +461,45 @@ func (p *PostProcessor) DoPostProcessing() {
 				fmt.Printf("DMA events up to %v are safely ignored\n", ignoreCount)
 			}
 		}
-		p.rtDict.CookDma(p.dmaVec.DmaActivity(), p.curAlgo)
+		p.dmaCooked = p.rtDict.CookDma(p.dmaVec.DmaActivity(),
+			dtuOps,
+			p.curAlgo)
 
 		fmt.Printf("dma cook and save to db cost %v\n", time.Since(startDmaTs))
 
+		// Launch -> executable -> ops -> DMAs and sub ops
+		p.flows = rtinfo.GenerateFlowLinks(p.fwVec.FwActivity(),
+			p.taskActMap,
+			dtuOps,
+			p.dmaCooked.Acts,
+			subOps,
+		)
+		log.Printf("# %v flow link(s)", len(p.flows))
+
+		// Depends on DMA meta, which is ready only after cooking
+		p.critPaths = rtinfo.GenerateCriticalPaths(dtuOps,
+			subOps,
+			p.dmaCooked.DmaActivity(),
+			p.taskActMap,
+		)
+		p.dumpReport("criticalpath.txt", func(fout io.Writer) {
+			rtinfo.DumpCriticalPaths(fout, p.critPaths)
+		})
+
+		p.util = rtinfo.GenerateUtilization(p.curAlgo,
+			p.kernelVec.KernelActivity(),
+			dtuOps,
+			p.dmaCooked.DmaActivity(),
+			p.fwVec.FwActivity(),
+			p.taskActMap,
+		)
+		p.dumpReport("utilization.txt", p.util.Dump)
+
+		p.counters = rtinfo.GenerateActivityCounters(p.dmaCooked.Acts,
+			subOps,
+			p.tm,
+		)
+
 	}
 }
 
@@ -366,3 +529,27 @@ func (ps PostProcessors) Less(i, j int) bool {
 func (ps PostProcessors) Swap(i, j int) {
 	ps[i], ps[j] = ps[j], ps[i]
 }
+
+// AlignDevices places all devices onto the shared host timeline
+// Device id is assigned by order, the same as it is dumped
+func (ps PostProcessors) AlignDevices(correct bool) rtinfo.MultiDeviceAlignReport {
+	var devs []rtinfo.DeviceTimeline
+	var cpuOps []rtdata.CpuOpAct
+	for i, p := range ps {
+		dev := rtinfo.DeviceTimeline{
+			DeviceID: i,
+			Tm:       p.tm,
+		}
+		for _, act := range p.dtuOps {
+			if !dev.FirstValid || act.StartCycle() < dev.FirstCycle {
+				dev.FirstCycle = act.StartCycle()
+				dev.FirstValid = true
+			}
+		}
+		devs = append(devs, dev)
+		if len(cpuOps) == 0 {
+			cpuOps = p.procOpt.CpuOps
+		}
+	}
+	return rtinfo.AlignDevicesToHost(devs, cpuOps, correct)
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"git.enflame.cn/hai.bai/dmaster/dbexport"
+	"git.enflame.cn/hai.bai/dmaster/rtinfo/archdetect"
+	"git.enflame.cn/hai.bai/dmaster/rtinfo/rtdata"
+)
+
+// Set by the build, -ldflags "-X main.dmasterVersion=..."
+var dmasterVersion = "dev"
+
+func fileSha256(path string) (string, error) {
+	fin, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer fin.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, fin); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// runProvenance is what goes for all the devices: the version, the arch
+// asked for and the one detected, the inputs and every flag
+func runProvenance(archDetector archdetect.ArchDetector) []dbexport.ProvenanceItem {
+	var items []dbexport.ProvenanceItem
+	add := func(scope, name string, value interface{}) {
+		items = append(items, dbexport.ProvenanceItem{
+			Coords: dbexport.ProvenanceRunCoords,
+			Scope:  scope,
+			Name:   name,
+			Value:  fmt.Sprint(value),
+		})
+	}
+
+	add(dbexport.ProvenanceScope_Run, "dmaster_version", dmasterVersion)
+	add(dbexport.ProvenanceScope_Run, "go_version", runtime.Version())
+	add(dbexport.ProvenanceScope_Run, "command_line", strings.Join(os.Args, " "))
+	add(dbexport.ProvenanceScope_Run, "arch_requested", *fArch)
+	add(dbexport.ProvenanceScope_Run, "arch", archDetector.GetArch())
+	add(dbexport.ProvenanceScope_Run, "arch_forced", *fArch != "auto")
+	add(dbexport.ProvenanceScope_Run, "one_task", archDetector.GetOneTaskFlag())
+	add(dbexport.ProvenanceScope_Run, "meta_dir", *fMetaStartup)
+
+	for _, input := range flag.Args() {
+		path, err := filepath.Abs(input)
+		if err != nil {
+			path = input
+		}
+		var value string
+		if stat, err := os.Stat(input); err != nil {
+			value = fmt.Sprintf("error: %v", err)
+		} else if stat.IsDir() {
+			value = "directory"
+		} else if value, err = fileSha256(input); err != nil {
+			value = fmt.Sprintf("error: %v", err)
+		}
+		add(dbexport.ProvenanceScope_Input, path, value)
+	}
+
+	flag.VisitAll(func(f *flag.Flag) {
+		add(dbexport.ProvenanceScope_Flag, f.Name, f.Value)
+	})
+	return items
+}
+
+// deviceProvenance tells how well the ring buffer of the device decodes
+// and how well its timeline maps onto the host
+func deviceProvenance(coord rtdata.Coords, p PostProcessor) []dbexport.ProvenanceItem {
+	var items []dbexport.ProvenanceItem
+	add := func(scope, name string, value interface{}) {
+		items = append(items, dbexport.ProvenanceItem{
+			Coords: coord,
+			Scope:  scope,
+			Name:   name,
+			Value:  fmt.Sprint(value),
+		})
+	}
+
+	add(dbexport.ProvenanceScope_Decode, "ok", p.decodeStat.Ok)
+	add(dbexport.ProvenanceScope_Decode, "errors", p.decodeStat.Errors)
+	add(dbexport.ProvenanceScope_Decode, "ignored", p.decodeStat.Ignored)
+
+	fit := p.tm.GetFitReport()
+	clean := p.tm.GetCleanReport()
+	add(dbexport.ProvenanceScope_Timeline, "mode", fit.Mode)
+	freq := "none"
+	if fit.FreqMHz > 0 {
+		freq = fmt.Sprintf("%.6f", fit.FreqMHz)
+	}
+	add(dbexport.ProvenanceScope_Timeline, "freq_mhz", freq)
+	add(dbexport.ProvenanceScope_Timeline, "max_drift_ns", fit.MaxDrift)
+	add(dbexport.ProvenanceScope_Timeline, "sync_points", len(fit.Residuals))
+	add(dbexport.ProvenanceScope_Timeline, "dropped_host_sync_points", clean.Host.Dropped())
+	add(dbexport.ProvenanceScope_Timeline, "dropped_device_sync_points", clean.Cycle.Dropped())
+	add(dbexport.ProvenanceScope_Timeline, "dropped_aligned_sync_points", clean.Aligned.Dropped())
+	add(dbexport.ProvenanceScope_Timeline, "verified", p.tm.Verify())
+	return items
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"git.enflame.cn/hai.bai/dmaster/vpdquery"
+)
+
+// -p name=value, repeated
+type queryParams map[string]string
+
+func (qp queryParams) String() string {
+	var kvs []string
+	for k, v := range qp {
+		kvs = append(kvs, k+"="+v)
+	}
+	return strings.Join(kvs, ",")
+}
+
+func (qp queryParams) Set(kv string) error {
+	eq := strings.Index(kv, "=")
+	if eq <= 0 {
+		return fmt.Errorf("expecting name=value, got %q", kv)
+	}
+	qp[kv[:eq]] = kv[eq+1:]
+	return nil
+}
+
+func queryUsage(fs *flag.FlagSet) {
+	out := fs.Output()
+	fmt.Fprintf(out, "usage: dmaster query [options] a.vpd <report|SQL> [arg ...]\n")
+	fmt.Fprintf(out, "  args are bound to the ? of the SQL in order, empty as NULL,\n")
+	fmt.Fprintf(out, "  those after -- are never taken as options\n\n")
+	fmt.Fprintf(out, "reports, params given by -p name=value:\n")
+	for _, r := range vpdquery.Reports() {
+		fmt.Fprintf(out, "  %v: %v\n", r.Name, r.Help)
+		for _, p := range r.Params {
+			fmt.Fprintf(out, "    %v=%q: %v\n", p.Name, p.Default, p.Help)
+		}
+	}
+	fmt.Fprintf(out, "\noptions:\n")
+	fs.PrintDefaults()
+}
+
+// dmaster query a.vpd top_ops -p limit=20
+// dmaster query -format csv a.vpd "select * from fw where packet_id = ?" 17
+func queryMain(args []string) {
+	fs := flag.NewFlagSet("query", flag.ExitOnError)
+	format := fs.String("format", vpdquery.Format_Table, "output: table, csv or json")
+	params := make(queryParams)
+	fs.Var(params, "p", "param of the report as name=value, repeated")
+	fs.Usage = func() { queryUsage(fs) }
+	// Options may go after the vpd and report too, all after -- are args
+	var positional []string
+	for len(args) > 0 {
+		fs.Parse(args)
+		rest := fs.Args()
+		if len(rest) < len(args) && args[len(args)-len(rest)-1] == "--" {
+			positional = append(positional, rest...)
+			break
+		}
+		if len(rest) == 0 {
+			break
+		}
+		positional = append(positional, rest[0])
+		args = rest[1:]
+	}
+	if len(positional) < 2 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	target, what, sqlArgs := positional[0], positional[1], positional[2:]
+	if code := runQuery(target, what, sqlArgs, params, *format); code != 0 {
+		os.Exit(code)
+	}
+}
+
+// runQuery returns the exit code, so the vpd is closed and its
+// upgraded copy removed before exiting
+func runQuery(target, what string, sqlArgs []string,
+	params queryParams, format string) int {
+	db, err := vpdquery.Open(target)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	defer db.Close()
+
+	var result vpdquery.Result
+	if report, ok := vpdquery.FindReport(what); ok {
+		if len(sqlArgs) > 0 {
+			fmt.Fprintf(os.Stderr, "report %v takes -p params, not args: %v\n",
+				what, sqlArgs)
+			return 2
+		}
+		result, err = vpdquery.RunReport(db.DB, report, params)
+	} else {
+		if len(params) > 0 {
+			fmt.Fprintf(os.Stderr, "-p is for the reports, SQL takes args\n")
+			return 2
+		}
+		result, err = vpdquery.RunSQL(db.DB, what, sqlArgs)
+	}
+	if err == nil {
+		err = result.Write(os.Stdout, format)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	return 0
+}
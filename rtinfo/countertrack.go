@@ -0,0 +1,112 @@
+package rtinfo
+
+import (
+	"fmt"
+	"sort"
+
+	"git.enflame.cn/hai.bai/dmaster/rtinfo/rtdata"
+)
+
+// Time series derived from the activities, such as how many DMAs are
+// in flight, written once and plotted by every output. The points are
+// in device cycles, mapped to host by the outputs like the slices are.
+type CounterPoint struct {
+	Cycle uint64
+	Value float64
+}
+
+type CounterTrack struct {
+	Name   string
+	Unit   string
+	Points []CounterPoint
+}
+
+type counterDelta struct {
+	cycle uint64
+	delta float64
+}
+
+// stepCounter adds the deltas up in time order, all the changes at the
+// same time make one point
+func stepCounter(deltas []counterDelta) []CounterPoint {
+	sort.SliceStable(deltas, func(i, j int) bool {
+		return deltas[i].cycle < deltas[j].cycle
+	})
+	var points []CounterPoint
+	var cur float64
+	for i, d := range deltas {
+		cur += d.delta
+		if i+1 < len(deltas) && deltas[i+1].cycle == d.cycle {
+			continue
+		}
+		if cur < 1e-9 {
+			cur = 0
+		}
+		points = append(points, CounterPoint{d.cycle, cur})
+	}
+	return points
+}
+
+// A span counts one on its track while it runs
+type CounterSpan struct {
+	Track      string
+	StartCycle uint64
+	EndCycle   uint64
+}
+
+// GenerateInFlightTracks counts the spans running at a time per track,
+// spans not mapped to host are left out
+func GenerateInFlightTracks(spans []CounterSpan, unit string,
+	tm *TimelineManager) []CounterTrack {
+	deltaMap := make(map[string][]counterDelta)
+	for _, span := range spans {
+		start, startOK := tm.MapToHosttime(span.StartCycle)
+		end, endOK := tm.MapToHosttime(span.EndCycle)
+		if !startOK || !endOK || end <= start {
+			continue
+		}
+		deltaMap[span.Track] = append(deltaMap[span.Track],
+			counterDelta{span.StartCycle, 1}, counterDelta{span.EndCycle, -1})
+	}
+	var rv []CounterTrack
+	for name, deltas := range deltaMap {
+		rv = append(rv, CounterTrack{
+			Name:   name,
+			Unit:   unit,
+			Points: stepCounter(deltas),
+		})
+	}
+	sort.Slice(rv, func(i, j int) bool {
+		return rv[i].Name < rv[j].Name
+	})
+	return rv
+}
+
+// DMAs in flight and their bandwidth per engine, sub ops in flight per
+// cluster
+func GenerateActivityCounters(dmaActs []rtdata.CookedDmaActivity,
+	subOps []rtdata.KernelActivity, tm *TimelineManager) []CounterTrack {
+	var dmaSpans, subOpSpans []CounterSpan
+	acts := make([]rtdata.DmaActivity, len(dmaActs))
+	for i, act := range dmaActs {
+		acts[i] = act.DmaActivity
+		dmaSpans = append(dmaSpans, CounterSpan{
+			Track: fmt.Sprintf("%v.%v.%v in flight",
+				act.Start.EngineTypeCode, act.Start.ClusterID,
+				act.GetEngineIndex()),
+			StartCycle: act.StartCycle(),
+			EndCycle:   act.EndCycle(),
+		})
+	}
+	for _, act := range subOps {
+		subOpSpans = append(subOpSpans, CounterSpan{
+			Track: fmt.Sprintf("Sub Ops %v.%v in flight",
+				act.Start.EngineTypeCode, act.Start.ClusterID),
+			StartCycle: act.StartCycle(),
+			EndCycle:   act.EndCycle(),
+		})
+	}
+	rv := append(GenerateInFlightTracks(dmaSpans, "count", tm),
+		GenerateInFlightTracks(subOpSpans, "count", tm)...)
+	return append(rv, GenerateDmaBandwidthTracks(acts, tm)...)
+}
@@ -0,0 +1,18 @@
+package rtinfo
+
+import "testing"
+
+func TestStepCounter(t *testing.T) {
+	points := stepCounter([]counterDelta{
+		{30, -1}, {10, 1}, {20, 1}, {30, 1}, {40, -1}, {50, -1},
+	})
+	expected := []CounterPoint{{10, 1}, {20, 2}, {30, 2}, {40, 1}, {50, 0}}
+	if len(points) != len(expected) {
+		t.Fatalf("expecting %v, got %v", expected, points)
+	}
+	for i := range expected {
+		if points[i] != expected[i] {
+			t.Errorf("point %v: expecting %v, got %v", i, expected[i], points[i])
+		}
+	}
+}
@@ -0,0 +1,313 @@
+package rtinfo
+
+import (
+	"fmt"
+	"io"
+	"sort"
+
+	"git.enflame.cn/hai.bai/dmaster/rtinfo/rtdata"
+)
+
+type CriticalKind string
+
+const (
+	CriticalKind_Compute CriticalKind = "compute" // SIP kernel
+	CriticalKind_Dma     CriticalKind = "dma"
+	CriticalKind_Cqm     CriticalKind = "cqm" // inside op, but no engine work
+	CriticalKind_Idle    CriticalKind = "idle"
+)
+
+type CriticalSegment struct {
+	Kind        CriticalKind
+	StartCycle  uint64
+	EndCycle    uint64
+	Name        string
+	EngineType  string
+	EngineIndex int
+	OpId        int
+}
+
+func (seg CriticalSegment) Cycles() uint64 {
+	return seg.EndCycle - seg.StartCycle
+}
+
+type TaskCriticalPath struct {
+	TaskID      int
+	ExecUuid    uint64
+	StartCycle  uint64
+	EndCycle    uint64
+	Segments    []CriticalSegment // in time order
+	CycleByKind map[CriticalKind]uint64
+}
+
+func (p TaskCriticalPath) TotalCycles() uint64 {
+	return p.EndCycle - p.StartCycle
+}
+
+// The one that bounds most of the task time
+func (p TaskCriticalPath) BoundBy() CriticalKind {
+	var rv CriticalKind = CriticalKind_Idle
+	var maxCy uint64
+	for _, kind := range []CriticalKind{
+		CriticalKind_Compute, CriticalKind_Dma,
+		CriticalKind_Cqm, CriticalKind_Idle} {
+		if p.CycleByKind[kind] > maxCy {
+			rv, maxCy = kind, p.CycleByKind[kind]
+		}
+	}
+	return rv
+}
+
+// Engine work in one task, nodes are leaves of the dependency graph
+type taskEngineWork struct {
+	taskId   int
+	execUuid uint64
+	nodes    []CriticalSegment
+	ops      rtdata.Interval
+}
+
+// GenerateCriticalPaths: for each task, an activity depends on the ones
+// finished before it starts, and the critical path is traced backward
+// from the end of the task through the latest-finishing predecessors.
+// Time between steps is taken by CQM if covered by an op, or else idle.
+func GenerateCriticalPaths(
+	dtuOps []rtdata.OpActivity,
+	kernelActs []rtdata.KernelActivity,
+	dmaActs []rtdata.DmaActivity,
+	taskActMap map[int]rtdata.FwActivity,
+) []TaskCriticalPath {
+	works := make(map[int]*taskEngineWork)
+	getWork := func(taskId int) *taskEngineWork {
+		if w, ok := works[taskId]; ok {
+			return w
+		}
+		w := &taskEngineWork{taskId: taskId}
+		works[taskId] = w
+		return w
+	}
+
+	for _, op := range dtuOps {
+		if !op.IsOpRefValid() {
+			continue
+		}
+		w := getWork(op.GetTaskID())
+		w.execUuid = op.GetTask().ExecutableUUID
+		w.ops = append(w.ops, []uint64{op.StartCycle(), op.EndCycle()})
+	}
+	for _, kern := range kernelActs {
+		w, ok := works[kern.RtInfo.TaskId]
+		if !ok || kern.RtInfo.TaskId <= 0 {
+			continue
+		}
+		name, _ := kern.GetSipOpName()
+		w.nodes = append(w.nodes, CriticalSegment{
+			Kind:        CriticalKind_Compute,
+			StartCycle:  kern.StartCycle(),
+			EndCycle:    kern.EndCycle(),
+			Name:        name,
+			EngineType:  kern.Start.EngineTypeCode.String(),
+			EngineIndex: kern.GetEngineIndex(),
+			OpId:        kern.RtInfo.OpId,
+		})
+	}
+	for _, dma := range dmaActs {
+		if !dma.IsDmaMetaRefValid() {
+			continue
+		}
+		w, ok := works[dma.GetTask().TaskID]
+		if !ok {
+			continue
+		}
+		dmaMeta := dma.GetDmaMeta()
+		w.nodes = append(w.nodes, CriticalSegment{
+			Kind:        CriticalKind_Dma,
+			StartCycle:  dma.StartCycle(),
+			EndCycle:    dma.EndCycle(),
+			Name:        dmaMeta.DmaOpString,
+			EngineType:  dma.Start.EngineTypeCode.String(),
+			EngineIndex: dma.GetEngineIndex(),
+			OpId:        -1,
+		})
+	}
+
+	var taskIds []int
+	for taskId := range works {
+		taskIds = append(taskIds, taskId)
+	}
+	sort.Ints(taskIds)
+
+	var rv []TaskCriticalPath
+	for _, taskId := range taskIds {
+		w := works[taskId]
+		startCy, endCy := w.window(taskActMap)
+		rv = append(rv, w.tracePath(startCy, endCy))
+	}
+	return rv
+}
+
+// Task window is bounded by the executable activity if there is one
+func (w *taskEngineWork) window(taskActMap map[int]rtdata.FwActivity) (uint64, uint64) {
+	if fwAct, ok := taskActMap[w.taskId]; ok && fwAct.End.Event >= 0 {
+		return fwAct.StartCycle(), fwAct.EndCycle()
+	}
+	var startCy, endCy uint64
+	for i, op := range w.ops {
+		if i == 0 || op[0] < startCy {
+			startCy = op[0]
+		}
+		if op[1] > endCy {
+			endCy = op[1]
+		}
+	}
+	return startCy, endCy
+}
+
+func clipCycle(cy, lo, hi uint64) uint64 {
+	if cy < lo {
+		return lo
+	}
+	if cy > hi {
+		return hi
+	}
+	return cy
+}
+
+func (w *taskEngineWork) tracePath(startCy, endCy uint64) TaskCriticalPath {
+	path := TaskCriticalPath{
+		TaskID:      w.taskId,
+		ExecUuid:    w.execUuid,
+		StartCycle:  startCy,
+		EndCycle:    endCy,
+		CycleByKind: make(map[CriticalKind]uint64),
+	}
+
+	// By end ascending, and the longest one comes last for the same end
+	nodes := w.nodes
+	sort.Slice(nodes, func(i, j int) bool {
+		if nodes[i].EndCycle != nodes[j].EndCycle {
+			return nodes[i].EndCycle < nodes[j].EndCycle
+		}
+		return nodes[i].StartCycle > nodes[j].StartCycle
+	})
+	opUnion := mergeIntervals(w.ops)
+
+	var reversed []CriticalSegment
+	addGap := func(lo, hi uint64) {
+		reversed = append(reversed, splitGapByOps(lo, hi, opUnion)...)
+	}
+
+	cur := endCy
+	idx := len(nodes) - 1
+	for cur > startCy {
+		for idx >= 0 && nodes[idx].EndCycle > cur {
+			idx--
+		}
+		// Skip the ones entirely before the window
+		if idx < 0 || nodes[idx].EndCycle <= startCy {
+			addGap(startCy, cur)
+			break
+		}
+		node := nodes[idx]
+		if node.EndCycle < cur {
+			addGap(node.EndCycle, cur)
+		}
+		node.StartCycle = clipCycle(node.StartCycle, startCy, endCy)
+		reversed = append(reversed, node)
+		cur = node.StartCycle
+		idx--
+	}
+
+	for i := len(reversed) - 1; i >= 0; i-- {
+		seg := reversed[i]
+		if seg.Cycles() == 0 {
+			continue
+		}
+		path.Segments = append(path.Segments, seg)
+		path.CycleByKind[seg.Kind] += seg.Cycles()
+	}
+	return path
+}
+
+func mergeIntervals(intvs rtdata.Interval) rtdata.Interval {
+	sorted := make(rtdata.Interval, len(intvs))
+	copy(sorted, intvs)
+	sort.Sort(sorted)
+	var rv rtdata.Interval
+	for _, intv := range sorted {
+		if lz := len(rv); lz > 0 && intv[0] <= rv[lz-1][1] {
+			if intv[1] > rv[lz-1][1] {
+				rv[lz-1][1] = intv[1]
+			}
+			continue
+		}
+		rv = append(rv, []uint64{intv[0], intv[1]})
+	}
+	return rv
+}
+
+// Segments are returned in reversed time order, same as the tracing
+func splitGapByOps(lo, hi uint64, opUnion rtdata.Interval) []CriticalSegment {
+	var segs []CriticalSegment
+	cur := hi
+	for i := len(opUnion) - 1; i >= 0 && cur > lo; i-- {
+		opLo, opHi := opUnion[i][0], opUnion[i][1]
+		if opHi <= lo || opLo >= cur {
+			continue
+		}
+		if opHi < cur {
+			segs = append(segs, newGapSegment(CriticalKind_Idle, opHi, cur))
+			cur = opHi
+		}
+		segLo := opLo
+		if segLo < lo {
+			segLo = lo
+		}
+		segs = append(segs, newGapSegment(CriticalKind_Cqm, segLo, cur))
+		cur = segLo
+	}
+	if cur > lo {
+		segs = append(segs, newGapSegment(CriticalKind_Idle, lo, cur))
+	}
+	return segs
+}
+
+func newGapSegment(kind CriticalKind, lo, hi uint64) CriticalSegment {
+	return CriticalSegment{
+		Kind:        kind,
+		StartCycle:  lo,
+		EndCycle:    hi,
+		Name:        string(kind),
+		EngineIndex: -1,
+		OpId:        -1,
+	}
+}
+
+func DumpCriticalPaths(fout io.Writer, paths []TaskCriticalPath) {
+	fmt.Fprintf(fout, "task exec total compute dma cqm idle bound_by\n")
+	for _, p := range paths {
+		total := p.TotalCycles()
+		rate := func(kind CriticalKind) string {
+			if total == 0 {
+				return "0(0.00%)"
+			}
+			return fmt.Sprintf("%v(%.2f%%)", p.CycleByKind[kind],
+				float64(p.CycleByKind[kind])/float64(total)*100)
+		}
+		fmt.Fprintf(fout, "%v 0x%016x %v %v %v %v %v %v\n",
+			p.TaskID, p.ExecUuid, total,
+			rate(CriticalKind_Compute), rate(CriticalKind_Dma),
+			rate(CriticalKind_Cqm), rate(CriticalKind_Idle),
+			p.BoundBy(),
+		)
+	}
+	fmt.Fprintf(fout, "\n")
+	for _, p := range paths {
+		fmt.Fprintf(fout, "# Task %v critical path, %v step(s)\n",
+			p.TaskID, len(p.Segments))
+		for _, seg := range p.Segments {
+			fmt.Fprintf(fout, "  %-8v [%v, %v] %v %v %v %v\n",
+				seg.Kind, seg.StartCycle, seg.EndCycle, seg.Cycles(),
+				seg.EngineType, seg.EngineIndex, seg.Name)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package rtinfo
+
+import (
+	"testing"
+
+	"git.enflame.cn/hai.bai/dmaster/rtinfo/rtdata"
+)
+
+func TestCriticalPathTrace(t *testing.T) {
+	w := &taskEngineWork{
+		taskId: 1,
+		ops:    rtdata.Interval{{0, 50}, {60, 100}},
+		nodes: []CriticalSegment{
+			{Kind: CriticalKind_Dma, StartCycle: 5, EndCycle: 20},
+			{Kind: CriticalKind_Compute, StartCycle: 10, EndCycle: 30}, // overlaps
+			{Kind: CriticalKind_Compute, StartCycle: 40, EndCycle: 90},
+			{Kind: CriticalKind_Dma, StartCycle: 50, EndCycle: 60}, // hidden
+		},
+	}
+	path := w.tracePath(0, 100)
+	expected := []CriticalSegment{
+		{Kind: CriticalKind_Cqm, StartCycle: 0, EndCycle: 10},
+		{Kind: CriticalKind_Compute, StartCycle: 10, EndCycle: 30},
+		{Kind: CriticalKind_Cqm, StartCycle: 30, EndCycle: 40},
+		{Kind: CriticalKind_Compute, StartCycle: 40, EndCycle: 90},
+		{Kind: CriticalKind_Cqm, StartCycle: 90, EndCycle: 100},
+	}
+	if len(path.Segments) != len(expected) {
+		t.Fatalf("expecting %v steps, got %v: %v",
+			len(expected), len(path.Segments), path.Segments)
+	}
+	for i, seg := range path.Segments {
+		if seg.Kind != expected[i].Kind ||
+			seg.StartCycle != expected[i].StartCycle ||
+			seg.EndCycle != expected[i].EndCycle {
+			t.Errorf("step %v: expecting %v, got %v", i, expected[i], seg)
+		}
+	}
+	if path.BoundBy() != CriticalKind_Compute {
+		t.Errorf("must be bound by compute, got %v", path.BoundBy())
+	}
+}
+
+func TestCriticalPathIdleGap(t *testing.T) {
+	segs := splitGapByOps(0, 100, rtdata.Interval{{20, 40}, {60, 80}})
+	var idle, cqm uint64
+	for _, seg := range segs {
+		if seg.Kind == CriticalKind_Idle {
+			idle += seg.Cycles()
+		} else {
+			cqm += seg.Cycles()
+		}
+	}
+	if idle != 60 || cqm != 40 || len(segs) != 5 {
+		t.Errorf("unexpected gap split: %v", segs)
+	}
+}
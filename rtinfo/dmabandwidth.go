@@ -0,0 +1,70 @@
+package rtinfo
+
+import (
+	"fmt"
+	"sort"
+
+	"git.enflame.cn/hai.bai/dmaster/meta/metadata"
+	"git.enflame.cn/hai.bai/dmaster/rtinfo/rtdata"
+)
+
+// Bytes per ns, which is GB/s
+type DmaBandwidth struct {
+	Transfer metadata.DmaTransfer
+	Bytes    int64
+	GBps     float64
+}
+
+// DmaActBandwidth is only valid with dma meta sized, and mapped to host
+func DmaActBandwidth(act rtdata.DmaActivity, tm *TimelineManager) (
+	DmaBandwidth, bool) {
+	if !act.IsDmaMetaRefValid() {
+		return DmaBandwidth{}, false
+	}
+	rv := DmaBandwidth{Transfer: act.GetDmaMeta().GetTransfer()}
+	bytes, ok := rv.Transfer.Bytes()
+	if !ok {
+		return rv, false
+	}
+	rv.Bytes = bytes
+	startHostTime, startOK := tm.MapToHosttime(act.StartCycle())
+	endHostTime, endOK := tm.MapToHosttime(act.EndCycle())
+	if !startOK || !endOK || endHostTime <= startHostTime {
+		return rv, false
+	}
+	rv.GBps = float64(bytes) / float64(endHostTime-startHostTime)
+	return rv, true
+}
+
+// GenerateDmaBandwidthTracks adds up the bandwidth of the activities
+// in flight, a track per engine and direction
+func GenerateDmaBandwidthTracks(dmaActs []rtdata.DmaActivity,
+	tm *TimelineManager) []CounterTrack {
+	deltaMap := make(map[string][]counterDelta)
+	for _, act := range dmaActs {
+		bw, ok := DmaActBandwidth(act, tm)
+		if !ok {
+			continue
+		}
+		name := fmt.Sprintf("%v.%v.%v %v bandwidth",
+			act.Start.EngineTypeCode, act.Start.ClusterID,
+			act.GetEngineIndex(), bw.Transfer.Direction)
+		deltaMap[name] = append(deltaMap[name],
+			counterDelta{act.StartCycle(), bw.GBps},
+			counterDelta{act.EndCycle(), -bw.GBps},
+		)
+	}
+
+	var rv []CounterTrack
+	for name, deltas := range deltaMap {
+		rv = append(rv, CounterTrack{
+			Name:   name,
+			Unit:   "GB/s",
+			Points: stepCounter(deltas),
+		})
+	}
+	sort.Slice(rv, func(i, j int) bool {
+		return rv[i].Name < rv[j].Name
+	})
+	return rv
+}
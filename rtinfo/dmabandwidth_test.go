@@ -0,0 +1,78 @@
+package rtinfo
+
+import (
+	"testing"
+
+	"git.enflame.cn/hai.bai/dmaster/codec"
+	"git.enflame.cn/hai.bai/dmaster/meta/metadata"
+	"git.enflame.cn/hai.bai/dmaster/rtinfo/rtdata"
+)
+
+func newBandwidthAct(cluster int, start, end uint64,
+	dmaOp *metadata.DmaOp) rtdata.DmaActivity {
+	act := rtdata.DmaActivity{DpfAct: newTestAct(codec.EngCat_CDMA, 1, start, end)}
+	act.Start.ClusterID = cluster
+	if dmaOp != nil {
+		act.SetDmaRef(rtdata.NewDmaRef(dmaOp, &rtdata.RuntimeTask{}))
+	}
+	return act
+}
+
+func TestDmaActBandwidth(t *testing.T) {
+	// Device cycles are taken as host ns
+	tm := &TimelineManager{}
+	// 28x40xf32 is the smaller side: 4480 bytes
+	dmaOp := &metadata.DmaOp{
+		Input:  "memref<1344x40xf32, 1>",
+		Output: "memref<28x40xf32, 2>",
+	}
+	bw, ok := DmaActBandwidth(newBandwidthAct(0, 1000, 1448, dmaOp), tm)
+	if !ok || bw.Bytes != 4480 || bw.GBps != 10 || bw.Transfer.Direction != "L1->L2" {
+		t.Errorf("expecting 4480 bytes in 448 ns at 10 GB/s, got %+v", bw)
+	}
+	if _, ok := DmaActBandwidth(newBandwidthAct(0, 1000, 1448, nil), tm); ok {
+		t.Errorf("expecting invalid without dma meta")
+	}
+	if _, ok := DmaActBandwidth(newBandwidthAct(0, 1000, 1000, dmaOp), tm); ok {
+		t.Errorf("expecting invalid of zero duration")
+	}
+	unsized := &metadata.DmaOp{Input: "unk", Output: "unk"}
+	if _, ok := DmaActBandwidth(newBandwidthAct(0, 1000, 1448, unsized), tm); ok {
+		t.Errorf("expecting invalid without size")
+	}
+}
+
+func TestGenerateDmaBandwidthTracks(t *testing.T) {
+	tm := &TimelineManager{}
+	// 4480 bytes: 10 GB/s over 448 ns, 20 GB/s over 224 ns
+	dmaOp := &metadata.DmaOp{
+		Input:  "memref<28x40xf32, 1>",
+		Output: "memref<28x40xf32, 2>",
+	}
+	tracks := GenerateDmaBandwidthTracks([]rtdata.DmaActivity{
+		newBandwidthAct(0, 1000, 1448, dmaOp),
+		newBandwidthAct(0, 1224, 1448, dmaOp),
+		newBandwidthAct(1, 0, 448, dmaOp),
+		newBandwidthAct(0, 0, 10, nil),
+	}, tm)
+	if len(tracks) != 2 {
+		t.Fatalf("expecting a track per cluster, got %v", tracks)
+	}
+	track := tracks[0]
+	if track.Name != "CDMA.0.0 L1->L2 bandwidth" || track.Unit != "GB/s" {
+		t.Errorf("unexpected track: %v in %v", track.Name, track.Unit)
+	}
+	// Both end at 1448, which is one point
+	expected := []CounterPoint{{1000, 10}, {1224, 30}, {1448, 0}}
+	if len(track.Points) != len(expected) {
+		t.Fatalf("expecting %v, got %v", expected, track.Points)
+	}
+	for i := range expected {
+		if track.Points[i] != expected[i] {
+			t.Errorf("point %v: expecting %v, got %v", i, expected[i], track.Points[i])
+		}
+	}
+	if pts := tracks[1].Points; len(pts) != 2 || pts[0] != (CounterPoint{0, 10}) {
+		t.Errorf("unexpected cluster 1 points: %v", pts)
+	}
+}
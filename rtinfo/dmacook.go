@@ -0,0 +1,86 @@
+package rtinfo
+
+import (
+	"fmt"
+	"sort"
+
+	"git.enflame.cn/hai.bai/dmaster/codec"
+	"git.enflame.cn/hai.bai/dmaster/rtinfo/rtdata"
+)
+
+type DmaCookResult struct {
+	Acts         []rtdata.CookedDmaActivity
+	MatchedCount int
+	ErrCount     int
+	SkippedCount int
+	CdmaErrCount int
+	SdmaErrCount int
+	OwnedCount   int
+}
+
+// DmaActivity gives the cooked ones in plain form, DMA meta attached
+func (r DmaCookResult) DmaActivity() []rtdata.DmaActivity {
+	rv := make([]rtdata.DmaActivity, len(r.Acts))
+	for i, act := range r.Acts {
+		rv[i] = act.DmaActivity
+	}
+	return rv
+}
+
+func (r DmaCookResult) DumpInfo() {
+	fmt.Printf("Dma meta set SUCCESS %v out of %v, error count: %v\n",
+		r.MatchedCount,
+		len(r.Acts),
+		r.ErrCount,
+	)
+	fmt.Printf("   %v are skipped\n", r.SkippedCount)
+	fmt.Printf("   Cdma error: %v, Sdma error: %v\n",
+		r.CdmaErrCount, r.SdmaErrCount)
+	fmt.Printf("   %v are owned by DTU ops\n", r.OwnedCount)
+	if r.ErrCount == 0 {
+		fmt.Printf("# DMA all restored successfully\n")
+	}
+}
+
+func (r *DmaCookResult) countUnmatched(evt codec.DpfEvent) {
+	switch evt.EngineTypeCode {
+	case codec.EngCat_SDMA:
+		r.SdmaErrCount++
+	case codec.EngCat_CDMA:
+		r.CdmaErrCount++
+	}
+}
+
+// attachOwnerOps: the owner is the latest op of the same task,
+// which has started but not ended yet when DMA starts
+func (r *DmaCookResult) attachOwnerOps(dtuOps []rtdata.OpActivity) {
+	opsByTask := make(map[int][]rtdata.OpActivity)
+	for _, op := range dtuOps {
+		if op.IsOpRefValid() {
+			opsByTask[op.GetTaskID()] = append(opsByTask[op.GetTaskID()], op)
+		}
+	}
+	for _, ops := range opsByTask {
+		sort.Sort(rtdata.OpActivityVector(ops))
+	}
+	for i := range r.Acts {
+		act := &r.Acts[i]
+		if act.Status != rtdata.DmaMatch_Matched {
+			continue
+		}
+		ops := opsByTask[act.GetTask().TaskID]
+		startCy := act.StartCycle()
+		idx := sort.Search(len(ops), func(k int) bool {
+			return ops[k].StartCycle() > startCy
+		})
+		for k := idx - 1; k >= 0; k-- {
+			if ops[k].EndCycle() >= startCy {
+				act.OwnerOpValid = true
+				act.OwnerOpId = ops[k].GetOp().OpId
+				act.OwnerOpName = ops[k].GetOp().OpName
+				r.OwnedCount++
+				break
+			}
+		}
+	}
+}
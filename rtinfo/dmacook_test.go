@@ -0,0 +1,82 @@
+package rtinfo
+
+import (
+	"testing"
+
+	"git.enflame.cn/hai.bai/dmaster/codec"
+	"git.enflame.cn/hai.bai/dmaster/meta/metadata"
+	"git.enflame.cn/hai.bai/dmaster/rtinfo/rtdata"
+)
+
+func TestDmaCookOwnerOps(t *testing.T) {
+	newTask := func(taskId int) *rtdata.RuntimeTask {
+		return &rtdata.RuntimeTask{
+			RuntimeTaskBase: rtdata.RuntimeTaskBase{TaskID: taskId}}
+	}
+	task1, task2 := newTask(1), newTask(2)
+	newOp := func(task *rtdata.RuntimeTask, opId int, start, end uint64) rtdata.OpActivity {
+		op := rtdata.OpActivity{DpfAct: newTestAct(codec.EngCat_CQM, 1, start, end)}
+		op.SetOpRef(rtdata.NewOpRef(&metadata.DtuOp{OpId: opId,
+			OpName: "op"}, task))
+		return op
+	}
+	dtuOps := []rtdata.OpActivity{
+		newOp(task1, 3, 100, 200),
+		newOp(task1, 1, 0, 150),
+		newOp(task2, 7, 0, 1000),
+		{DpfAct: newTestAct(codec.EngCat_CQM, 1, 0, 1000)}, // no meta
+	}
+	newDma := func(task *rtdata.RuntimeTask, status rtdata.DmaMatchStatus,
+		start uint64) rtdata.CookedDmaActivity {
+		act := rtdata.CookedDmaActivity{
+			DmaActivity: rtdata.DmaActivity{
+				DpfAct: newTestAct(codec.EngCat_CDMA, 1, start, start+10)},
+			Status: status,
+		}
+		act.SetDmaRef(rtdata.NewDmaRef(&metadata.DmaOp{}, task))
+		return act
+	}
+	result := DmaCookResult{Acts: []rtdata.CookedDmaActivity{
+		newDma(task1, rtdata.DmaMatch_Matched, 120), // both running, the latest
+		newDma(task1, rtdata.DmaMatch_Matched, 50),  // only op 1 running
+		newDma(task1, rtdata.DmaMatch_Matched, 300), // all ended
+		newDma(task2, rtdata.DmaMatch_Matched, 120), // the op of its own task
+		newDma(task1, rtdata.DmaMatch_Skipped, 120), // not matched, no owner
+	}}
+	result.attachOwnerOps(dtuOps)
+
+	expected := []struct {
+		valid bool
+		opId  int
+	}{{true, 3}, {true, 1}, {false, 0}, {true, 7}, {false, 0}}
+	for i, e := range expected {
+		act := result.Acts[i]
+		if act.OwnerOpValid != e.valid || act.OwnerOpId != e.opId {
+			t.Errorf("dma %v: expecting owner %v %v, got %v %v", i,
+				e.valid, e.opId, act.OwnerOpValid, act.OwnerOpId)
+		}
+	}
+	if result.OwnedCount != 3 {
+		t.Errorf("expecting 3 owned, got %v", result.OwnedCount)
+	}
+	if len(result.DmaActivity()) != len(result.Acts) {
+		t.Errorf("expecting every cooked one in plain form")
+	}
+
+	for status, name := range map[rtdata.DmaMatchStatus]string{
+		rtdata.DmaMatch_NoMeta:  "no_meta",
+		rtdata.DmaMatch_Matched: "matched",
+		rtdata.DmaMatch_Skipped: "skipped",
+	} {
+		if status.String() != name {
+			t.Errorf("expecting %v, got %v", name, status.String())
+		}
+	}
+	result.countUnmatched(codec.DpfEvent{EngineTypeCode: codec.EngCat_SDMA})
+	result.countUnmatched(codec.DpfEvent{EngineTypeCode: codec.EngCat_CDMA})
+	result.countUnmatched(codec.DpfEvent{EngineTypeCode: codec.EngCat_CDMA})
+	if result.SdmaErrCount != 1 || result.CdmaErrCount != 2 {
+		t.Errorf("unexpected unmatched count: %v %v",
+			result.SdmaErrCount, result.CdmaErrCount)
+	}
+}
@@ -0,0 +1,384 @@
+package rtinfo
+
+import (
+	"fmt"
+	"io"
+	"sort"
+
+	"git.enflame.cn/hai.bai/dmaster/codec"
+	"git.enflame.cn/hai.bai/dmaster/rtinfo/rtdata"
+	"git.enflame.cn/hai.bai/dmaster/vgrule"
+)
+
+type IdleCause string
+
+const (
+	IdleCause_Sleep      IdleCause = "cqm_sleep"   // CQM_SLEEP_START/END
+	IdleCause_WaitDma    IdleCause = "wait_dma"    // DMA of the pg is in flight
+	IdleCause_WaitLaunch IdleCause = "wait_launch" // no task on the pg, host or TS to launch
+	IdleCause_Cqm        IdleCause = "cqm"         // in task, but no engine work
+)
+
+// Earlier one wins if a gap is covered by more than one
+var idleCauseOrder = []IdleCause{
+	IdleCause_Sleep,
+	IdleCause_WaitDma,
+	IdleCause_WaitLaunch,
+	IdleCause_Cqm,
+}
+
+type EngineUtilization struct {
+	EngineType  string
+	ClusterID   int
+	EngineIndex int
+	VcId        int // -1 if not a DMA one
+	PgIdx       int // -1 if not bound to pg
+	ActCount    int
+	BusyCycles  uint64
+	SpanCycles  uint64
+}
+
+func (e EngineUtilization) Utilization() float64 {
+	if e.SpanCycles == 0 {
+		return 0
+	}
+	return float64(e.BusyCycles) / float64(e.SpanCycles)
+}
+
+// Busy cycles are the union over all engines of the kind in the pg,
+// and the pg is idle whenever none of its SIPs is busy.
+type PgUtilization struct {
+	PgIdx         int
+	TaskID        int // -1 for the whole run
+	StartCycle    uint64
+	EndCycle      uint64
+	SipBusyCycles uint64
+	DmaBusyCycles uint64
+	CqmBusyCycles uint64
+	IdleCycles    uint64
+	IdleGapCount  int
+	IdleByCause   map[IdleCause]uint64
+}
+
+func (p PgUtilization) SpanCycles() uint64 {
+	return p.EndCycle - p.StartCycle
+}
+
+func (p PgUtilization) Utilization() float64 {
+	if p.SpanCycles() == 0 {
+		return 0
+	}
+	return float64(p.SipBusyCycles) / float64(p.SpanCycles())
+}
+
+type UtilizationReport struct {
+	StartCycle uint64
+	EndCycle   uint64
+	Engines    []EngineUtilization
+	Pgs        []PgUtilization
+	Tasks      []PgUtilization
+}
+
+type engineKey struct {
+	engineType  codec.EngineTypeCode
+	clusterID   int
+	engineIndex int
+	vcId        int
+}
+
+type engineWork struct {
+	pgIdx int
+	busy  rtdata.Interval
+}
+
+// All kinds of work in one pg, merged when collected
+type pgWork struct {
+	sip, dma, cqm, sleep, task rtdata.Interval
+}
+
+func getPgWork(pgs map[int]*pgWork, pgIdx int) *pgWork {
+	if w, ok := pgs[pgIdx]; ok {
+		return w
+	}
+	w := &pgWork{}
+	pgs[pgIdx] = w
+	return w
+}
+
+// GenerateUtilization accounts busy cycles per engine and per pg,
+// over the whole run and within each task.
+func GenerateUtilization(
+	rule vgrule.EngineOrder,
+	kernelActs []rtdata.KernelActivity,
+	dtuOps []rtdata.OpActivity,
+	dmaActs []rtdata.DmaActivity,
+	fwActs []rtdata.FwActivity,
+	taskActMap map[int]rtdata.FwActivity,
+) UtilizationReport {
+	engines := make(map[engineKey]*engineWork)
+	pgs := make(map[int]*pgWork)
+	var rv UtilizationReport
+	first := true
+
+	addWork := func(dpf rtdata.DpfAct, vcId int) (int, bool) {
+		if dpf.EndCycle() < dpf.StartCycle() {
+			return -1, false
+		}
+		if first || dpf.StartCycle() < rv.StartCycle {
+			rv.StartCycle = dpf.StartCycle()
+		}
+		if first || dpf.EndCycle() > rv.EndCycle {
+			rv.EndCycle = dpf.EndCycle()
+		}
+		first = false
+		pgIdx := rule.GetEngineOrderIndex(dpf.Start)
+		key := engineKey{
+			engineType:  dpf.Start.EngineTypeCode,
+			clusterID:   dpf.Start.ClusterID,
+			engineIndex: dpf.Start.EngineIndex,
+			vcId:        vcId,
+		}
+		w, ok := engines[key]
+		if !ok {
+			w = &engineWork{pgIdx: pgIdx}
+			engines[key] = w
+		}
+		w.busy = append(w.busy, []uint64{dpf.StartCycle(), dpf.EndCycle()})
+		return pgIdx, pgIdx >= 0
+	}
+
+	for _, kern := range kernelActs {
+		if pgIdx, ok := addWork(kern.DpfAct, -1); ok {
+			w := getPgWork(pgs, pgIdx)
+			w.sip = append(w.sip, []uint64{kern.StartCycle(), kern.EndCycle()})
+		}
+	}
+	for _, op := range dtuOps {
+		if pgIdx, ok := addWork(op.DpfAct, -1); ok {
+			w := getPgWork(pgs, pgIdx)
+			w.cqm = append(w.cqm, []uint64{op.StartCycle(), op.EndCycle()})
+		}
+	}
+	for _, dma := range dmaActs {
+		if pgIdx, ok := addWork(dma.DpfAct, dma.GetVcId()); ok {
+			w := getPgWork(pgs, pgIdx)
+			w.dma = append(w.dma, []uint64{dma.StartCycle(), dma.EndCycle()})
+		}
+	}
+	for _, fwAct := range fwActs {
+		if fwAct.Start.EngineTypeCode != codec.EngCat_CQM ||
+			fwAct.Start.Event != codec.CqmSleepStart ||
+			fwAct.EndCycle() < fwAct.StartCycle() {
+			continue
+		}
+		if pgIdx := rule.GetCqmEngineOrder(fwAct.Start); pgIdx >= 0 {
+			w := getPgWork(pgs, pgIdx)
+			w.sleep = append(w.sleep, []uint64{fwAct.StartCycle(), fwAct.EndCycle()})
+		}
+	}
+
+	var taskIds []int
+	for taskId, fwAct := range taskActMap {
+		if fwAct.End.Event < 0 || fwAct.EndCycle() < fwAct.StartCycle() {
+			continue
+		}
+		taskIds = append(taskIds, taskId)
+		if pgIdx := rule.GetCqmEngineOrder(fwAct.Start); pgIdx >= 0 {
+			w := getPgWork(pgs, pgIdx)
+			w.task = append(w.task, []uint64{fwAct.StartCycle(), fwAct.EndCycle()})
+		}
+	}
+	sort.Ints(taskIds)
+
+	for _, w := range pgs {
+		w.sip = mergeIntervals(w.sip)
+		w.dma = mergeIntervals(w.dma)
+		w.cqm = mergeIntervals(w.cqm)
+		w.sleep = mergeIntervals(w.sleep)
+		w.task = mergeIntervals(w.task)
+	}
+
+	for key, w := range engines {
+		rv.Engines = append(rv.Engines, EngineUtilization{
+			EngineType:  key.engineType.String(),
+			ClusterID:   key.clusterID,
+			EngineIndex: key.engineIndex,
+			VcId:        key.vcId,
+			PgIdx:       w.pgIdx,
+			ActCount:    len(w.busy),
+			BusyCycles:  busyCyclesWithin(mergeIntervals(w.busy), rv.StartCycle, rv.EndCycle),
+			SpanCycles:  rv.EndCycle - rv.StartCycle,
+		})
+	}
+	sort.Slice(rv.Engines, func(i, j int) bool {
+		lhs, rhs := rv.Engines[i], rv.Engines[j]
+		if lhs.EngineType != rhs.EngineType {
+			return lhs.EngineType < rhs.EngineType
+		}
+		if lhs.ClusterID != rhs.ClusterID {
+			return lhs.ClusterID < rhs.ClusterID
+		}
+		if lhs.EngineIndex != rhs.EngineIndex {
+			return lhs.EngineIndex < rhs.EngineIndex
+		}
+		return lhs.VcId < rhs.VcId
+	})
+
+	var pgIdxVec []int
+	for pgIdx := range pgs {
+		pgIdxVec = append(pgIdxVec, pgIdx)
+	}
+	sort.Ints(pgIdxVec)
+	for _, pgIdx := range pgIdxVec {
+		rv.Pgs = append(rv.Pgs,
+			pgs[pgIdx].account(pgIdx, -1, rv.StartCycle, rv.EndCycle))
+	}
+
+	for _, taskId := range taskIds {
+		fwAct := taskActMap[taskId]
+		pgIdx := rule.GetCqmEngineOrder(fwAct.Start)
+		w, ok := pgs[pgIdx]
+		if !ok {
+			continue
+		}
+		rv.Tasks = append(rv.Tasks,
+			w.account(pgIdx, taskId, fwAct.StartCycle(), fwAct.EndCycle()))
+	}
+	return rv
+}
+
+func (w *pgWork) account(pgIdx, taskId int, lo, hi uint64) PgUtilization {
+	rv := PgUtilization{
+		PgIdx:         pgIdx,
+		TaskID:        taskId,
+		StartCycle:    lo,
+		EndCycle:      hi,
+		SipBusyCycles: busyCyclesWithin(w.sip, lo, hi),
+		DmaBusyCycles: busyCyclesWithin(w.dma, lo, hi),
+		CqmBusyCycles: busyCyclesWithin(w.cqm, lo, hi),
+		IdleByCause:   make(map[IdleCause]uint64),
+	}
+	for _, gap := range complementIntervals(w.sip, lo, hi) {
+		rv.IdleGapCount++
+		rv.IdleCycles += gap[1] - gap[0]
+		w.classifyGap(gap[0], gap[1], rv.IdleByCause)
+	}
+	return rv
+}
+
+// Gap is cut at every boundary of the cause intervals,
+// then each piece is taken by the first cause covering it.
+func (w *pgWork) classifyGap(lo, hi uint64, byCause map[IdleCause]uint64) {
+	points := []uint64{lo, hi}
+	for _, intv := range []rtdata.Interval{w.sleep, w.dma, w.task} {
+		for _, v := range intv {
+			for _, pt := range v {
+				if pt > lo && pt < hi {
+					points = append(points, pt)
+				}
+			}
+		}
+	}
+	sort.Slice(points, func(i, j int) bool { return points[i] < points[j] })
+	for i := 1; i < len(points); i++ {
+		pieceLo, pieceHi := points[i-1], points[i]
+		if pieceLo == pieceHi {
+			continue
+		}
+		for _, cause := range idleCauseOrder {
+			if w.takenBy(cause, pieceLo) {
+				byCause[cause] += pieceHi - pieceLo
+				break
+			}
+		}
+	}
+}
+
+func (w *pgWork) takenBy(cause IdleCause, cy uint64) bool {
+	switch cause {
+	case IdleCause_Sleep:
+		return isCovered(w.sleep, cy)
+	case IdleCause_WaitDma:
+		return isCovered(w.dma, cy)
+	case IdleCause_WaitLaunch:
+		return !isCovered(w.task, cy)
+	}
+	return true
+}
+
+// Merged intervals only, half open as [start, end)
+func isCovered(merged rtdata.Interval, cy uint64) bool {
+	idx := sort.Search(len(merged), func(i int) bool {
+		return merged[i][1] > cy
+	})
+	return idx < len(merged) && merged[idx][0] <= cy
+}
+
+func busyCyclesWithin(merged rtdata.Interval, lo, hi uint64) uint64 {
+	var rv uint64
+	for _, v := range merged {
+		start, end := clipCycle(v[0], lo, hi), clipCycle(v[1], lo, hi)
+		rv += end - start
+	}
+	return rv
+}
+
+func complementIntervals(merged rtdata.Interval, lo, hi uint64) rtdata.Interval {
+	var rv rtdata.Interval
+	cur := lo
+	for _, v := range merged {
+		if v[1] <= cur {
+			continue
+		}
+		if v[0] >= hi {
+			break
+		}
+		if v[0] > cur {
+			rv = append(rv, []uint64{cur, v[0]})
+		}
+		cur = v[1]
+	}
+	if cur < hi {
+		rv = append(rv, []uint64{cur, hi})
+	}
+	return rv
+}
+
+func (p PgUtilization) idleRate(cause IdleCause) string {
+	if p.IdleCycles == 0 {
+		return "0(0.00%)"
+	}
+	return fmt.Sprintf("%v(%.2f%%)", p.IdleByCause[cause],
+		float64(p.IdleByCause[cause])/float64(p.IdleCycles)*100)
+}
+
+func dumpPgUtilization(fout io.Writer, vec []PgUtilization) {
+	fmt.Fprintf(fout, "pg task span sip_busy util dma_busy cqm_busy "+
+		"idle gaps cqm_sleep wait_dma wait_launch cqm\n")
+	for _, p := range vec {
+		fmt.Fprintf(fout, "%v %v %v %v %.2f%% %v %v %v %v %v %v %v %v\n",
+			p.PgIdx, p.TaskID, p.SpanCycles(),
+			p.SipBusyCycles, p.Utilization()*100,
+			p.DmaBusyCycles, p.CqmBusyCycles,
+			p.IdleCycles, p.IdleGapCount,
+			p.idleRate(IdleCause_Sleep), p.idleRate(IdleCause_WaitDma),
+			p.idleRate(IdleCause_WaitLaunch), p.idleRate(IdleCause_Cqm),
+		)
+	}
+}
+
+func (r UtilizationReport) Dump(fout io.Writer) {
+	fmt.Fprintf(fout, "# run span: [%v, %v] %v cycles\n",
+		r.StartCycle, r.EndCycle, r.EndCycle-r.StartCycle)
+	fmt.Fprintf(fout, "\n# engine utilization\n")
+	fmt.Fprintf(fout, "engine cluster index vc pg acts busy util\n")
+	for _, e := range r.Engines {
+		fmt.Fprintf(fout, "%v %v %v %v %v %v %v %.2f%%\n",
+			e.EngineType, e.ClusterID, e.EngineIndex, e.VcId, e.PgIdx,
+			e.ActCount, e.BusyCycles, e.Utilization()*100)
+	}
+	fmt.Fprintf(fout, "\n# pg utilization over the run\n")
+	dumpPgUtilization(fout, r.Pgs)
+	fmt.Fprintf(fout, "\n# pg utilization per task\n")
+	dumpPgUtilization(fout, r.Tasks)
+}
@@ -0,0 +1,65 @@
+package rtinfo
+
+import (
+	"testing"
+
+	"git.enflame.cn/hai.bai/dmaster/codec"
+	"git.enflame.cn/hai.bai/dmaster/rtinfo/rtdata"
+	"git.enflame.cn/hai.bai/dmaster/vgrule"
+)
+
+// Every engine is in pg 0
+type singlePgRule struct {
+	vgrule.EngineOrder
+}
+
+func (singlePgRule) GetEngineOrderIndex(codec.DpfEvent) int { return 0 }
+func (singlePgRule) GetCqmEngineOrder(codec.DpfEvent) int   { return 0 }
+
+func newTestAct(engineType codec.EngineTypeCode, event int,
+	start, end uint64) rtdata.DpfAct {
+	return rtdata.DpfAct{
+		Start: codec.DpfEvent{EngineTypeCode: engineType, Event: event, Cycle: start},
+		End:   codec.DpfEvent{EngineTypeCode: engineType, Event: event - 1, Cycle: end},
+	}
+}
+
+func TestPgIdleGapClassify(t *testing.T) {
+	kernels := []rtdata.KernelActivity{
+		{DpfAct: newTestAct(codec.EngCat_SIP, 1, 0, 10)},
+		{DpfAct: newTestAct(codec.EngCat_SIP, 1, 60, 100)},
+	}
+	dmas := []rtdata.DmaActivity{
+		{DpfAct: newTestAct(codec.EngCat_CDMA, 1, 10, 20)},
+	}
+	fwActs := []rtdata.FwActivity{
+		{DpfAct: newTestAct(codec.EngCat_CQM, codec.CqmSleepStart, 30, 40)},
+	}
+	taskActMap := map[int]rtdata.FwActivity{
+		1: {DpfAct: newTestAct(codec.EngCat_CQM, codec.CqmExecutableStart, 0, 50)},
+	}
+	report := GenerateUtilization(singlePgRule{},
+		kernels, nil, dmas, fwActs, taskActMap)
+	if len(report.Pgs) != 1 || len(report.Tasks) != 1 {
+		t.Fatalf("expecting 1 pg and 1 task, got %v %v",
+			len(report.Pgs), len(report.Tasks))
+	}
+	pg := report.Pgs[0]
+	if pg.SipBusyCycles != 50 || pg.IdleCycles != 50 || pg.IdleGapCount != 1 {
+		t.Fatalf("unexpected pg utilization: %+v", pg)
+	}
+	expected := map[IdleCause]uint64{
+		IdleCause_WaitDma:    10,
+		IdleCause_Cqm:        20,
+		IdleCause_Sleep:      10,
+		IdleCause_WaitLaunch: 10,
+	}
+	for cause, cy := range expected {
+		if pg.IdleByCause[cause] != cy {
+			t.Errorf("%v: expecting %v, got %v", cause, cy, pg.IdleByCause[cause])
+		}
+	}
+	if task := report.Tasks[0]; task.SipBusyCycles != 10 || task.IdleCycles != 40 {
+		t.Errorf("unexpected task utilization: %+v", task)
+	}
+}
@@ -0,0 +1,199 @@
+package rtinfo
+
+import (
+	"sort"
+
+	"git.enflame.cn/hai.bai/dmaster/codec"
+	"git.enflame.cn/hai.bai/dmaster/rtinfo/rtdata"
+)
+
+// Flows follow a launch through to the engine work it triggered:
+// TS launch -> CQM executable of the task -> DTU ops of the task ->
+// DMAs owned by the op and sub ops attributed to the op.
+type FlowKind string
+
+const (
+	FlowKind_Launch FlowKind = "launch" // TS launch to CQM executable
+	FlowKind_Exec   FlowKind = "exec"   // CQM executable to DTU op
+	FlowKind_Dma    FlowKind = "dma"    // DTU op to DMA
+	FlowKind_Kernel FlowKind = "kernel" // DTU op to sub op
+)
+
+type FlowNodeKind string
+
+const (
+	FlowNode_Launch FlowNodeKind = "launch" // TS row in fw
+	FlowNode_Exec   FlowNodeKind = "exec"   // CQM row in fw
+	FlowNode_Op     FlowNodeKind = "op"     // dtu_op
+	FlowNode_Dma    FlowNodeKind = "dma"    // memcpy
+	FlowNode_Kernel FlowNodeKind = "kernel" // kernel
+)
+
+// FlowNode is an activity by what tells it apart on the device, the
+// dumpers find their rows of the links by it
+type FlowNode struct {
+	Kind        FlowNodeKind
+	StartCycle  uint64
+	EndCycle    uint64
+	EngineType  codec.EngineTypeCode
+	ClusterID   int
+	EngineIndex int
+	PacketID    int
+}
+
+func NewFlowNode(kind FlowNodeKind, act rtdata.DpfAct) FlowNode {
+	return FlowNode{
+		Kind:        kind,
+		StartCycle:  act.StartCycle(),
+		EndCycle:    act.EndCycle(),
+		EngineType:  act.Start.EngineTypeCode,
+		ClusterID:   act.Start.ClusterID,
+		EngineIndex: act.Start.EngineIndex,
+		PacketID:    act.Start.PacketID,
+	}
+}
+
+type FlowLink struct {
+	Kind   FlowKind
+	TaskId int
+	Src    FlowNode
+	Dst    FlowNode
+}
+
+func isTsLaunch(act rtdata.FwActivity) bool {
+	return act.Start.EngineTypeCode == codec.EngCat_TS &&
+		act.Start.Event == codec.TsLaunchCqmStart
+}
+
+// FwFlowNodeKind tells if the FW activity may be an end of a link
+func FwFlowNodeKind(act rtdata.FwActivity) (FlowNodeKind, bool) {
+	if isTsLaunch(act) {
+		return FlowNode_Launch, true
+	}
+	if act.Start.EngineTypeCode == codec.EngCat_CQM &&
+		act.Start.Event == codec.CqmExecutableStart {
+		return FlowNode_Exec, true
+	}
+	return "", false
+}
+
+// MatchTaskLaunches pairs the CQM executables with the TS launches,
+// both in time order: an executable takes the latest launch not yet
+// taken that started before it, so that a launch without executable
+// is left alone instead of shifting all the pairs after it.
+func MatchTaskLaunches(fwActs []rtdata.FwActivity,
+	taskActMap map[int]rtdata.FwActivity) map[int]rtdata.FwActivity {
+	var launches []rtdata.FwActivity
+	for _, act := range fwActs {
+		if isTsLaunch(act) {
+			launches = append(launches, act)
+		}
+	}
+	sort.SliceStable(launches, func(i, j int) bool {
+		return launches[i].StartCycle() < launches[j].StartCycle()
+	})
+	var taskIds []int
+	for taskId := range taskActMap {
+		taskIds = append(taskIds, taskId)
+	}
+	sort.Slice(taskIds, func(i, j int) bool {
+		lhs, rhs := taskActMap[taskIds[i]], taskActMap[taskIds[j]]
+		if lhs.StartCycle() != rhs.StartCycle() {
+			return lhs.StartCycle() < rhs.StartCycle()
+		}
+		return taskIds[i] < taskIds[j]
+	})
+
+	rv := make(map[int]rtdata.FwActivity)
+	var untaken []rtdata.FwActivity // started so far, the latest on top
+	next := 0
+	for _, taskId := range taskIds {
+		execStart := taskActMap[taskId].StartCycle()
+		for next < len(launches) && launches[next].StartCycle() <= execStart {
+			untaken = append(untaken, launches[next])
+			next++
+		}
+		if top := len(untaken) - 1; top >= 0 {
+			rv[taskId] = untaken[top]
+			untaken = untaken[:top]
+		}
+	}
+	return rv
+}
+
+// GenerateFlowLinks links the activities by the attribution done before,
+// ordered by kind then source
+func GenerateFlowLinks(
+	fwActs []rtdata.FwActivity,
+	taskActMap map[int]rtdata.FwActivity,
+	dtuOps []rtdata.OpActivity,
+	dmaActs []rtdata.CookedDmaActivity,
+	subOps []rtdata.KernelActivity,
+) []FlowLink {
+	var links []FlowLink
+
+	launches := MatchTaskLaunches(fwActs, taskActMap)
+	var taskIds []int
+	for taskId := range launches {
+		taskIds = append(taskIds, taskId)
+	}
+	sort.Ints(taskIds)
+	for _, taskId := range taskIds {
+		links = append(links, FlowLink{
+			Kind:   FlowKind_Launch,
+			TaskId: taskId,
+			Src:    NewFlowNode(FlowNode_Launch, launches[taskId].DpfAct),
+			Dst:    NewFlowNode(FlowNode_Exec, taskActMap[taskId].DpfAct),
+		})
+	}
+
+	type opKey struct{ taskId, opId int }
+	opNodes := make(map[opKey]FlowNode)
+	for _, act := range dtuOps {
+		if !act.IsOpRefValid() {
+			continue
+		}
+		taskId := act.GetTaskID()
+		node := NewFlowNode(FlowNode_Op, act.DpfAct)
+		opNodes[opKey{taskId, act.GetOp().OpId}] = node
+		if exec, ok := taskActMap[taskId]; ok {
+			links = append(links, FlowLink{
+				Kind:   FlowKind_Exec,
+				TaskId: taskId,
+				Src:    NewFlowNode(FlowNode_Exec, exec.DpfAct),
+				Dst:    node,
+			})
+		}
+	}
+
+	for _, act := range dmaActs {
+		if !act.OwnerOpValid || !act.IsDmaMetaRefValid() {
+			continue
+		}
+		taskId := act.GetTask().TaskID
+		if op, ok := opNodes[opKey{taskId, act.OwnerOpId}]; ok {
+			links = append(links, FlowLink{
+				Kind:   FlowKind_Dma,
+				TaskId: taskId,
+				Src:    op,
+				Dst:    NewFlowNode(FlowNode_Dma, act.DpfAct),
+			})
+		}
+	}
+
+	for _, act := range subOps {
+		rtInfo := act.RtInfo
+		if !rtInfo.SubValid {
+			continue
+		}
+		if op, ok := opNodes[opKey{rtInfo.TaskId, rtInfo.OpId}]; ok {
+			links = append(links, FlowLink{
+				Kind:   FlowKind_Kernel,
+				TaskId: rtInfo.TaskId,
+				Src:    op,
+				Dst:    NewFlowNode(FlowNode_Kernel, act.DpfAct),
+			})
+		}
+	}
+	return links
+}
@@ -0,0 +1,100 @@
+package rtinfo
+
+import (
+	"testing"
+
+	"git.enflame.cn/hai.bai/dmaster/codec"
+	"git.enflame.cn/hai.bai/dmaster/rtinfo/rtdata"
+)
+
+func newFlowFwAct(engine codec.EngineTypeCode, event int,
+	startCy, endCy uint64) rtdata.FwActivity {
+	return rtdata.FwActivity{DpfAct: rtdata.DpfAct{
+		Start: codec.DpfEvent{EngineTypeCode: engine, Event: event, Cycle: startCy},
+		End:   codec.DpfEvent{EngineTypeCode: engine, Event: event, Cycle: endCy},
+	}}
+}
+
+func TestFlowLinkLaunches(t *testing.T) {
+	launch := func(startCy uint64) rtdata.FwActivity {
+		return newFlowFwAct(codec.EngCat_TS, codec.TsLaunchCqmStart,
+			startCy, startCy+5)
+	}
+	exec := func(startCy uint64) rtdata.FwActivity {
+		return newFlowFwAct(codec.EngCat_CQM, codec.CqmExecutableStart,
+			startCy, startCy+50)
+	}
+	fwActs := []rtdata.FwActivity{
+		launch(200), launch(10), launch(100),
+		newFlowFwAct(codec.EngCat_TS, codec.TsLaunchCqmStart+1, 0, 1),
+		exec(20), exec(120), exec(300),
+	}
+	taskActMap := map[int]rtdata.FwActivity{
+		7: exec(120),
+		5: exec(20),
+		9: exec(150), // the launch at 200 is after it
+	}
+
+	launches := MatchTaskLaunches(fwActs, taskActMap)
+	expected := map[int]uint64{5: 10, 7: 100}
+	if len(launches) != len(expected) {
+		t.Fatalf("expecting %v launches, got %v", len(expected), launches)
+	}
+	for taskId, startCy := range expected {
+		if launches[taskId].StartCycle() != startCy {
+			t.Errorf("task %v: expecting launch at %v, got %v",
+				taskId, startCy, launches[taskId].StartCycle())
+		}
+	}
+
+	links := GenerateFlowLinks(fwActs, taskActMap, nil, nil, nil)
+	if len(links) != 2 {
+		t.Fatalf("expecting 2 links, got %v", links)
+	}
+	for i, taskId := range []int{5, 7} {
+		link := links[i]
+		if link.Kind != FlowKind_Launch || link.TaskId != taskId ||
+			link.Src.Kind != FlowNode_Launch || link.Dst.Kind != FlowNode_Exec ||
+			link.Dst.StartCycle != taskActMap[taskId].StartCycle() {
+			t.Errorf("link %v: unexpected %+v", i, link)
+		}
+	}
+	for _, act := range fwActs {
+		kind, ok := FwFlowNodeKind(act)
+		if act.Start.EngineTypeCode == codec.EngCat_CQM {
+			if !ok || kind != FlowNode_Exec {
+				t.Errorf("executable must be an exec node, got %v %v", kind, ok)
+			}
+		} else if ok != isTsLaunch(act) {
+			t.Errorf("%v: unexpected node kind %v", act.Start.Event, kind)
+		}
+	}
+}
+
+func TestFlowLinkOrphanLaunch(t *testing.T) {
+	launch := func(startCy uint64) rtdata.FwActivity {
+		return newFlowFwAct(codec.EngCat_TS, codec.TsLaunchCqmStart,
+			startCy, startCy+5)
+	}
+	exec := func(startCy uint64) rtdata.FwActivity {
+		return newFlowFwAct(codec.EngCat_CQM, codec.CqmExecutableStart,
+			startCy, startCy+50)
+	}
+	// The launch at 10 has no executable
+	fwActs := []rtdata.FwActivity{launch(10), launch(30), launch(60)}
+	taskActMap := map[int]rtdata.FwActivity{
+		1: exec(40),
+		2: exec(70),
+	}
+	launches := MatchTaskLaunches(fwActs, taskActMap)
+	expected := map[int]uint64{1: 30, 2: 60}
+	if len(launches) != len(expected) {
+		t.Fatalf("expecting %v launches, got %v", len(expected), launches)
+	}
+	for taskId, startCy := range expected {
+		if launches[taskId].StartCycle() != startCy {
+			t.Errorf("task %v: expecting launch at %v, got %v",
+				taskId, startCy, launches[taskId].StartCycle())
+		}
+	}
+}
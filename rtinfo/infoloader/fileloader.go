@@ -335,6 +335,28 @@ func (d metaFileLoader) LoadExecScope(execUuid uint64) *metadata.ExecScope {
 	return nil
 }
 
+func (d metaFileLoader) LoadKernelAsserts(execUuid uint64) (
+	metadata.KernelAssertDict, bool) {
+	inputName := filepath.Join(d.startupPath,
+		metadata.KernelAssertFileName(execUuid))
+	fin, err := os.Open(inputName)
+	if err != nil {
+		return nil, false
+	}
+	defer fin.Close()
+	dc := make(metadata.KernelAssertDict)
+	scan := bufio.NewScanner(fin)
+	for scan.Scan() {
+		info, ok := metadata.ParseKernelAssertLine(scan.Text())
+		if !ok {
+			log.Printf("malformed assert line in %v: %v", inputName, scan.Text())
+			continue
+		}
+		dc[info.CauseId] = append(dc[info.CauseId], info)
+	}
+	return dc, true
+}
+
 type bufferLoader struct {
 	rawfilenames []string
 }
@@ -0,0 +1,179 @@
+package rtinfo
+
+import (
+	"fmt"
+	"io"
+	"sort"
+
+	"git.enflame.cn/hai.bai/dmaster/codec"
+	"git.enflame.cn/hai.bai/dmaster/efintf"
+	"git.enflame.cn/hai.bai/dmaster/efintf/sessintf"
+	"git.enflame.cn/hai.bai/dmaster/meta/metadata"
+	"git.enflame.cn/hai.bai/dmaster/rtinfo/rtdata"
+	"git.enflame.cn/hai.bai/dmaster/vgrule"
+)
+
+// KernelAssertQueue keeps the assert-carrying SIP events out of the ring buffer
+type KernelAssertQueue struct {
+	events []codec.DpfEvent
+}
+
+func NewKernelAssertQueue() *KernelAssertQueue {
+	return &KernelAssertQueue{}
+}
+
+func (q *KernelAssertQueue) GetEngineTypeCodes() []codec.EngineTypeCode {
+	return []codec.EngineTypeCode{codec.EngCat_SIP}
+}
+
+func (q *KernelAssertQueue) DispatchEvent(evt codec.DpfEvent) error {
+	if codec.IsKernelAssertEvent(evt) {
+		q.events = append(q.events, evt)
+	}
+	return nil
+}
+
+func (q *KernelAssertQueue) Finalizes() {
+	sort.SliceStable(q.events, func(i, j int) bool {
+		return q.events[i].Cycle < q.events[j].Cycle
+	})
+}
+
+func (q *KernelAssertQueue) SelfClone() sessintf.ConcurEventSinker {
+	return NewKernelAssertQueue()
+}
+
+func (q KernelAssertQueue) MergeTo(lhs interface{}) bool {
+	master := lhs.(*KernelAssertQueue)
+	master.events = append(master.events, q.events...)
+	return true
+}
+
+func (q KernelAssertQueue) Events() []codec.DpfEvent {
+	return q.events
+}
+
+type KernelAssert struct {
+	Event     codec.DpfEvent
+	CauseId   int
+	TaskId    int // -1 if no task
+	ExecUuid  uint64
+	OpId      int // -1 if no kernel covers it
+	OpName    string
+	SubOpName string
+	Infos     []metadata.KernelAssertInfo // more than one for duplicated cause id
+}
+
+func (a KernelAssert) Resolved() bool {
+	return len(a.Infos) > 0
+}
+
+// file:line: message, or the cause id if not resolved
+func (a KernelAssert) Location() string {
+	if !a.Resolved() {
+		return fmt.Sprintf("unknown cause id %v", a.CauseId)
+	}
+	rv := a.Infos[0].String()
+	if len(a.Infos) > 1 {
+		rv += fmt.Sprintf(" (+%v more)", len(a.Infos)-1)
+	}
+	return rv
+}
+
+func (a KernelAssert) Context() string {
+	rv := fmt.Sprintf("sip.%v.%v", a.Event.ClusterID, a.Event.EngineIndex)
+	if a.TaskId >= 0 {
+		rv += fmt.Sprintf(" task %v(0x%016x)", a.TaskId, a.ExecUuid)
+	}
+	if a.OpId >= 0 {
+		rv += fmt.Sprintf(" op %v.%v", a.OpName, a.OpId)
+	}
+	if a.SubOpName != "" {
+		rv += fmt.Sprintf(" sub %v", a.SubOpName)
+	}
+	return rv
+}
+
+type KernelAssertReport struct {
+	Asserts    []KernelAssert
+	Unresolved int
+}
+
+func (r KernelAssertReport) Dump(out io.Writer) {
+	fmt.Fprintf(out, "# %v kernel assert(s), %v unresolved\n",
+		len(r.Asserts), r.Unresolved)
+	for _, a := range r.Asserts {
+		fmt.Fprintf(out, "[%v] %v: %v\n", a.Event.Cycle, a.Context(), a.Location())
+		for i := 1; i < len(a.Infos); i++ {
+			fmt.Fprintf(out, "    or %v\n", a.Infos[i])
+		}
+	}
+}
+
+// The kernel on the same SIP covering the cycle
+func locateKernelFor(kernelActs []rtdata.KernelActivity,
+	evt codec.DpfEvent) (rtdata.KernelActivity, bool) {
+	for _, act := range kernelActs {
+		if act.Start.ClusterID == evt.ClusterID &&
+			act.Start.EngineIndex == evt.EngineIndex &&
+			act.StartCycle() <= evt.Cycle && evt.Cycle <= act.EndCycle() {
+			return act, true
+		}
+	}
+	return rtdata.KernelActivity{}, false
+}
+
+// ResolveKernelAsserts looks up the cause ids in the assert sections of
+// the task's exec, only loaders implementing efintf.KernelAssertLoader
+// are able to provide them.
+func (rtm *RuntimeTaskManager) ResolveKernelAsserts(
+	events []codec.DpfEvent,
+	loader efintf.InfoReceiver,
+	kernelActs []rtdata.KernelActivity,
+	rule vgrule.EngineOrder,
+) KernelAssertReport {
+	var rv KernelAssertReport
+	if len(events) == 0 {
+		return rv
+	}
+	assertLoader, loaderOK := loader.(efintf.KernelAssertLoader)
+	dicts := make(map[uint64]metadata.KernelAssertDict)
+	lookupDict := func(execUuid uint64) metadata.KernelAssertDict {
+		if dc, ok := dicts[execUuid]; ok {
+			return dc
+		}
+		var dc metadata.KernelAssertDict
+		if loaderOK {
+			dc, _ = assertLoader.LoadKernelAsserts(execUuid)
+		}
+		dicts[execUuid] = dc
+		return dc
+	}
+
+	for _, evt := range events {
+		a := KernelAssert{
+			Event:   evt,
+			CauseId: evt.Payload,
+			TaskId:  -1,
+			OpId:    -1,
+		}
+		if task, found := rtm.locateTask(evt, rule, MatchToSip{}, nil); found {
+			a.TaskId, a.ExecUuid = task.GetTaskID(), task.GetExecUuid()
+			a.Infos = lookupDict(a.ExecUuid)[a.CauseId]
+		}
+		if kernAct, ok := locateKernelFor(kernelActs, evt); ok &&
+			kernAct.RtInfo.SubValid {
+			a.OpId, a.SubOpName = kernAct.RtInfo.OpId, kernAct.RtInfo.Name
+			if rtm.execKnowledge != nil {
+				if es, ok := rtm.execKnowledge.FindExecScope(a.ExecUuid); ok {
+					a.OpName = es.CopyOpIdMap()[a.OpId]
+				}
+			}
+		}
+		if !a.Resolved() {
+			rv.Unresolved++
+		}
+		rv.Asserts = append(rv.Asserts, a)
+	}
+	return rv
+}
@@ -0,0 +1,65 @@
+package rtinfo
+
+import (
+	"strings"
+	"testing"
+
+	"git.enflame.cn/hai.bai/dmaster/codec"
+	"git.enflame.cn/hai.bai/dmaster/meta/metadata"
+	"git.enflame.cn/hai.bai/dmaster/rtinfo/rtdata"
+)
+
+func TestKernelAssertQueue(t *testing.T) {
+	q := NewKernelAssertQueue()
+	clone := q.SelfClone()
+	for _, evt := range []codec.DpfEvent{
+		{Flag: 1, Event: codec.SipEventKernelAssert, EngineTypeCode: codec.EngCat_SIP, Cycle: 20},
+		{Flag: 1, Event: 1, EngineTypeCode: codec.EngCat_SIP, Cycle: 10},
+		{Flag: 1, Event: codec.SipEventKernelAssert, EngineTypeCode: codec.EngCat_SIP, Cycle: 5},
+	} {
+		clone.DispatchEvent(evt)
+	}
+	clone.Finalizes()
+	clone.MergeTo(q)
+	events := q.Events()
+	if len(events) != 2 || events[0].Cycle != 5 {
+		t.Fatalf("expecting the two assert events in order, got %v", events)
+	}
+
+	// The event id of another firmware
+	codec.SetKernelAssertEvent(1)
+	defer codec.SetKernelAssertEvent(codec.SipEventKernelAssert)
+	if !codec.IsKernelAssertEvent(codec.DpfEvent{Flag: 1, Event: 1,
+		EngineTypeCode: codec.EngCat_SIP}) {
+		t.Errorf("expecting event 1 taken as assert once set")
+	}
+}
+
+func TestKernelAssertContext(t *testing.T) {
+	kernelActs := []rtdata.KernelActivity{{
+		DpfAct: rtdata.DpfAct{
+			Start: codec.DpfEvent{ClusterID: 1, EngineIndex: 2, Cycle: 100},
+			End:   codec.DpfEvent{ClusterID: 1, EngineIndex: 2, Cycle: 200},
+		},
+	}}
+	evt := codec.DpfEvent{ClusterID: 1, EngineIndex: 2, Cycle: 150, Payload: 7}
+	if _, ok := locateKernelFor(kernelActs, evt); !ok {
+		t.Errorf("kernel must be located")
+	}
+	evt.EngineIndex = 3
+	if _, ok := locateKernelFor(kernelActs, evt); ok {
+		t.Errorf("kernel on another sip must not be located")
+	}
+
+	a := KernelAssert{Event: evt, CauseId: 7, TaskId: 3, OpId: -1,
+		Infos: []metadata.KernelAssertInfo{{
+			CauseId: 7, SrcFile: "conv.cc", LineNo: 42, UserMsg: "oops",
+		}},
+	}
+	if a.Location() != "conv.cc:42: oops" {
+		t.Errorf("unexpected location: %v", a.Location())
+	}
+	if !strings.Contains(a.Context(), "task 3") {
+		t.Errorf("unexpected context: %v", a.Context())
+	}
+}
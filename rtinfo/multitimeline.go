@@ -0,0 +1,143 @@
+package rtinfo
+
+import (
+	"fmt"
+	"io"
+	"sort"
+
+	"git.enflame.cn/hai.bai/dmaster/rtinfo/rtdata"
+)
+
+// All devices in one job share the same host clock,
+// each device timeline is measured against it by its own sync points.
+type DeviceTimeline struct {
+	DeviceID   int
+	Tm         *TimelineManager
+	FirstCycle uint64 // cycle of the first device activity to be anchored
+	FirstValid bool
+}
+
+type DeviceTimelineStat struct {
+	DeviceID       int
+	SyncPointCount int
+	FreqMHz        float64
+	Bias           int64   // mean residual of mapped time to host time, ns
+	DriftPpm       float64 // residual change per host time span
+	MaxDrift       int64
+	OffsetToRef    int64
+	DriftPpmToRef  float64
+	AnchorDelta    int64 // first device activity to the latest cpu op started before
+	AnchorValid    bool
+	AnchorCpuOp    string
+	CorrectionUsed int64
+}
+
+type MultiDeviceAlignReport struct {
+	RefDevice int
+	Devices   []DeviceTimelineStat
+}
+
+func measureDeviceTimeline(tm *TimelineManager) DeviceTimelineStat {
+	report := tm.GetFitReport()
+	stat := DeviceTimelineStat{
+		SyncPointCount: len(report.Residuals),
+		FreqMHz:        report.FreqMHz,
+		MaxDrift:       report.MaxDrift,
+	}
+	lz := len(report.Residuals)
+	if lz == 0 {
+		return stat
+	}
+	var sum int64
+	for _, v := range report.Residuals {
+		// correction is excluded, the bias is against the raw mapping
+		sum += v.Residual - tm.hostCorrection
+	}
+	stat.Bias = sum / int64(lz)
+	first, last := report.Residuals[0], report.Residuals[lz-1]
+	if span := last.Hosttime - first.Hosttime; span > 0 {
+		stat.DriftPpm = float64(last.Residual-first.Residual) /
+			float64(span) * 1e6
+	}
+	return stat
+}
+
+// Cpu ops are sorted by start timestamp
+func findCpuOpAnchor(cpuOps []rtdata.CpuOpAct, hosttime uint64) (
+	rtdata.CpuOpAct, bool) {
+	idx := sort.Search(len(cpuOps), func(i int) bool {
+		return cpuOps[i].StartTimestamp > hosttime
+	})
+	if idx == 0 {
+		return rtdata.CpuOpAct{}, false
+	}
+	return cpuOps[idx-1], true
+}
+
+// AlignDevicesToHost measures every device against the host clock,
+// and shifts each one by its bias if correct is set,
+// so that all devices are placed on the very same host timeline.
+func AlignDevicesToHost(devs []DeviceTimeline,
+	cpuOps []rtdata.CpuOpAct,
+	correct bool,
+) MultiDeviceAlignReport {
+	sortedCpuOps := make([]rtdata.CpuOpAct, len(cpuOps))
+	copy(sortedCpuOps, cpuOps)
+	sort.Slice(sortedCpuOps, func(i, j int) bool {
+		return sortedCpuOps[i].StartTimestamp < sortedCpuOps[j].StartTimestamp
+	})
+
+	rv := MultiDeviceAlignReport{RefDevice: -1}
+	for _, dev := range devs {
+		stat := measureDeviceTimeline(dev.Tm)
+		stat.DeviceID = dev.DeviceID
+		if correct && stat.SyncPointCount > 0 {
+			dev.Tm.SetHostCorrection(-stat.Bias)
+		}
+		stat.CorrectionUsed = dev.Tm.hostCorrection
+		if dev.FirstValid {
+			if hosttime, ok := dev.Tm.MapToHosttime(dev.FirstCycle); ok {
+				if cpuOp, found := findCpuOpAnchor(sortedCpuOps, hosttime); found {
+					stat.AnchorDelta = int64(hosttime - cpuOp.StartTimestamp)
+					stat.AnchorValid = true
+					stat.AnchorCpuOp = cpuOp.Name
+				}
+			}
+		}
+		// The first one with sync points is the reference
+		if rv.RefDevice < 0 && stat.SyncPointCount > 0 {
+			rv.RefDevice = len(rv.Devices)
+		}
+		rv.Devices = append(rv.Devices, stat)
+	}
+
+	if rv.RefDevice >= 0 {
+		ref := rv.Devices[rv.RefDevice]
+		for i := range rv.Devices {
+			rv.Devices[i].OffsetToRef = rv.Devices[i].Bias - ref.Bias
+			rv.Devices[i].DriftPpmToRef = rv.Devices[i].DriftPpm - ref.DriftPpm
+		}
+		rv.RefDevice = ref.DeviceID
+	}
+	return rv
+}
+
+func (r MultiDeviceAlignReport) Dump(fout io.Writer) {
+	fmt.Fprintf(fout, "# multi-device timeline, reference device: %v\n", r.RefDevice)
+	fmt.Fprintf(fout, "device syncpoints freq(MHz) bias(ns) drift(ppm) max_drift(ns) "+
+		"offset_to_ref(ns) drift_to_ref(ppm) correction(ns) anchor(ns) anchor_op\n")
+	for _, d := range r.Devices {
+		freq, anchor, anchorOp := "-", "-", "-"
+		if d.FreqMHz > 0 {
+			freq = fmt.Sprintf("%.6f", d.FreqMHz)
+		}
+		if d.AnchorValid {
+			anchor, anchorOp = fmt.Sprintf("%v", d.AnchorDelta), d.AnchorCpuOp
+		}
+		fmt.Fprintf(fout, "%v %v %v %v %.3f %v %v %.3f %v %v %v\n",
+			d.DeviceID, d.SyncPointCount, freq,
+			d.Bias, d.DriftPpm, d.MaxDrift,
+			d.OffsetToRef, d.DriftPpmToRef,
+			d.CorrectionUsed, anchor, anchorOp)
+	}
+}
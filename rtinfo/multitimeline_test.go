@@ -0,0 +1,74 @@
+package rtinfo
+
+import (
+	"testing"
+
+	"git.enflame.cn/hai.bai/dmaster/rtinfo/rtdata"
+)
+
+// Device cycles are ns, the raw mapping is off by bias from the sync points
+func newBiasedTimeline(hostStart uint64, bias int64) *TimelineManager {
+	aligned := makeAligned([][2]uint64{
+		{1000, hostStart + 1000},
+		{2000, hostStart + 2000},
+		{3000, hostStart + 3000},
+	})
+	return &TimelineManager{
+		alignedVec: aligned,
+		tll: TimelineLinear{
+			hostStart:        uint64(int64(hostStart) + bias),
+			deviceCycleStart: 0,
+		},
+	}
+}
+
+func TestAlignDevicesToHost(t *testing.T) {
+	const hostStart = 1650000000000000000
+	cpuOps := []rtdata.CpuOpAct{
+		{Name: "late", StartTimestamp: hostStart + 900},
+		{Name: "early", StartTimestamp: hostStart + 100},
+	}
+	newDevs := func() []DeviceTimeline {
+		return []DeviceTimeline{
+			{DeviceID: 0, Tm: &TimelineManager{}},
+			{DeviceID: 1, Tm: newBiasedTimeline(hostStart, 50),
+				FirstCycle: 1000, FirstValid: true},
+			{DeviceID: 2, Tm: newBiasedTimeline(hostStart, -30)},
+		}
+	}
+
+	devs := newDevs()
+	report := AlignDevicesToHost(devs, cpuOps, false)
+	if report.RefDevice != 1 || len(report.Devices) != 3 {
+		t.Fatalf("expecting device 1 as the reference, got %+v", report)
+	}
+	d1, d2 := report.Devices[1], report.Devices[2]
+	if d1.Bias != 50 || d2.Bias != -30 || d2.OffsetToRef != -80 {
+		t.Errorf("unexpected bias: %+v, %+v", d1, d2)
+	}
+	if d1.CorrectionUsed != 0 || devs[1].Tm.hostCorrection != 0 {
+		t.Errorf("expecting no correction, got %v", d1.CorrectionUsed)
+	}
+	// First activity is mapped to 1050, the late op is the latest before
+	if !d1.AnchorValid || d1.AnchorCpuOp != "late" || d1.AnchorDelta != 150 {
+		t.Errorf("unexpected anchor: %+v", d1)
+	}
+
+	devs = newDevs()
+	report = AlignDevicesToHost(devs, cpuOps, true)
+	d0, d1, d2 := report.Devices[0], report.Devices[1], report.Devices[2]
+	if d0.CorrectionUsed != 0 || d1.CorrectionUsed != -50 || d2.CorrectionUsed != 30 {
+		t.Errorf("unexpected correction: %v %v %v",
+			d0.CorrectionUsed, d1.CorrectionUsed, d2.CorrectionUsed)
+	}
+	// Bias is measured against the raw mapping, corrected or not
+	if d1.Bias != 50 || d2.OffsetToRef != -80 || d1.AnchorDelta != 100 {
+		t.Errorf("unexpected corrected stat: %+v, %+v", d1, d2)
+	}
+	for _, dev := range devs[1:] {
+		if hosttime, _ := dev.Tm.MapToHosttime(2000); hosttime != hostStart+2000 {
+			t.Errorf("device %v: expecting on the host timeline, got %v",
+				dev.DeviceID, int64(hosttime-hostStart))
+		}
+	}
+}
@@ -10,25 +10,29 @@ import (
 func GenerateKerenlActSeq(
 	kernelActs []rtdata.KernelActivity,
 	sot SubOpTracker,
-) []rtdata.KernelActivity {
+) ([]rtdata.KernelActivity, SubOpAttribReport) {
 	// Sub ops
 	var newSipBusies []rtdata.KernelActivity
+	report := newSubOpAttribReport()
 	for _, kernelAct := range kernelActs {
 		act := kernelAct
 		if act.RtInfo.TaskId > 0 {
 			tid := act.RtInfo.TaskId
-			opId, subIdx, subOpName := sot.LocateOpId(
+			attrib := sot.LocateOpId(
 				tid,
 				act.GetEngineIndex(),
 				act.StartCycle(),
 				act.EndCycle(),
 			)
-			if opId >= 0 && subIdx >= 0 {
-				act.RtInfo.Update(subIdx, subOpName, opId)
+			if attrib.OpId >= 0 && attrib.SubOpIndex >= 0 {
+				act.RtInfo.Update(attrib.SubOpIndex, attrib.SubOpName, attrib.OpId)
+				act.RtInfo.UpdateAttribution(attrib.Confidence, attrib.Reason)
 				newSipBusies = append(newSipBusies, act)
 			}
+			report.add(act, attrib)
 		}
 	}
 	sort.Sort(rtdata.KernelActivityVec(newSipBusies))
-	return newSipBusies
+	report.sortLowConfidence()
+	return newSipBusies, report
 }
@@ -5,7 +5,6 @@ import (
 	"fmt"
 	"io"
 	"math"
-	"os"
 	"sort"
 
 	"git.enflame.cn/hai.bai/dmaster/assert"
@@ -66,7 +65,8 @@ func GenerateBriefOpsStat(
 	executableMap map[int]rtdata.FwActivity,
 	orderTaskVec []rtdata.OrderTask,
 	runtimeTaskVec []rtdata.RuntimeTaskBase,
-) {
+	summary io.Writer,
+) OpCoverageReport {
 
 	var taskVals []int
 	taskVisited := make(map[int]bool)
@@ -98,6 +98,8 @@ func GenerateBriefOpsStat(
 
 	// task id to brief report
 	taskReportMap := make(map[int]string)
+	var coverage OpCoverageReport
+	expectedOpIds := make(map[uint64][]int)
 	for _, tid := range taskVals {
 		reportStream := bytes.NewBuffer(nil)
 		execScope := statByTask[tid].ExecScope
@@ -134,11 +136,14 @@ func GenerateBriefOpsStat(
 			}
 		}
 
-		var gapsCycle uint64
+		var gapsCycle, launchGapCycle uint64
 		var hasExecutableAct = false
 		isBound := false
 		if fwAct, ok := executableMap[tid]; ok && fwAct.End.Event >= 0 {
 			hasExecutableAct = true
+			if len(opSeq) > 0 && startCy > fwAct.StartCycle() {
+				launchGapCycle = startCy - fwAct.StartCycle()
+			}
 			leftBound, rightBound := false, false
 			if startCy >= fwAct.StartCycle() {
 				startCy = fwAct.StartCycle()
@@ -235,7 +240,29 @@ func GenerateBriefOpsStat(
 		statByTask[tid].HasExecAct = hasExecutableAct
 
 		statByExec[thisExecuuid].CollectTaskInfo(tid, totalCy, isBound)
+
+		missingOpIds := []int{}
+		for _, opId := range opIdSeq {
+			if !opIdMap[opId] {
+				missingOpIds = append(missingOpIds, opId)
+			}
+		}
+		expectedOpIds[thisExecuuid] = opIdSeq
+		coverage.Tasks = append(coverage.Tasks, TaskOpCoverage{
+			TaskID:           tid,
+			ExecUuid:         thisExecuuid,
+			PgMask:           statByTask[tid].PgMask,
+			ExpectedOps:      len(opIdMap),
+			ObservedOps:      checkedCount,
+			MissingOpIds:     missingOpIds,
+			TotalCycles:      totalCy,
+			GapCycles:        gapsCycle,
+			LaunchGapCycles:  launchGapCycle,
+			HasExecAct:       hasExecutableAct,
+			BoundedByExecAct: isBound,
+		})
 	}
+	coverage.summarizeExecs(expectedOpIds)
 
 	// Calculate overall info
 	for _, tid := range taskVals {
@@ -259,18 +286,16 @@ func GenerateBriefOpsStat(
 	}
 
 	// Summary
-	if fout, err := os.Create("tasklist.txt"); err == nil {
-		defer fout.Close()
-		dumpStatInfoToFile(fout,
-			taskVals, statByTask, statByExec,
-			taskReportMap,
-			orderTaskVec,
-			runtimeTaskVec,
-		)
-	}
+	dumpStatInfoToFile(summary,
+		taskVals, statByTask, statByExec,
+		taskReportMap,
+		orderTaskVec,
+		runtimeTaskVec,
+	)
+	return coverage
 }
 
-func dumpStatInfoToFile(fout *os.File,
+func dumpStatInfoToFile(fout io.Writer,
 	taskVals []int,
 	statByTask map[int]*TaskInfoState,
 	statByExec map[uint64]*ExecInfoState,
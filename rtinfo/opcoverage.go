@@ -0,0 +1,205 @@
+package rtinfo
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Structured form of what is in tasklist.txt
+
+type TaskOpCoverage struct {
+	TaskID           int    `json:"task_id"`
+	ExecUuid         uint64 `json:"exec_uuid"`
+	PgMask           int    `json:"pg_mask"`
+	ExpectedOps      int    `json:"expected_ops"`
+	ObservedOps      int    `json:"observed_ops"`
+	MissingOpIds     []int  `json:"missing_op_ids"`
+	TotalCycles      uint64 `json:"total_cycles"`
+	GapCycles        uint64 `json:"gap_cycles"`
+	LaunchGapCycles  uint64 `json:"launch_gap_cycles"` // exec act start to the first op
+	HasExecAct       bool   `json:"has_exec_act"`
+	BoundedByExecAct bool   `json:"bounded_by_exec_act"`
+}
+
+func (t TaskOpCoverage) Coverage() float64 {
+	if t.ExpectedOps == 0 {
+		return 1
+	}
+	return float64(t.ObservedOps) / float64(t.ExpectedOps)
+}
+
+type ExecOpCoverage struct {
+	ExecUuid            uint64  `json:"exec_uuid"`
+	TaskCount           int     `json:"task_count"`
+	ExpectedOps         int     `json:"expected_ops"`
+	ObservedOps         int     `json:"observed_ops"` // seen in any of the tasks
+	MissingOpIds        []int   `json:"missing_op_ids"`
+	TotalCycles         uint64  `json:"total_cycles"`
+	MeanCycles          float64 `json:"mean_cycles"`
+	MinCycles           uint64  `json:"min_cycles"`
+	MaxCycles           uint64  `json:"max_cycles"`
+	MeanLaunchGapCycles float64 `json:"mean_launch_gap_cycles"`
+}
+
+func (e ExecOpCoverage) Coverage() float64 {
+	if e.ExpectedOps == 0 {
+		return 1
+	}
+	return float64(e.ObservedOps) / float64(e.ExpectedOps)
+}
+
+type OpCoverageReport struct {
+	Tasks []TaskOpCoverage `json:"tasks"`
+	Execs []ExecOpCoverage `json:"execs"`
+}
+
+func (r OpCoverageReport) Coverage() float64 {
+	expected, observed := 0, 0
+	for _, e := range r.Execs {
+		expected += e.ExpectedOps
+		observed += e.ObservedOps
+	}
+	if expected == 0 {
+		return 1
+	}
+	return float64(observed) / float64(expected)
+}
+
+// Build exec level summary from the task ones
+func (r *OpCoverageReport) summarizeExecs(
+	expectedOpIds map[uint64][]int,
+) {
+	execMap := make(map[uint64]*ExecOpCoverage)
+	observedMap := make(map[uint64]map[int]bool)
+	launchGapCount := make(map[uint64]int)
+	var execVec []uint64
+	for _, t := range r.Tasks {
+		e, ok := execMap[t.ExecUuid]
+		if !ok {
+			e = &ExecOpCoverage{
+				ExecUuid:  t.ExecUuid,
+				MinCycles: t.TotalCycles,
+			}
+			execMap[t.ExecUuid] = e
+			observedMap[t.ExecUuid] = make(map[int]bool)
+			execVec = append(execVec, t.ExecUuid)
+		}
+		e.TaskCount++
+		e.TotalCycles += t.TotalCycles
+		if t.TotalCycles < e.MinCycles {
+			e.MinCycles = t.TotalCycles
+		}
+		if t.TotalCycles > e.MaxCycles {
+			e.MaxCycles = t.TotalCycles
+		}
+		if t.HasExecAct {
+			e.MeanLaunchGapCycles += float64(t.LaunchGapCycles)
+			launchGapCount[t.ExecUuid]++
+		}
+		missing := make(map[int]bool)
+		for _, opId := range t.MissingOpIds {
+			missing[opId] = true
+		}
+		for _, opId := range expectedOpIds[t.ExecUuid] {
+			if !missing[opId] {
+				observedMap[t.ExecUuid][opId] = true
+			}
+		}
+	}
+	sort.Slice(execVec, func(i, j int) bool { return execVec[i] < execVec[j] })
+
+	r.Execs = nil
+	for _, execUuid := range execVec {
+		e := execMap[execUuid]
+		e.ExpectedOps = len(expectedOpIds[execUuid])
+		e.ObservedOps = len(observedMap[execUuid])
+		e.MissingOpIds = []int{}
+		for _, opId := range expectedOpIds[execUuid] {
+			if !observedMap[execUuid][opId] {
+				e.MissingOpIds = append(e.MissingOpIds, opId)
+			}
+		}
+		e.MeanCycles = float64(e.TotalCycles) / float64(e.TaskCount)
+		if cc := launchGapCount[execUuid]; cc > 0 {
+			e.MeanLaunchGapCycles /= float64(cc)
+		}
+		r.Execs = append(r.Execs, *e)
+	}
+}
+
+func (r OpCoverageReport) WriteJSON(fout io.Writer) error {
+	chunk, err := json.MarshalIndent(struct {
+		Coverage float64 `json:"coverage"`
+		OpCoverageReport
+	}{r.Coverage(), r}, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fout.Write(chunk)
+	return err
+}
+
+// JoinOpIds is how the op ids are listed in the CSV and vpd, by spaces
+func JoinOpIds(opIds []int) string {
+	var strs []string
+	for _, opId := range opIds {
+		strs = append(strs, strconv.Itoa(opId))
+	}
+	return strings.Join(strs, " ")
+}
+
+func (r OpCoverageReport) WriteTaskCSV(fout io.Writer) error {
+	w := csv.NewWriter(fout)
+	w.Write([]string{"task_id", "exec_uuid", "pg_mask",
+		"expected_ops", "observed_ops", "coverage", "missing_op_ids",
+		"total_cycles", "gap_cycles", "launch_gap_cycles",
+		"has_exec_act", "bounded_by_exec_act"})
+	for _, t := range r.Tasks {
+		w.Write([]string{
+			strconv.Itoa(t.TaskID),
+			fmt.Sprintf("0x%016x", t.ExecUuid),
+			strconv.Itoa(t.PgMask),
+			strconv.Itoa(t.ExpectedOps),
+			strconv.Itoa(t.ObservedOps),
+			fmt.Sprintf("%.4f", t.Coverage()),
+			JoinOpIds(t.MissingOpIds),
+			strconv.FormatUint(t.TotalCycles, 10),
+			strconv.FormatUint(t.GapCycles, 10),
+			strconv.FormatUint(t.LaunchGapCycles, 10),
+			strconv.FormatBool(t.HasExecAct),
+			strconv.FormatBool(t.BoundedByExecAct),
+		})
+	}
+	w.Flush()
+	return w.Error()
+}
+
+func (r OpCoverageReport) WriteExecCSV(fout io.Writer) error {
+	w := csv.NewWriter(fout)
+	w.Write([]string{"exec_uuid", "task_count",
+		"expected_ops", "observed_ops", "coverage", "missing_op_ids",
+		"total_cycles", "mean_cycles", "min_cycles", "max_cycles",
+		"mean_launch_gap_cycles"})
+	for _, e := range r.Execs {
+		w.Write([]string{
+			fmt.Sprintf("0x%016x", e.ExecUuid),
+			strconv.Itoa(e.TaskCount),
+			strconv.Itoa(e.ExpectedOps),
+			strconv.Itoa(e.ObservedOps),
+			fmt.Sprintf("%.4f", e.Coverage()),
+			JoinOpIds(e.MissingOpIds),
+			strconv.FormatUint(e.TotalCycles, 10),
+			fmt.Sprintf("%.2f", e.MeanCycles),
+			strconv.FormatUint(e.MinCycles, 10),
+			strconv.FormatUint(e.MaxCycles, 10),
+			fmt.Sprintf("%.2f", e.MeanLaunchGapCycles),
+		})
+	}
+	w.Flush()
+	return w.Error()
+}
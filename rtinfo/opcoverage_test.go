@@ -0,0 +1,55 @@
+package rtinfo
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestOpCoverageSummarizeExecs(t *testing.T) {
+	report := OpCoverageReport{
+		Tasks: []TaskOpCoverage{
+			{TaskID: 1, ExecUuid: 0xa, ExpectedOps: 3, ObservedOps: 2,
+				MissingOpIds: []int{3}, TotalCycles: 100,
+				LaunchGapCycles: 10, HasExecAct: true},
+			{TaskID: 2, ExecUuid: 0xa, ExpectedOps: 3, ObservedOps: 2,
+				MissingOpIds: []int{2}, TotalCycles: 300},
+			{TaskID: 3, ExecUuid: 0x5, ExpectedOps: 2, ObservedOps: 0,
+				MissingOpIds: []int{7, 8}, TotalCycles: 50,
+				LaunchGapCycles: 4, HasExecAct: true},
+		},
+	}
+	report.summarizeExecs(map[uint64][]int{
+		0xa: {1, 2, 3},
+		0x5: {7, 8},
+	})
+	if len(report.Execs) != 2 || report.Execs[0].ExecUuid != 0x5 {
+		t.Fatalf("expecting 2 execs in uuid order, got %+v", report.Execs)
+	}
+	// Op 2 and 3 are missing from one of the tasks each, seen in the other
+	e := report.Execs[1]
+	if e.TaskCount != 2 || e.ExpectedOps != 3 || e.ObservedOps != 3 ||
+		len(e.MissingOpIds) != 0 || e.Coverage() != 1 {
+		t.Errorf("unexpected exec 0xa: %+v", e)
+	}
+	if e.MinCycles != 100 || e.MaxCycles != 300 || e.MeanCycles != 200 ||
+		e.MeanLaunchGapCycles != 10 {
+		t.Errorf("unexpected cycles of exec 0xa: %+v", e)
+	}
+	if e := report.Execs[0]; e.ObservedOps != 0 || JoinOpIds(e.MissingOpIds) != "7 8" {
+		t.Errorf("unexpected exec 0x5: %+v", e)
+	}
+	if c := report.Coverage(); c != 0.6 {
+		t.Errorf("expecting 3 of 5 ops covered, got %v", c)
+	}
+
+	out := &bytes.Buffer{}
+	if err := report.WriteTaskCSV(out); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	expected := "1,0x000000000000000a,0,3,2,0.6667,3,100,0,10,true,false"
+	if len(lines) != 4 || lines[1] != expected {
+		t.Errorf("expecting %v, got %v", expected, lines)
+	}
+}
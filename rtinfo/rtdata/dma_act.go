@@ -56,3 +56,30 @@ func (d DmaActivityVec) Less(i, j int) bool {
 func (d DmaActivityVec) Swap(i, j int) {
 	d[i], d[j] = d[j], d[i]
 }
+
+type DmaMatchStatus int
+
+const (
+	DmaMatch_NoMeta  DmaMatchStatus = iota
+	DmaMatch_Matched                // meta found in one of the tasks before
+	DmaMatch_Skipped                // known to have no meta
+)
+
+func (s DmaMatchStatus) String() string {
+	switch s {
+	case DmaMatch_Matched:
+		return "matched"
+	case DmaMatch_Skipped:
+		return "skipped"
+	}
+	return "no_meta"
+}
+
+// DMA activity after cooking, with the DTU op in flight of the same task
+type CookedDmaActivity struct {
+	DmaActivity
+	Status       DmaMatchStatus
+	OwnerOpValid bool
+	OwnerOpId    int
+	OwnerOpName  string
+}
@@ -8,12 +8,37 @@ type RuntimeTaskInfo struct {
 	TaskId int
 }
 
+type AttribReason int
+
+const (
+	AttribReason_None      AttribReason = iota
+	AttribReason_Contained              // kernel is inside the op
+	AttribReason_Overlap                // partly overlapped, the larger ratio wins
+	AttribReason_Fallback               // no overlap at all, the closest guess
+)
+
+func (r AttribReason) String() string {
+	switch r {
+	case AttribReason_Contained:
+		return "contained"
+	case AttribReason_Overlap:
+		return "overlap"
+	case AttribReason_Fallback:
+		return "fallback"
+	}
+	return "none"
+}
+
 type RuntimeInfo struct {
 	RuntimeTaskInfo
 	SubIdx   int
 	Name     string
 	OpId     int
 	SubValid bool
+
+	// How much the op attribution is to be trusted, in [0, 1]
+	Confidence float64
+	Reason     AttribReason
 }
 
 func (rti *RuntimeInfo) Update(subIdx int, name string, opId int) {
@@ -23,6 +48,18 @@ func (rti *RuntimeInfo) Update(subIdx int, name string, opId int) {
 	rti.SubValid = true
 }
 
+// Attributions below are reported, and marked in the vpd
+const LowAttribConfidence = 0.5
+
+func (rti RuntimeInfo) IsLowConfidence() bool {
+	return rti.SubValid && rti.Confidence < LowAttribConfidence
+}
+
+func (rti *RuntimeInfo) UpdateAttribution(confidence float64, reason AttribReason) {
+	rti.Confidence = confidence
+	rti.Reason = reason
+}
+
 type KernelActivity struct {
 	DpfAct
 	RtInfo RuntimeInfo
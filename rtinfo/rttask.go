@@ -593,7 +593,7 @@ func (rtm RuntimeTaskManager) locateTask(
 func (rtm RuntimeTaskManager) GenerateKernelActs(
 	kernelActs []rtdata.KernelActivity,
 	cqmOpSeq []rtdata.OpActivity,
-	rule vgrule.EngineOrder) []rtdata.KernelActivity {
+	rule vgrule.EngineOrder) ([]rtdata.KernelActivity, SubOpAttribReport) {
 
 	// Mark all kernel activities with task id(if found)
 	rtm.assignTaskIdToKernelActivities(kernelActs, rule)
@@ -854,22 +854,24 @@ func (rtm *RuntimeTaskManager) DumpInfos(orderTask []rtdata.OrderTaskStated) {
 	}
 }
 
+// CookDma looks up DMA meta for each activity from the tasks before it,
+// the input is left untouched, and the cooked copies are returned.
 func (rtm *RuntimeTaskManager) CookDma(
 	dmaActVec []rtdata.DmaActivity,
+	dtuOps []rtdata.OpActivity,
 	algo vgrule.ActMatchAlgo,
-) []rtdata.DmaActivity {
+) DmaCookResult {
 	vec := newStatedOrderTaskVector(rtm.orderedTaskVector)
 
-	bingoCount := 0
-	errDmaCount := 0
-	cdmaErrCount, sdmaErrCount := 0, 0
-	skippedDmaCount := 0
+	rv := DmaCookResult{
+		Acts: make([]rtdata.CookedDmaActivity, len(dmaActVec)),
+	}
 	const errPrintLimit = 10
 	for i := 0; i < len(dmaActVec); i++ {
-		curAct := &dmaActVec[i]
+		curAct := &rv.Acts[i]
+		curAct.DmaActivity = dmaActVec[i]
 		startCy := curAct.StartCycle()
 		idxStart := rtm.upperBoundForTaskVec(startCy)
-		foundDmaMeta := false
 	A100:
 		for j := idxStart - 1; j >= 0 &&
 			j > idxStart-1-MAX_BACKTRACE_TASK_COUNT; j-- {
@@ -887,48 +889,33 @@ func (rtm *RuntimeTaskManager) CookDma(
 				curAct.Start.PacketID); err == nil {
 				curAct.SetDmaRef(rtdata.NewDmaRef(&dmaOp,
 					taskInOrder.GetRefToTask()))
-				foundDmaMeta = true
+				curAct.Status = rtdata.DmaMatch_Matched
 				break A100
 			}
 		} // for backtrace all possible tasks
-		if foundDmaMeta {
-			bingoCount++
-		} else {
-			if !shallSkipErrDma(curAct.Start) {
-				errDmaCount++
-				if errDmaCount < errPrintLimit {
-					fmt.Printf("error for no meta dma packet id = %v, %s\n",
-						curAct.Start.PacketID,
-						curAct.Start.EngineTypeCode,
-					)
-				} else if errDmaCount == errPrintLimit {
-					fmt.Printf("too many dma errors\n")
-				}
-
-				// statistics
-				switch curAct.Start.EngineTypeCode {
-				case codec.EngCat_SDMA:
-					sdmaErrCount++
-				case codec.EngCat_CDMA:
-					cdmaErrCount++
-				}
-			} else {
-				skippedDmaCount++
+		switch {
+		case curAct.Status == rtdata.DmaMatch_Matched:
+			rv.MatchedCount++
+		case shallSkipErrDma(curAct.Start):
+			curAct.Status = rtdata.DmaMatch_Skipped
+			rv.SkippedCount++
+		default:
+			rv.ErrCount++
+			if rv.ErrCount < errPrintLimit {
+				fmt.Printf("error for no meta dma packet id = %v, %s\n",
+					curAct.Start.PacketID,
+					curAct.Start.EngineTypeCode,
+				)
+			} else if rv.ErrCount == errPrintLimit {
+				fmt.Printf("too many dma errors\n")
 			}
+			// statistics
+			rv.countUnmatched(curAct.Start)
 		}
 	}
-	fmt.Printf("Dma meta set SUCCESS %v out of %v, error count: %v\n",
-		bingoCount,
-		len(dmaActVec),
-		errDmaCount,
-	)
-	fmt.Printf("   %v are skipped\n", skippedDmaCount)
-	fmt.Printf("   Cdma error: %v, Sdma error: %v\n",
-		cdmaErrCount, sdmaErrCount)
-	if errDmaCount == 0 {
-		fmt.Printf("# DMA all restored successfully\n")
-	}
-	return nil
+	rv.attachOwnerOps(dtuOps)
+	rv.DumpInfo()
+	return rv
 }
 
 // For now only some SDMA are skipped
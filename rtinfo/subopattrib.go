@@ -0,0 +1,72 @@
+package rtinfo
+
+import (
+	"fmt"
+	"io"
+	"sort"
+
+	"git.enflame.cn/hai.bai/dmaster/rtinfo/rtdata"
+)
+
+type SubOpAttribReport struct {
+	Total         int // kernels with task
+	Attributed    int
+	NoOp          int // no op in time
+	NoSubInfo     int // op found, but no sub op meta for the engine
+	ByReason      map[rtdata.AttribReason]int
+	LowConfidence []rtdata.KernelActivity // the least confident first
+}
+
+func newSubOpAttribReport() SubOpAttribReport {
+	return SubOpAttribReport{
+		ByReason: make(map[rtdata.AttribReason]int),
+	}
+}
+
+func (r *SubOpAttribReport) add(act rtdata.KernelActivity, attrib SubOpAttribution) {
+	r.Total++
+	switch {
+	case attrib.OpId < 0:
+		r.NoOp++
+		return
+	case attrib.SubOpIndex < 0:
+		r.NoSubInfo++
+		return
+	}
+	r.Attributed++
+	r.ByReason[attrib.Reason]++
+	if act.RtInfo.IsLowConfidence() {
+		r.LowConfidence = append(r.LowConfidence, act)
+	}
+}
+
+func (r *SubOpAttribReport) sortLowConfidence() {
+	sort.SliceStable(r.LowConfidence, func(i, j int) bool {
+		return r.LowConfidence[i].RtInfo.Confidence <
+			r.LowConfidence[j].RtInfo.Confidence
+	})
+}
+
+func (r SubOpAttribReport) Dump(fout io.Writer) {
+	fmt.Fprintf(fout, "# sub op attribution: %v attributed out of %v, "+
+		"%v without op, %v without sub op info\n",
+		r.Attributed, r.Total, r.NoOp, r.NoSubInfo)
+	for _, reason := range []rtdata.AttribReason{
+		rtdata.AttribReason_Contained,
+		rtdata.AttribReason_Overlap,
+		rtdata.AttribReason_Fallback,
+	} {
+		fmt.Fprintf(fout, "# %v: %v\n", reason, r.ByReason[reason])
+	}
+	fmt.Fprintf(fout, "# %v low confidence (< %v) attribution(s)\n",
+		len(r.LowConfidence), rtdata.LowAttribConfidence)
+	fmt.Fprintf(fout, "task op_id sub_idx name engine start_cycle end_cycle confidence reason\n")
+	for _, act := range r.LowConfidence {
+		name, _ := act.GetSipOpName()
+		fmt.Fprintf(fout, "%v %v %v %v %v.%v %v %v %.4f %v\n",
+			act.RtInfo.TaskId, act.RtInfo.OpId, act.RtInfo.SubIdx, name,
+			act.Start.ClusterID, act.GetEngineIndex(),
+			act.StartCycle(), act.EndCycle(),
+			act.RtInfo.Confidence, act.RtInfo.Reason)
+	}
+}
@@ -33,12 +33,34 @@ func NewSubOpTracker(
 	}
 }
 
-// -1 for no op id
+type SubOpAttribution struct {
+	OpId       int // -1 for no op id
+	SubOpIndex int
+	SubOpName  string
+	Confidence float64
+	Reason     rtdata.AttribReason
+}
+
+// Kernel spreads over two ops, the margin of the ratios is taken
+func scoreAttribution(bestFit, secondFit float64) (float64, rtdata.AttribReason) {
+	const eps = 1e-9
+	switch {
+	case bestFit >= 1-eps:
+		return 1, rtdata.AttribReason_Contained
+	case bestFit > eps:
+		if secondFit < 0 {
+			secondFit = 0
+		}
+		return math.Max(bestFit-secondFit, 0), rtdata.AttribReason_Overlap
+	}
+	return 0, rtdata.AttribReason_Fallback
+}
+
 func (sot SubOpTracker) LocateOpId(taskId int,
 	engineIndex int,
-	startCycle, endCycle uint64) (opId int, subOpIndex int, subOpName string) {
-	opId = -1
-	subOpIndex = -1
+	startCycle, endCycle uint64) (rv SubOpAttribution) {
+	rv.OpId = -1
+	rv.SubOpIndex = -1
 
 	// Wrap engine index:
 	if !sot.oneTaskFlag {
@@ -71,7 +93,7 @@ func (sot SubOpTracker) LocateOpId(taskId int,
 	// From the aspect of timeline view:
 	//      Cqm Op Start           Cqm Op Start
 	//                         Sip Start
-	var maxFit float64 = -1.0
+	var maxFit, secondFit float64 = -1.0, -1.0
 	var opMatched rtdata.OpActivity
 	for startIdx := lo; startIdx >= lo-1; startIdx-- {
 		if startIdx >= 0 && startIdx < len(opSeq) {
@@ -80,8 +102,10 @@ func (sot SubOpTracker) LocateOpId(taskId int,
 			rightCy := math.Min(float64(endCycle), float64(thisOpAct.EndCycle()))
 			r := (rightCy - leftCy) / duration
 			if r > maxFit {
-				maxFit = r
+				maxFit, secondFit = r, maxFit
 				opMatched = thisOpAct
+			} else if r > secondFit {
+				secondFit = r
 			}
 		}
 	}
@@ -90,7 +114,9 @@ func (sot SubOpTracker) LocateOpId(taskId int,
 
 	if maxFit >= 0 {
 
-		opId = opMatched.GetOp().OpId
+		opId := opMatched.GetOp().OpId
+		rv.OpId = opId
+		rv.Confidence, rv.Reason = scoreAttribution(maxFit, secondFit)
 
 		// check sub idx
 		thisTaskId := opMatched.GetTaskID()
@@ -129,8 +155,8 @@ func (sot SubOpTracker) LocateOpId(taskId int,
 		}
 		if elSubIndex >= 0 {
 			// Update return values
-			subOpIndex = elSubIndex
-			subOpName = subName
+			rv.SubOpIndex = elSubIndex
+			rv.SubOpName = subName
 		} else {
 			sot.showDiagnosis(opMatched, possibleErr, maxFit)
 		}
@@ -0,0 +1,28 @@
+package rtinfo
+
+import (
+	"testing"
+
+	"git.enflame.cn/hai.bai/dmaster/rtinfo/rtdata"
+)
+
+func TestSubOpAttributionScore(t *testing.T) {
+	cases := []struct {
+		best, second float64
+		confidence   float64
+		reason       rtdata.AttribReason
+	}{
+		{1, -1, 1, rtdata.AttribReason_Contained},
+		{0.9, -1, 0.9, rtdata.AttribReason_Overlap},
+		{0.6, 0.4, 0.2, rtdata.AttribReason_Overlap},
+		{0, -1, 0, rtdata.AttribReason_Fallback},
+	}
+	for _, c := range cases {
+		confidence, reason := scoreAttribution(c.best, c.second)
+		if reason != c.reason || confidence < c.confidence-1e-6 ||
+			confidence > c.confidence+1e-6 {
+			t.Errorf("%v/%v: expecting %v %v, got %v %v",
+				c.best, c.second, c.confidence, c.reason, confidence, reason)
+		}
+	}
+}
@@ -18,6 +18,7 @@ const (
 
 type TimeLineManagerOpt struct {
 	EnableExtendedTimeline bool
+	MapMode                TimelineMapMode
 }
 
 type TimelineLinear struct {
@@ -34,7 +35,12 @@ type TimelineManager struct {
 	hosttp     []rtdata.HostTimeEntry
 	alignedVec []rtdata.DevCycleAligned
 	tll        TimelineLinear
+	fit        TimelineFit
+	fitValid   bool
 	opts       TimeLineManagerOpt
+
+	cleanReport    TimelineCleanReport
+	hostCorrection int64
 }
 
 func NewTimelineManager(opts TimeLineManagerOpt) *TimelineManager {
@@ -46,9 +52,29 @@ func ratioMapTo(a, b uint64, c uint64) uint64 {
 }
 
 func (tm TimelineManager) MapToHosttime(targetCycle uint64) (uint64, bool) {
+	hosttime, ok := tm.mapToHosttime(targetCycle)
+	return hosttime + uint64(tm.hostCorrection), ok
+}
+
+func (tm TimelineManager) mapToHosttime(targetCycle uint64) (uint64, bool) {
+	switch tm.opts.MapMode {
+	case TimelineMap_Piecewise:
+		if hosttime, ok := mapToHostPiecewise(tm.alignedVec, targetCycle); ok {
+			return hosttime, true
+		}
+	case TimelineMap_LinearFit:
+		if tm.fitValid {
+			return tm.fit.MapToHost(targetCycle), true
+		}
+	}
 	return tm.tll.MapToHost(targetCycle), true
 }
 
+// Shift applied to every mapped host time, ns
+func (tm *TimelineManager) SetHostCorrection(correction int64) {
+	tm.hostCorrection = correction
+}
+
 // helper for find the legal span for cycle to belong to
 func (tm *TimelineManager) MapToHosttimeV0(targetCycle uint64) (uint64, bool) {
 	alignedVec := tm.alignedVec
@@ -110,22 +136,16 @@ func (tm TimelineManager) MergeTo(lhs interface{}) bool {
 }
 
 func (tm *TimelineManager) AlignToHostTimeline() {
-	// tm.trimHostWrapped()
-	// tm.trimWrappedSyncIndex()
-	// if the host-timeline is in mono ascending
-
+	hostVec, hostStat := cleanHostTimepoints(tm.hosttp)
 	timeMap := make(map[int]rtdata.HostTimeEntry)
-	for _, v := range tm.hosttp {
-		// Skip speical dpf sync index
-		if v.DpfSyncIndex != DPFSYNC_INDEX_MONO_ONLY {
-			timeMap[v.DpfSyncIndex] = v
-		}
+	for _, v := range hostVec {
+		timeMap[v.DpfSyncIndex] = v
 	}
+	cycleVec, cycleStat := cleanDevCycles(tm.cycles, timeMap)
 
 	var alignedVec []rtdata.DevCycleAligned
 	// tm.cycles are already in the right order
-	timeInfoValid := false
-	for _, v := range tm.cycles {
+	for _, v := range cycleVec {
 		if host, ok := timeMap[v.DpfSyncIndex]; ok {
 			alignedVec = append(
 				alignedVec,
@@ -138,16 +158,31 @@ func (tm *TimelineManager) AlignToHostTimeline() {
 					Hosttime: host.Hosttime,
 				},
 			)
-			timeInfoValid = true
-			tm.tll = TimelineLinear{
-				host.Hosttime,
-				v.DevCycle,
-			}
+		}
+	}
+	alignedVec, alignedStat := cleanAlignedVec(alignedVec)
+	tm.cleanReport = TimelineCleanReport{
+		Host:    hostStat,
+		Cycle:   cycleStat,
+		Aligned: alignedStat,
+	}
+	if tm.cleanReport.AnyDropped() {
+		log.Printf("warning: inconsistent sync points are dropped\n%v",
+			tm.cleanReport.ToString())
+	}
+
+	timeInfoValid := false
+	if lz := len(alignedVec); lz > 0 {
+		timeInfoValid = true
+		tm.tll = TimelineLinear{
+			alignedVec[lz-1].Hosttime,
+			alignedVec[lz-1].DevCycle,
 		}
 	}
 
 	log.Printf("time sync %v poinst are established", len(alignedVec))
 	tm.alignedVec = alignedVec
+	tm.fit, tm.fitValid = fitTimelineLinear(alignedVec)
 	if !timeInfoValid {
 		// Error, try to dump more information
 		fmt.Println()
@@ -183,33 +218,6 @@ func (tm *TimelineManager) AlignToHostTimeline() {
 	assert.Assert(timeInfoValid, "Must be true")
 }
 
-func (tm *TimelineManager) trimHostWrapped() {
-	lz := len(tm.hosttp)
-	originalHostTpLen := lz
-	i := 0
-	for i < lz {
-		j := i
-		for j < lz-1 && tm.hosttp[j].DpfSyncIndex < tm.hosttp[j+1].DpfSyncIndex {
-			j++
-		}
-		if j+1 < lz {
-			trimmed := (j + 1) - i
-			log.Printf("warning: trimming host %v items, for sync index %v",
-				trimmed,
-				tm.hosttp[j].DpfSyncIndex,
-			)
-			tm.hosttp = tm.hosttp[j+1:]
-			lz, i = len(tm.hosttp), 0
-			continue
-		}
-		break
-	}
-	log.Printf("after trimmig, %v host timepoints remain from %v",
-		len(tm.hosttp),
-		originalHostTpLen,
-	)
-}
-
 func (tm *TimelineManager) Verify() bool {
 	lz := len(tm.alignedVec)
 	indexErrCount := 0
@@ -229,6 +237,10 @@ func (tm *TimelineManager) Verify() bool {
 	return cycleErrCount == 0 && hostErrCount == 0 && indexErrCount == 0
 }
 
+func (tm TimelineManager) GetCleanReport() TimelineCleanReport {
+	return tm.cleanReport
+}
+
 func (tm *TimelineManager) GetEngineTypeCodes() []codec.EngineTypeCode {
 	return []codec.EngineTypeCode{codec.EngCat_PCIE}
 }
@@ -243,34 +255,42 @@ func (tm *TimelineManager) DumpInfo() {
 	for _, v := range tm.alignedVec {
 		fmt.Fprintf(fout, "%v\n", v.ToString())
 	}
+
+	if tm.cleanReport.AnyDropped() {
+		fmt.Printf("# timeline sync points cleaned:\n%v\n", tm.cleanReport.ToString())
+	}
+	report := tm.GetFitReport()
+	fmt.Printf("# timeline(%v): fitted frequency %v, max drift %v ns over %v sync point(s)\n",
+		report.Mode, report.FreqString(), report.MaxDrift, len(report.Residuals))
 }
 
-// Sometimes, the real world is so crude,
-// There are duplicated DPF sync index in the same session
-// So we have to to do something
-func (tm *TimelineManager) trimWrappedSyncIndex() {
-	lz := len(tm.cycles)
-	originalLen := lz
-	i := 0
-	for i < lz {
-		j := i
-		for j < lz-1 && tm.cycles[j].DpfSyncIndex < tm.cycles[j+1].DpfSyncIndex {
-			j++
+// GetFitReport measures the selected mapping against every aligned sync point
+func (tm TimelineManager) GetFitReport() TimelineFitReport {
+	report := TimelineFitReport{
+		Mode: tm.opts.MapMode,
+	}
+	if report.Mode == "" {
+		report.Mode = TimelineMap_Offset
+	}
+	if tm.fitValid {
+		report.FreqMHz = tm.fit.FreqMHz()
+	}
+	for _, v := range tm.alignedVec {
+		mapped, _ := tm.MapToHosttime(v.DevCycle)
+		residual := int64(mapped - v.Hosttime)
+		report.Residuals = append(report.Residuals, SyncPointResidual{
+			DevCycleAligned: v,
+			Mapped:          mapped,
+			Residual:        residual,
+		})
+		if residual < 0 {
+			residual = -residual
 		}
-		if j+1 < lz {
-			trimmed := (j + 1) - i
-			log.Printf("%v dpf sync indice are trimmed", trimmed)
-			tm.cycles = tm.cycles[:j+1]
-			// reset
-			lz, i = len(tm.cycles), 0
-			continue
+		if residual > report.MaxDrift {
+			report.MaxDrift = residual
 		}
-		break
 	}
-	log.Printf("after trimming, %v dev cycles remains from %v",
-		len(tm.cycles),
-		originalLen,
-	)
+	return report
 }
 
 // LoadTimepoints for
@@ -0,0 +1,144 @@
+package rtinfo
+
+import (
+	"fmt"
+
+	"git.enflame.cn/hai.bai/dmaster/rtinfo/rtdata"
+)
+
+// Sometimes, the real world is so crude,
+// dpf sync index wraps, host time regresses, and duplicated index comes.
+// Each sequence is cut where the order breaks,
+// and only the longest consistent segment is kept for alignment.
+
+type monoSegment struct {
+	start, end int // [start, end)
+}
+
+func (seg monoSegment) Len() int {
+	return seg.end - seg.start
+}
+
+// splitMonoSegments: a new segment starts at i if inOrder(i-1, i) fails
+func splitMonoSegments(lz int, inOrder func(i, j int) bool) []monoSegment {
+	var segs []monoSegment
+	start := 0
+	for i := 1; i < lz; i++ {
+		if !inOrder(i-1, i) {
+			segs = append(segs, monoSegment{start, i})
+			start = i
+		}
+	}
+	if lz > 0 {
+		segs = append(segs, monoSegment{start, lz})
+	}
+	return segs
+}
+
+// The earlier one wins when segments are of the same length
+func longestSegment(segs []monoSegment) monoSegment {
+	var rv monoSegment
+	for _, seg := range segs {
+		if seg.Len() > rv.Len() {
+			rv = seg
+		}
+	}
+	return rv
+}
+
+type SeqCleanStat struct {
+	Total    int
+	Kept     int
+	Segments int
+}
+
+func (s SeqCleanStat) Dropped() int {
+	return s.Total - s.Kept
+}
+
+func (s SeqCleanStat) ToString() string {
+	return fmt.Sprintf("%v kept out of %v, %v dropped, in %v segment(s)",
+		s.Kept, s.Total, s.Dropped(), s.Segments)
+}
+
+type TimelineCleanReport struct {
+	Host    SeqCleanStat
+	Cycle   SeqCleanStat
+	Aligned SeqCleanStat
+}
+
+func (r TimelineCleanReport) AnyDropped() bool {
+	return r.Host.Dropped() > 0 || r.Cycle.Dropped() > 0 ||
+		r.Aligned.Dropped() > 0
+}
+
+func (r TimelineCleanReport) ToString() string {
+	return fmt.Sprintf("host sync points: %v\ndevice sync points: %v\naligned sync points: %v",
+		r.Host.ToString(), r.Cycle.ToString(), r.Aligned.ToString())
+}
+
+// Host time entries must go up in both dpf sync index and host time
+func cleanHostTimepoints(hosttp []rtdata.HostTimeEntry) (
+	[]rtdata.HostTimeEntry, SeqCleanStat) {
+	var vec []rtdata.HostTimeEntry
+	for _, v := range hosttp {
+		// Skip speical dpf sync index
+		if v.DpfSyncIndex != DPFSYNC_INDEX_MONO_ONLY {
+			vec = append(vec, v)
+		}
+	}
+	segs := splitMonoSegments(len(vec), func(i, j int) bool {
+		return vec[i].DpfSyncIndex < vec[j].DpfSyncIndex &&
+			vec[i].Hosttime < vec[j].Hosttime
+	})
+	best := longestSegment(segs)
+	return vec[best.start:best.end], SeqCleanStat{
+		Total:    len(vec),
+		Kept:     best.Len(),
+		Segments: len(segs),
+	}
+}
+
+// Device cycles are split by sync index order,
+// and the segment which matches the most host entries is kept
+func cleanDevCycles(cycles []rtdata.DevCycleTime,
+	timeMap map[int]rtdata.HostTimeEntry) ([]rtdata.DevCycleTime, SeqCleanStat) {
+	segs := splitMonoSegments(len(cycles), func(i, j int) bool {
+		return cycles[i].DpfSyncIndex < cycles[j].DpfSyncIndex &&
+			cycles[i].DevCycle < cycles[j].DevCycle
+	})
+	var best monoSegment
+	bestHit := -1
+	for _, seg := range segs {
+		hit := 0
+		for _, v := range cycles[seg.start:seg.end] {
+			if _, ok := timeMap[v.DpfSyncIndex]; ok {
+				hit++
+			}
+		}
+		if hit > bestHit {
+			best, bestHit = seg, hit
+		}
+	}
+	return cycles[best.start:best.end], SeqCleanStat{
+		Total:    len(cycles),
+		Kept:     best.Len(),
+		Segments: len(segs),
+	}
+}
+
+// Final guard, the aligned points must be strictly ascending in all
+func cleanAlignedVec(alignedVec []rtdata.DevCycleAligned) (
+	[]rtdata.DevCycleAligned, SeqCleanStat) {
+	segs := splitMonoSegments(len(alignedVec), func(i, j int) bool {
+		return alignedVec[i].DpfSyncIndex < alignedVec[j].DpfSyncIndex &&
+			alignedVec[i].Hosttime < alignedVec[j].Hosttime &&
+			alignedVec[i].DevCycle < alignedVec[j].DevCycle
+	})
+	best := longestSegment(segs)
+	return alignedVec[best.start:best.end], SeqCleanStat{
+		Total:    len(alignedVec),
+		Kept:     best.Len(),
+		Segments: len(segs),
+	}
+}
@@ -0,0 +1,38 @@
+package rtinfo
+
+import (
+	"testing"
+
+	"git.enflame.cn/hai.bai/dmaster/rtinfo/rtdata"
+)
+
+func TestTimelineCleanWrapped(t *testing.T) {
+	tm := NewTimelineManager(TimeLineManagerOpt{})
+	tm.hosttp = []rtdata.HostTimeEntry{
+		{Hosttime: 100, DpfSyncIndex: 1},
+		{Hosttime: 200, DpfSyncIndex: 2},
+		{Hosttime: 300, DpfSyncIndex: 3},
+		{Hosttime: 250, DpfSyncIndex: 4}, // host time regressed
+		{Hosttime: 400, DpfSyncIndex: 5},
+	}
+	tm.cycles = []rtdata.DevCycleTime{
+		{DpfSyncIndex: 1, DevCycle: 10},
+		{DpfSyncIndex: 2, DevCycle: 20},
+		{DpfSyncIndex: 2, DevCycle: 25}, // duplicated
+		{DpfSyncIndex: 3, DevCycle: 30},
+	}
+	tm.AlignToHostTimeline()
+	if !tm.Verify() {
+		t.Fatalf("must be consistent after cleaning")
+	}
+	report := tm.GetCleanReport()
+	if report.Host.Kept != 3 || report.Host.Segments != 2 {
+		t.Errorf("unexpected host clean: %v", report.Host.ToString())
+	}
+	if report.Cycle.Kept != 2 || report.Cycle.Dropped() != 2 {
+		t.Errorf("unexpected cycle clean: %v", report.Cycle.ToString())
+	}
+	if len(tm.alignedVec) != 2 {
+		t.Errorf("expecting 2 aligned, got %v", len(tm.alignedVec))
+	}
+}
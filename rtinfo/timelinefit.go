@@ -0,0 +1,144 @@
+package rtinfo
+
+import (
+	"fmt"
+	"io"
+	"math"
+
+	"git.enflame.cn/hai.bai/dmaster/rtinfo/rtdata"
+)
+
+type TimelineMapMode string
+
+const (
+	TimelineMap_Offset    TimelineMapMode = "offset"
+	TimelineMap_Piecewise TimelineMapMode = "piecewise"
+	TimelineMap_LinearFit TimelineMapMode = "linfit"
+)
+
+func ParseTimelineMapMode(s string) (TimelineMapMode, error) {
+	switch mode := TimelineMapMode(s); mode {
+	case TimelineMap_Offset, TimelineMap_Piecewise, TimelineMap_LinearFit:
+		return mode, nil
+	case "":
+		return TimelineMap_Offset, nil
+	}
+	return "", fmt.Errorf("unknown timeline map mode: %v", s)
+}
+
+// TimelineFit keeps host = hostBase + slope*(cycle-cycleBase) + intercept
+// Deltas are taken against the base point so float64 keeps enough precision
+type TimelineFit struct {
+	cycleBase uint64
+	hostBase  uint64
+	slope     float64 // host ns per device cycle
+	intercept float64
+}
+
+func (f TimelineFit) MapToHost(devCy uint64) uint64 {
+	dx := float64(int64(devCy - f.cycleBase))
+	return f.hostBase + uint64(int64(math.Round(f.slope*dx+f.intercept)))
+}
+
+// Device frequency in MHz, derived from the slope
+func (f TimelineFit) FreqMHz() float64 {
+	if f.slope <= 0 {
+		return 0
+	}
+	return 1000 / f.slope
+}
+
+// Least-squares fit over the aligned sync points, a slope takes two
+func fitTimelineLinear(alignedVec []rtdata.DevCycleAligned) (TimelineFit, bool) {
+	lz := len(alignedVec)
+	if lz < 2 {
+		return TimelineFit{}, false
+	}
+	fit := TimelineFit{
+		cycleBase: alignedVec[0].DevCycle,
+		hostBase:  alignedVec[0].Hosttime,
+		slope:     1,
+	}
+
+	var sumX, sumY, sumXX, sumXY float64
+	for _, v := range alignedVec {
+		x := float64(int64(v.DevCycle - fit.cycleBase))
+		y := float64(int64(v.Hosttime - fit.hostBase))
+		sumX += x
+		sumY += y
+		sumXX += x * x
+		sumXY += x * y
+	}
+	n := float64(lz)
+	denom := n*sumXX - sumX*sumX
+	if denom == 0 {
+		return fit, false
+	}
+	fit.slope = (n*sumXY - sumX*sumY) / denom
+	fit.intercept = (sumY - fit.slope*sumX) / n
+	return fit, true
+}
+
+// Interpolate between the neighbouring sync points,
+// and extrapolate with the rate of the edge span out of range
+func mapToHostPiecewise(alignedVec []rtdata.DevCycleAligned,
+	targetCycle uint64) (uint64, bool) {
+	lz := len(alignedVec)
+	if lz < 2 {
+		return 0, false
+	}
+	lo, hi := 0, lz
+	for lo < hi {
+		md := (lo + hi) >> 1
+		if alignedVec[md].DevCycle > targetCycle {
+			hi = md
+		} else {
+			lo = 1 + md
+		}
+	}
+	bound := lo - 1
+	if bound < 0 {
+		bound = 0
+	} else if bound > lz-2 {
+		bound = lz - 2
+	}
+	start, close := alignedVec[bound], alignedVec[bound+1]
+	if start.DevCycle >= close.DevCycle || start.Hosttime >= close.Hosttime {
+		return 0, false
+	}
+	ratio := float64(close.Hosttime-start.Hosttime) /
+		float64(close.DevCycle-start.DevCycle)
+	dx := float64(int64(targetCycle - start.DevCycle))
+	return start.Hosttime + uint64(int64(math.Round(ratio*dx))), true
+}
+
+type SyncPointResidual struct {
+	rtdata.DevCycleAligned
+	Mapped   uint64
+	Residual int64 // mapped minus recorded host time, in ns
+}
+
+type TimelineFitReport struct {
+	Mode      TimelineMapMode
+	FreqMHz   float64
+	Residuals []SyncPointResidual
+	MaxDrift  int64
+}
+
+// "none" without a fit, such as of a single sync point
+func (r TimelineFitReport) FreqString() string {
+	if r.FreqMHz <= 0 {
+		return "none"
+	}
+	return fmt.Sprintf("%.6f MHz", r.FreqMHz)
+}
+
+func (r TimelineFitReport) Dump(fout io.Writer) {
+	fmt.Fprintf(fout, "# timeline map mode: %v\n", r.Mode)
+	fmt.Fprintf(fout, "# fitted frequency: %v\n", r.FreqString())
+	fmt.Fprintf(fout, "# max drift: %v ns over %v sync point(s)\n",
+		r.MaxDrift, len(r.Residuals))
+	for _, v := range r.Residuals {
+		fmt.Fprintf(fout, "%v %v %v\n", v.ToString(), v.Mapped, v.Residual)
+	}
+}
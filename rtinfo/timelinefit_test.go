@@ -0,0 +1,79 @@
+package rtinfo
+
+import (
+	"testing"
+
+	"git.enflame.cn/hai.bai/dmaster/rtinfo/rtdata"
+)
+
+func makeAligned(points [][2]uint64) []rtdata.DevCycleAligned {
+	var rv []rtdata.DevCycleAligned
+	for i, p := range points {
+		rv = append(rv, rtdata.DevCycleAligned{
+			DevCycleTime: rtdata.DevCycleTime{
+				DpfSyncIndex: i,
+				DevCycle:     p[0],
+			},
+			Hosttime: p[1],
+		})
+	}
+	return rv
+}
+
+func TestTimelineLinearFit(t *testing.T) {
+	// 1.5GHz device against a host clock far away from zero
+	const hostStart = 1650000000000000000
+	aligned := makeAligned([][2]uint64{
+		{3000, hostStart + 2000},
+		{1503000, hostStart + 1002000},
+		{3003000, hostStart + 2002000},
+	})
+	fit, ok := fitTimelineLinear(aligned)
+	if !ok {
+		t.Fatalf("fit must be valid")
+	}
+	// No frequency out of a single sync point
+	if _, ok := fitTimelineLinear(aligned[:1]); ok {
+		t.Errorf("expecting no fit of one sync point")
+	}
+	if freq := fit.FreqMHz(); freq < 1499.999 || freq > 1500.001 {
+		t.Errorf("expecting 1500MHz, got %v", freq)
+	}
+	if host := fit.MapToHost(4503000); host != hostStart+3002000 {
+		t.Errorf("unexpected extrapolation: %v", host-hostStart)
+	}
+	if host := fit.MapToHost(0); host != hostStart {
+		t.Errorf("unexpected extrapolation before start: %v", int64(host-hostStart))
+	}
+}
+
+func TestTimelinePiecewise(t *testing.T) {
+	aligned := makeAligned([][2]uint64{
+		{1000, 10000},
+		{2000, 11000},
+		{3000, 13000},
+	})
+	for _, c := range []struct {
+		cycle, host uint64
+	}{
+		{1500, 10500},
+		{2500, 12000},
+		{3000, 13000},
+		{4000, 15000},
+		{500, 9500},
+	} {
+		host, ok := mapToHostPiecewise(aligned, c.cycle)
+		if !ok || host != c.host {
+			t.Errorf("cycle %v: expecting %v, got %v(%v)", c.cycle, c.host, host, ok)
+		}
+	}
+
+	tm := TimelineManager{
+		alignedVec: aligned,
+		opts:       TimeLineManagerOpt{MapMode: TimelineMap_Piecewise},
+	}
+	tm.fit, tm.fitValid = fitTimelineLinear(aligned)
+	if report := tm.GetFitReport(); report.MaxDrift != 0 {
+		t.Errorf("piecewise shall hit every sync point, drift %v", report.MaxDrift)
+	}
+}
@@ -0,0 +1,336 @@
+package rtinfo
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strings"
+
+	"git.enflame.cn/hai.bai/dmaster/meta/metadata"
+	"git.enflame.cn/hai.bai/dmaster/rtinfo/rtdata"
+)
+
+// Wild ops are the CQM ops left over by CookCqmEverSince,
+// they are matched against all the loaded exec scopes instead of
+// the task in front of them.
+type WildAmbiguity int
+
+const (
+	WildAmbiguity_NoCandidate WildAmbiguity = iota
+	WildAmbiguity_Unique                    // only one exec knows the packet
+	WildAmbiguity_Resolved                  // several, the best one wins by evidence
+	WildAmbiguity_Ambiguous                 // several, no way to tell
+)
+
+func (a WildAmbiguity) String() string {
+	switch a {
+	case WildAmbiguity_NoCandidate:
+		return "no_candidate"
+	case WildAmbiguity_Unique:
+		return "unique"
+	case WildAmbiguity_Resolved:
+		return "resolved"
+	case WildAmbiguity_Ambiguous:
+		return "ambiguous"
+	}
+	return "unknown"
+}
+
+const (
+	wildFingerprintStart = 1 // start packet id maps to an op
+	wildFingerprintBoth  = 2 // start and end packet ids map to the same op
+)
+
+type WildCandidate struct {
+	ExecUuid    uint64
+	OpId        int
+	OpName      string // empty if the packet is known but the op is not
+	Fingerprint int
+	// Cycles to the nearest task window of the exec, zero if within,
+	// math.MaxUint64 if there is no task of the exec with cycles
+	TaskDistance uint64
+	Task         *rtdata.RuntimeTask // the nearest task, nil if none
+	NeighborVote int                 // attributed ops next to it on the same CQM
+	op           *metadata.DtuOp
+}
+
+func (c WildCandidate) String() string {
+	name := c.OpName
+	if name == "" {
+		name = "?"
+	}
+	return fmt.Sprintf("%v.%v@0x%016x", name, c.OpId, c.ExecUuid)
+}
+
+// The order of evidence: fingerprint, neighbors, then distance in time
+func (c WildCandidate) betterThan(rhs WildCandidate) bool {
+	if c.Fingerprint != rhs.Fingerprint {
+		return c.Fingerprint > rhs.Fingerprint
+	}
+	if c.NeighborVote != rhs.NeighborVote {
+		return c.NeighborVote > rhs.NeighborVote
+	}
+	return c.TaskDistance < rhs.TaskDistance
+}
+
+func (c WildCandidate) sameEvidence(rhs WildCandidate) bool {
+	return !c.betterThan(rhs) && !rhs.betterThan(c)
+}
+
+type WildAttribution struct {
+	Act        rtdata.OpActivity
+	Candidates []WildCandidate // the best first
+	Ambiguity  WildAmbiguity
+}
+
+func (w WildAttribution) Best() (WildCandidate, bool) {
+	if w.Ambiguity == WildAmbiguity_Unique ||
+		w.Ambiguity == WildAmbiguity_Resolved {
+		return w.Candidates[0], true
+	}
+	return WildCandidate{}, false
+}
+
+// Label is used as the event name in trace
+func (w WildAttribution) Label() string {
+	switch w.Ambiguity {
+	case WildAmbiguity_NoCandidate:
+		return fmt.Sprintf("unknown pkt(%v)", w.Act.Start.PacketID)
+	case WildAmbiguity_Ambiguous:
+		var names []string
+		for _, c := range w.Candidates {
+			if !c.sameEvidence(w.Candidates[0]) {
+				break
+			}
+			names = append(names, c.String())
+		}
+		return fmt.Sprintf("ambiguous(%v): %v",
+			len(names), strings.Join(names, " | "))
+	}
+	return w.Candidates[0].String()
+}
+
+type WildAttribReport struct {
+	Attribs     []WildAttribution
+	ByAmbiguity map[WildAmbiguity]int
+}
+
+// The acts with op ref set for the unique and resolved ones
+func (r WildAttribReport) OpActivity() []rtdata.OpActivity {
+	rv := make([]rtdata.OpActivity, len(r.Attribs))
+	for i, attrib := range r.Attribs {
+		rv[i] = attrib.Act
+	}
+	return rv
+}
+
+func (r WildAttribReport) DumpInfo() {
+	fmt.Printf("# wild cqm ops: %v, unique %v, resolved %v, ambiguous %v, no candidate %v\n",
+		len(r.Attribs),
+		r.ByAmbiguity[WildAmbiguity_Unique],
+		r.ByAmbiguity[WildAmbiguity_Resolved],
+		r.ByAmbiguity[WildAmbiguity_Ambiguous],
+		r.ByAmbiguity[WildAmbiguity_NoCandidate],
+	)
+}
+
+func (r WildAttribReport) Dump(out io.Writer) {
+	fmt.Fprintf(out, "# %v wild cqm op(s)\n", len(r.Attribs))
+	for _, ambiguity := range []WildAmbiguity{
+		WildAmbiguity_Unique,
+		WildAmbiguity_Resolved,
+		WildAmbiguity_Ambiguous,
+		WildAmbiguity_NoCandidate,
+	} {
+		fmt.Fprintf(out, "#   %v: %v\n", ambiguity, r.ByAmbiguity[ambiguity])
+	}
+	for _, attrib := range r.Attribs {
+		act := attrib.Act
+		fmt.Fprintf(out, "cqm.%v.%v pkt(%v,%v) [%v,%v] %v: %v\n",
+			act.Start.ClusterID,
+			act.Start.EngineIndex,
+			act.Start.PacketID,
+			act.End.PacketID,
+			act.StartCycle(),
+			act.EndCycle(),
+			attrib.Ambiguity,
+			attrib.Label(),
+		)
+		for _, c := range attrib.Candidates {
+			distance := "-"
+			if c.Task != nil {
+				distance = fmt.Sprintf("%v (task %v)", c.TaskDistance, c.Task.TaskID)
+			}
+			fmt.Fprintf(out, "    %v fingerprint=%v neighbors=%v distance=%v\n",
+				c, c.Fingerprint, c.NeighborVote, distance)
+		}
+	}
+}
+
+type wildNeighbor struct {
+	cycle    uint64
+	execUuid uint64
+}
+
+type cqmEngineKey struct {
+	clusterID   int
+	engineIndex int
+}
+
+// Attributed ops per CQM engine, in order of start cycle
+func collectWildNeighbors(dtuOps []rtdata.OpActivity) map[cqmEngineKey][]wildNeighbor {
+	rv := make(map[cqmEngineKey][]wildNeighbor)
+	for _, op := range dtuOps {
+		if !op.IsOpRefValid() {
+			continue
+		}
+		key := cqmEngineKey{op.Start.ClusterID, op.Start.EngineIndex}
+		rv[key] = append(rv[key], wildNeighbor{
+			op.StartCycle(),
+			op.GetTask().ExecutableUUID,
+		})
+	}
+	for _, vec := range rv {
+		sort.SliceStable(vec, func(i, j int) bool {
+			return vec[i].cycle < vec[j].cycle
+		})
+	}
+	return rv
+}
+
+// The closest attributed op before and after on the same engine
+func neighborExecs(vec []wildNeighbor, cycle uint64) []uint64 {
+	idx := sort.Search(len(vec), func(i int) bool {
+		return vec[i].cycle >= cycle
+	})
+	var rv []uint64
+	if idx > 0 {
+		rv = append(rv, vec[idx-1].execUuid)
+	}
+	if idx < len(vec) {
+		rv = append(rv, vec[idx].execUuid)
+	}
+	return rv
+}
+
+func cycleDistance(task *rtdata.RuntimeTask, startCy, endCy uint64) uint64 {
+	switch {
+	case endCy < task.StartCycle:
+		return task.StartCycle - endCy
+	case startCy > task.EndCycle:
+		return startCy - task.EndCycle
+	}
+	return 0
+}
+
+// AttributeWildOps matches each op against every exec scope by the
+// fingerprint of its packet ids, the exec of the attributed ops next to
+// it, and the distance to the tasks running the exec.
+// Acts that get a unique or resolved candidate have their op ref set.
+func AttributeWildOps(
+	wildActs []rtdata.OpActivity,
+	scopes []*metadata.ExecScope,
+	tasks []rtdata.OrderTask,
+	dtuOps []rtdata.OpActivity,
+) WildAttribReport {
+	// Duplicated scopes(wildcard and bundle) are searched once
+	sort.SliceStable(scopes, func(i, j int) bool {
+		return scopes[i].GetExecUuid() < scopes[j].GetExecUuid()
+	})
+	var uniqScopes []*metadata.ExecScope
+	for i, es := range scopes {
+		if i == 0 || es.GetExecUuid() != scopes[i-1].GetExecUuid() {
+			uniqScopes = append(uniqScopes, es)
+		}
+	}
+
+	execTasks := make(map[uint64][]*rtdata.RuntimeTask)
+	for _, task := range tasks {
+		ref := task.GetRefToTask()
+		if ref == nil || !ref.CycleValid {
+			continue
+		}
+		execTasks[ref.ExecutableUUID] = append(execTasks[ref.ExecutableUUID], ref)
+	}
+	neighbors := collectWildNeighbors(dtuOps)
+
+	rv := WildAttribReport{
+		ByAmbiguity: make(map[WildAmbiguity]int),
+	}
+	for _, wildAct := range wildActs {
+		act := rtdata.OpActivity{DpfAct: wildAct.DpfAct}
+		attrib := WildAttribution{Act: act}
+		var votes []uint64
+		if vec, ok := neighbors[cqmEngineKey{
+			act.Start.ClusterID, act.Start.EngineIndex}]; ok {
+			votes = neighborExecs(vec, act.StartCycle())
+		}
+		for _, es := range uniqScopes {
+			opId, ok := es.MapPacketIdToOpId(act.Start.PacketID)
+			if !ok {
+				continue
+			}
+			c := WildCandidate{
+				ExecUuid:     es.GetExecUuid(),
+				OpId:         opId,
+				Fingerprint:  wildFingerprintStart,
+				TaskDistance: math.MaxUint64,
+			}
+			if endOpId, ok := es.MapPacketIdToOpId(act.End.PacketID); ok &&
+				endOpId == opId {
+				c.Fingerprint = wildFingerprintBoth
+			}
+			if op, err := es.FindOp(act.Start.PacketID); err == nil {
+				c.OpName, c.op = op.OpName, &op
+			}
+			for _, task := range execTasks[c.ExecUuid] {
+				if d := cycleDistance(task, act.StartCycle(),
+					act.EndCycle()); d < c.TaskDistance {
+					c.TaskDistance, c.Task = d, task
+				}
+			}
+			for _, execUuid := range votes {
+				if execUuid == c.ExecUuid {
+					c.NeighborVote++
+				}
+			}
+			attrib.Candidates = append(attrib.Candidates, c)
+		}
+		sort.SliceStable(attrib.Candidates, func(i, j int) bool {
+			return attrib.Candidates[i].betterThan(attrib.Candidates[j])
+		})
+
+		switch {
+		case len(attrib.Candidates) == 0:
+			attrib.Ambiguity = WildAmbiguity_NoCandidate
+		case len(attrib.Candidates) == 1:
+			attrib.Ambiguity = WildAmbiguity_Unique
+		case attrib.Candidates[0].sameEvidence(attrib.Candidates[1]):
+			attrib.Ambiguity = WildAmbiguity_Ambiguous
+		default:
+			attrib.Ambiguity = WildAmbiguity_Resolved
+		}
+		if best, ok := attrib.Best(); ok && best.Task != nil && best.op != nil {
+			attrib.Act.SetOpRef(rtdata.NewOpRef(best.op, best.Task))
+		}
+		rv.ByAmbiguity[attrib.Ambiguity]++
+		rv.Attribs = append(rv.Attribs, attrib)
+	}
+	return rv
+}
+
+// AttributeWildCqm is the fallback for the ops CookCqmEverSince gives up
+func (r *RuntimeTaskManager) AttributeWildCqm(
+	wildActs []rtdata.OpActivity,
+	dtuOps []rtdata.OpActivity,
+) WildAttribReport {
+	var scopes []*metadata.ExecScope
+	if r.execKnowledge != nil {
+		r.execKnowledge.WalkExecScopes(func(es *metadata.ExecScope) bool {
+			scopes = append(scopes, es)
+			return true
+		})
+	}
+	return AttributeWildOps(wildActs, scopes, r.fullTaskVector, dtuOps)
+}
@@ -0,0 +1,79 @@
+package rtinfo
+
+import (
+	"testing"
+
+	"git.enflame.cn/hai.bai/dmaster/codec"
+	"git.enflame.cn/hai.bai/dmaster/meta/metadata"
+	"git.enflame.cn/hai.bai/dmaster/rtinfo/rtdata"
+)
+
+func newWildScope(execUuid uint64, pktIdToOp map[int]int) *metadata.ExecScope {
+	opMap := make(map[int]metadata.DtuOp)
+	for _, opId := range pktIdToOp {
+		opMap[opId] = metadata.DtuOp{OpName: "op", OpId: opId}
+	}
+	return metadata.NewExecScope(execUuid, pktIdToOp, opMap,
+		metadata.DmaInfoMap{}, nil, nil)
+}
+
+func newWildAct(startPkt, endPkt int, startCy, endCy uint64) rtdata.OpActivity {
+	return rtdata.OpActivity{DpfAct: rtdata.DpfAct{
+		Start: codec.DpfEvent{PacketID: startPkt, Cycle: startCy},
+		End:   codec.DpfEvent{PacketID: endPkt, Cycle: endCy},
+	}}
+}
+
+func TestWildAttribution(t *testing.T) {
+	scopes := []*metadata.ExecScope{
+		newWildScope(0xa, map[int]int{10: 1, 11: 1, 20: 2}),
+		newWildScope(0xb, map[int]int{10: 5, 20: 6}),
+		newWildScope(0xc, map[int]int{20: 7, 30: 8}),
+	}
+	taskA := &rtdata.RuntimeTask{StartCycle: 0, EndCycle: 100, CycleValid: true}
+	taskA.TaskID, taskA.ExecutableUUID = 1, 0xa
+	taskB := &rtdata.RuntimeTask{StartCycle: 1000, EndCycle: 1100, CycleValid: true}
+	taskB.TaskID, taskB.ExecutableUUID = 2, 0xb
+	tasks := []rtdata.OrderTask{
+		rtdata.NewOrderTask(0, taskA),
+		rtdata.NewOrderTask(1000, taskB),
+	}
+	report := AttributeWildOps([]rtdata.OpActivity{
+		newWildAct(10, 11, 50, 60),   // both packets in 0xa
+		newWildAct(20, 20, 200, 210), // 0xa is closer in time than 0xb
+		newWildAct(30, 31, 50, 60),   // only 0xc knows it
+		newWildAct(40, 40, 50, 60),   // nobody
+	}, scopes, tasks, nil)
+
+	expected := []struct {
+		ambiguity WildAmbiguity
+		execUuid  uint64
+	}{
+		{WildAmbiguity_Resolved, 0xa},
+		{WildAmbiguity_Resolved, 0xa},
+		{WildAmbiguity_Unique, 0xc},
+		{WildAmbiguity_NoCandidate, 0},
+	}
+	for i, attrib := range report.Attribs {
+		if attrib.Ambiguity != expected[i].ambiguity {
+			t.Errorf("%v: expecting %v, got %v", i,
+				expected[i].ambiguity, attrib.Ambiguity)
+			continue
+		}
+		if best, ok := attrib.Best(); ok && best.ExecUuid != expected[i].execUuid {
+			t.Errorf("%v: expecting exec %x, got %v", i,
+				expected[i].execUuid, best)
+		}
+	}
+	if !report.Attribs[0].Act.IsOpRefValid() || report.Attribs[2].Act.IsOpRefValid() {
+		t.Errorf("op ref must be set only with a task nearby")
+	}
+
+	// Same fingerprint, no task, no neighbor
+	report = AttributeWildOps([]rtdata.OpActivity{
+		newWildAct(20, 20, 50, 60),
+	}, scopes[1:], nil, nil)
+	if report.Attribs[0].Ambiguity != WildAmbiguity_Ambiguous {
+		t.Errorf("must be ambiguous, got %v", report.Attribs[0].Label())
+	}
+}
@@ -34,8 +34,20 @@ type SessionOpt struct {
 }
 
 type Session struct {
-	items   []codec.DpfEvent
-	sessOpt SessionOpt
+	items      []codec.DpfEvent
+	sessOpt    SessionOpt
+	decodeStat DecodeStat
+}
+
+// DecodeStat counts the items of the ring buffer by how they decode
+type DecodeStat struct {
+	Ok      int
+	Errors  int
+	Ignored int
+}
+
+func (sess Session) GetDecodeStat() DecodeStat {
+	return sess.decodeStat
 }
 
 type DpfEventArray struct {
@@ -211,6 +223,11 @@ func (sess *Session) DecodeFromTextStream(
 		sort.Sort(codec.DpfItems(sess.items))
 	}
 	eventArr.errWatcher.SumUp()
+	sess.decodeStat = DecodeStat{
+		Ok:      eventArr.errWatcher.okCount,
+		Errors:  eventArr.errWatcher.errCount,
+		Ignored: eventArr.errWatcher.ignoreCount,
+	}
 }
 
 func (sess *Session) DecodeChunk(
@@ -286,6 +303,11 @@ func (sess *Session) DecodeChunk(
 		ignoreInAll += result.errWatcher.ignoreCount
 		okInAll += result.errWatcher.okCount
 	}
+	sess.decodeStat = DecodeStat{
+		Ok:      okInAll,
+		Errors:  errCountInAll,
+		Ignored: ignoreInAll,
+	}
 	log.Printf("error in all: %v", errCountInAll)
 	log.Printf("ignore in all: %v", ignoreInAll)
 	log.Printf("success in all: %v", okInAll)
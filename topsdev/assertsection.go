@@ -15,19 +15,17 @@ import (
 	"io"
 	"log"
 	"os"
+	"path/filepath"
 	"reflect"
 	"unsafe"
+
+	"git.enflame.cn/hai.bai/dmaster/meta/metadata"
 )
 
-type AssertInfo struct {
-	CauseId int
-	SrcFile string
-	LineNo  int
-	UserMsg string
-}
+type AssertInfo = metadata.KernelAssertInfo
 
 type AssertRtDict struct {
-	Info     map[int][]AssertInfo
+	Info     metadata.KernelAssertDict
 	ExecUuid uint64
 }
 
@@ -68,7 +66,7 @@ func NewAssertRtDict(rawData ExecRawData) AssertRtDict {
 		return rv
 	}
 
-	dc := make(map[int][]AssertInfo)
+	dc := make(metadata.KernelAssertDict)
 	clauseCnt := decodeUint32()
 	for i := 0; i < clauseCnt; i++ {
 		causeId := decodeUint32()
@@ -92,18 +90,20 @@ func NewAssertRtDict(rawData ExecRawData) AssertRtDict {
 	}
 }
 
-func (ard AssertRtDict) DumpAssertInfo() {
-	outFile := fmt.Sprintf("0x%016x_assert.pbdumptxt", ard.ExecUuid)
+// DumpAssertInfo writes into the meta startup folder,
+// where the file loader looks for it
+func (ard AssertRtDict) DumpAssertInfo(startupPath string) {
+	outFile := filepath.Join(startupPath,
+		metadata.KernelAssertFileName(ard.ExecUuid))
 
 	out, err := os.Create(outFile)
 	if err != nil {
 		log.Fatal(err)
 	}
 	defer out.Close()
-	for causeId, itemv := range ard.Info {
+	for _, itemv := range ard.Info {
 		for _, item := range itemv {
-			fmt.Fprintf(out, "%v \"%v,%v,%v\"\n", causeId,
-				item.UserMsg, item.SrcFile, item.LineNo)
+			fmt.Fprintf(out, "%v\n", metadata.FormatKernelAssertLine(item))
 		}
 	}
 }
@@ -62,3 +62,16 @@ func (e execFileLoader) LoadWildcards(
 func (e execFileLoader) ExtractHostInfo() *mimicdefs.HostInfo {
 	return nil
 }
+
+func (e execFileLoader) LoadKernelAsserts(execUuid uint64) (
+	metadata.KernelAssertDict, bool) {
+	for _, file := range e.files {
+		for _, execRaw := range LoadSectionsFromExec(file) {
+			if execRaw.DataType == SHT_KERN_ASSERT_INFO &&
+				execRaw.ExecUuid == execUuid {
+				return NewAssertRtDict(execRaw).Info, true
+			}
+		}
+	}
+	return nil, false
+}
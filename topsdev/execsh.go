@@ -144,7 +144,10 @@ func LoadSectionsFromExec(filename string) []ExecRawData {
 	return rawVec
 }
 
-func DumpSectionsFromExecutable(filename string, checkFormatOnly bool) {
+// DumpSectionsFromExecutable writes the kernel asserts into the startup
+// path, the other meta into the current folder
+func DumpSectionsFromExecutable(filename string, startupPath string,
+	checkFormatOnly bool) {
 	chunkVec := LoadSectionsFromExec(filename)
 	for _, execRaw := range chunkVec {
 		switch execRaw.DataType {
@@ -167,7 +170,7 @@ func DumpSectionsFromExecutable(filename string, checkFormatOnly bool) {
 			execScope.DumpDmaToFile()
 			execScope.DumpPktOpMapToFile()
 		case SHT_KERN_ASSERT_INFO:
-			NewAssertRtDict(execRaw).DumpAssertInfo()
+			NewAssertRtDict(execRaw).DumpAssertInfo(startupPath)
 		}
 	}
 }
@@ -0,0 +1,98 @@
+package vpdquery
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"text/tabwriter"
+)
+
+const (
+	Format_Table = "table"
+	Format_Csv   = "csv"
+	Format_Json  = "json"
+)
+
+// NULL is empty in table and CSV, null in JSON
+func cellString(v interface{}) string {
+	if v == nil {
+		return ""
+	}
+	if f, ok := v.(float64); ok {
+		return fmt.Sprintf("%.6g", f)
+	}
+	return fmt.Sprint(v)
+}
+
+func (r Result) writeTable(out io.Writer) error {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	writeLine := func(cells []string) {
+		for i, cell := range cells {
+			if i > 0 {
+				fmt.Fprint(w, "\t")
+			}
+			fmt.Fprint(w, cell)
+		}
+		fmt.Fprintln(w)
+	}
+	writeLine(r.Columns)
+	for _, row := range r.Rows {
+		cells := make([]string, len(row))
+		for i, v := range row {
+			cells[i] = cellString(v)
+		}
+		writeLine(cells)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(out, "(%v row(s))\n", len(r.Rows))
+	return err
+}
+
+func (r Result) writeCsv(out io.Writer) error {
+	w := csv.NewWriter(out)
+	if err := w.Write(r.Columns); err != nil {
+		return err
+	}
+	for _, row := range r.Rows {
+		cells := make([]string, len(row))
+		for i, v := range row {
+			cells[i] = cellString(v)
+		}
+		if err := w.Write(cells); err != nil {
+			return err
+		}
+	}
+	w.Flush()
+	return w.Error()
+}
+
+// An array of objects by column name, in the order of the rows
+func (r Result) writeJson(out io.Writer) error {
+	objs := make([]map[string]interface{}, 0, len(r.Rows))
+	for _, row := range r.Rows {
+		obj := make(map[string]interface{}, len(row))
+		for i, v := range row {
+			obj[r.Columns[i]] = v
+		}
+		objs = append(objs, obj)
+	}
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(objs)
+}
+
+func (r Result) Write(out io.Writer, format string) error {
+	switch format {
+	case Format_Table:
+		return r.writeTable(out)
+	case Format_Csv:
+		return r.writeCsv(out)
+	case Format_Json:
+		return r.writeJson(out)
+	}
+	return fmt.Errorf("unknown format %q, expecting %v, %v or %v",
+		format, Format_Table, Format_Csv, Format_Json)
+}
@@ -0,0 +1,215 @@
+// Package vpdquery runs named reports and raw SQL on a vpd, with the
+// values bound as parameters, and writes the result as a table, CSV or JSON.
+package vpdquery
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"git.enflame.cn/hai.bai/dmaster/dbexport"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// Param is bound by name, an empty value is bound as NULL which turns
+// the filter of the param off
+type Param struct {
+	Name    string
+	Default string
+	Help    string
+}
+
+type Report struct {
+	Name   string
+	Help   string
+	Params []Param
+	SQL    string
+}
+
+// Filters shared by the reports
+var (
+	paramLimit   = Param{"limit", "10", "rows at most, -1 for all"}
+	paramDevice  = Param{"device", "", "device id, all if empty"}
+	paramCapture = Param{"capture", "", "capture id, all if empty"}
+)
+
+const filterDeviceCapture = `
+	AND (:device IS NULL OR device_id = :device)
+	AND (:capture IS NULL OR capture_id = :capture)`
+
+var reports = []Report{
+	{
+		Name:   "top_ops",
+		Help:   "DTU ops by total time over all their runs",
+		Params: []Param{paramLimit, paramDevice, paramCapture},
+		SQL: `SELECT op_name, COUNT(*) AS count,
+			SUM(duration_timestamp) AS total_ns,
+			CAST(AVG(duration_timestamp) AS INT) AS mean_ns,
+			MIN(duration_timestamp) AS min_ns,
+			MAX(duration_timestamp) AS max_ns
+		FROM dtu_op
+		WHERE row_name = '` + dbexport.DtuOpRowName + `'` + filterDeviceCapture + `
+		GROUP BY op_name
+		ORDER BY total_ns DESC, op_name
+		LIMIT :limit`,
+	},
+	{
+		Name: "engine_busy",
+		Help: "busy of the engines over their span, the busiest first",
+		Params: []Param{paramLimit, paramDevice, paramCapture,
+			{"engine_type", "", "engine type, all if empty"}},
+		SQL: `SELECT device_id, engine_type, cluster_id, engine_index, vc_id,
+			act_count, busy_cycle, span_cycle,
+			ROUND(utilization * 100, 2) AS busy_pct
+		FROM engine_utilization
+		WHERE (:engine_type IS NULL OR engine_type = :engine_type)` +
+			filterDeviceCapture + `
+		ORDER BY utilization DESC, device_id, engine_type,
+			cluster_id, engine_index, vc_id
+		LIMIT :limit`,
+	},
+	{
+		Name: "dma_tiling",
+		Help: "DMAs per engine type and tiling mode",
+		Params: []Param{paramLimit, paramDevice, paramCapture,
+			{"name", "", "LIKE pattern of the DMA name, e.g. 'DMA VC%', all if empty"}},
+		SQL: `SELECT engine_type,
+			IFNULL(NULLIF(TRIM(tiling_mode), ''), '(none)') AS tiling_mode,
+			COUNT(*) AS count,
+			SUM(duration_timestamp) AS total_ns,
+			SUM(IFNULL(src_size, 0)) AS src_bytes,
+			COUNT(DISTINCT packet_id) AS packets
+		FROM memcpy
+		WHERE (:name IS NULL OR name LIKE :name)` + filterDeviceCapture + `
+		GROUP BY 1, 2
+		ORDER BY count DESC, 1, 2
+		LIMIT :limit`,
+	},
+	{
+		Name: "task_ops",
+		Help: "DTU ops per task in time order",
+		Params: []Param{{"limit", "-1", "rows at most, -1 for all"},
+			paramDevice, paramCapture,
+			{"task", "", "task id, all if empty"}},
+		SQL: `SELECT device_id, task_id, exec_uuid,
+			COUNT(*) AS op_count,
+			SUM(duration_timestamp) AS op_ns,
+			MIN(start_timestamp) AS start_ns,
+			MAX(end_timestamp) - MIN(start_timestamp) AS span_ns
+		FROM dtu_op
+		WHERE row_name = '` + dbexport.DtuOpRowName + `'
+			AND (:task IS NULL OR task_id = :task)` + filterDeviceCapture + `
+		GROUP BY device_id, task_id, exec_uuid
+		ORDER BY device_id, start_ns
+		LIMIT :limit`,
+	},
+}
+
+func Reports() []Report {
+	rv := append([]Report(nil), reports...)
+	sort.Slice(rv, func(i, j int) bool {
+		return rv[i].Name < rv[j].Name
+	})
+	return rv
+}
+
+func FindReport(name string) (Report, bool) {
+	for _, r := range reports {
+		if r.Name == name {
+			return r, true
+		}
+	}
+	return Report{}, false
+}
+
+// Integers are bound as such, LIMIT takes nothing else
+func bindValue(value string) interface{} {
+	if value == "" {
+		return nil
+	}
+	if i, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return i
+	}
+	return value
+}
+
+// Open opens the vpd read only, raw SQL does not change it. One of an
+// older schema is read through an upgraded copy, left as it is.
+func Open(target string) (*dbexport.ReadOnlyVpd, error) {
+	return dbexport.OpenVpdReadOnly(target)
+}
+
+type Result struct {
+	Columns []string
+	Rows    [][]interface{}
+}
+
+func query(db *sql.DB, cmd string, args ...interface{}) (Result, error) {
+	var rv Result
+	rows, err := db.Query(cmd, args...)
+	if err != nil {
+		return rv, err
+	}
+	defer rows.Close()
+	if rv.Columns, err = rows.Columns(); err != nil {
+		return rv, err
+	}
+	for rows.Next() {
+		vals := make([]interface{}, len(rv.Columns))
+		ptrs := make([]interface{}, len(vals))
+		for i := range vals {
+			ptrs[i] = &vals[i]
+		}
+		if err := rows.Scan(ptrs...); err != nil {
+			return rv, err
+		}
+		for i, v := range vals {
+			if b, ok := v.([]byte); ok {
+				vals[i] = string(b)
+			}
+		}
+		rv.Rows = append(rv.Rows, vals)
+	}
+	return rv, rows.Err()
+}
+
+// RunReport binds the params given over the defaults of the report
+func RunReport(db *sql.DB, report Report, params map[string]string) (Result, error) {
+	known := make(map[string]bool)
+	var args []interface{}
+	for _, p := range report.Params {
+		known[p.Name] = true
+		value, ok := params[p.Name]
+		if !ok {
+			value = p.Default
+		}
+		args = append(args, sql.Named(p.Name, bindValue(value)))
+	}
+	var unknown []string
+	for name := range params {
+		if !known[name] {
+			unknown = append(unknown, name)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return Result{}, fmt.Errorf("unknown param(s) of %v: %v",
+			report.Name, strings.Join(unknown, ", "))
+	}
+	rv, err := query(db, report.SQL, args...)
+	if err != nil {
+		return rv, fmt.Errorf("%v: %v", report.Name, err)
+	}
+	return rv, nil
+}
+
+// RunSQL binds the args to the ? of the query in order
+func RunSQL(db *sql.DB, cmd string, args []string) (Result, error) {
+	var binds []interface{}
+	for _, arg := range args {
+		binds = append(binds, bindValue(arg))
+	}
+	return query(db, cmd, binds...)
+}
@@ -0,0 +1,160 @@
+package vpdquery
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"git.enflame.cn/hai.bai/dmaster/dbexport"
+)
+
+func newQueryVpd(t *testing.T) string {
+	target := filepath.Join(t.TempDir(), "foo.vpd")
+	dbs, err := dbexport.NewDbSession(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dbs.Close()
+	db, err := sql.Open("sqlite3", target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	for _, cmd := range []string{
+		`insert into dtu_op(idx, device_id, op_name, task_id, row_name,
+			start_timestamp, end_timestamp, duration_timestamp) values
+			(0, 0, 'conv', 1, '` + dbexport.DtuOpRowName + `', 0, 100, 100),
+			(1, 0, 'relu', 1, '` + dbexport.DtuOpRowName + `', 100, 110, 10),
+			(2, 1, 'conv', 2, '` + dbexport.DtuOpRowName + `', 0, 300, 300),
+			(3, 0, 'Task.1', 1, 'Pg 000001', 0, 110, 110)`,
+		`insert into memcpy(idx, device_id, name, engine_type, tiling_mode,
+			packet_id, duration_timestamp) values
+			(4, 0, 'DMA VC0', 'CDMA', 'Slice', 7, 10),
+			(5, 0, 'DMA VC1', 'CDMA', 'Slice', 8, 10),
+			(6, 0, 'DMA BUSY', 'CDMA', NULL, 9, 50)`,
+	} {
+		if _, err := db.Exec(cmd); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return target
+}
+
+func TestQueryReports(t *testing.T) {
+	db, err := Open(newQueryVpd(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	top, _ := FindReport("top_ops")
+	result, err := RunReport(db.DB, top, map[string]string{"limit": "1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Rows) != 1 || result.Rows[0][0] != "conv" ||
+		result.Rows[0][2] != int64(400) {
+		t.Errorf("expecting conv of 400 ns on top, got %v", result.Rows)
+	}
+	result, err = RunReport(db.DB, top, map[string]string{"device": "0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Rows) != 2 || result.Rows[0][2] != int64(100) {
+		t.Errorf("expecting 2 ops of device 0, got %v", result.Rows)
+	}
+	if _, err := RunReport(db.DB, top, map[string]string{"devise": "0"}); err == nil {
+		t.Errorf("expecting error of unknown param")
+	}
+
+	tiling, _ := FindReport("dma_tiling")
+	result, err = RunReport(db.DB, tiling, map[string]string{"name": "DMA VC%"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := &bytes.Buffer{}
+	if err := result.Write(out, Format_Csv); err != nil {
+		t.Fatal(err)
+	}
+	expected := "engine_type,tiling_mode,count,total_ns,src_bytes,packets\n" +
+		"CDMA,Slice,2,20,0,2\n"
+	if out.String() != expected {
+		t.Errorf("expecting:\n%vgot:\n%v", expected, out.String())
+	}
+
+	for _, r := range Reports() {
+		if _, err := RunReport(db.DB, r, nil); err != nil {
+			t.Errorf("report %v: %v", r.Name, err)
+		}
+	}
+}
+
+func TestQuerySQL(t *testing.T) {
+	db, err := Open(newQueryVpd(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	result, err := RunSQL(db.DB,
+		`select name, tiling_mode from memcpy where packet_id = ?`, []string{"9"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := &bytes.Buffer{}
+	if err := result.Write(out, Format_Json); err != nil {
+		t.Fatal(err)
+	}
+	var objs []map[string]interface{}
+	if err := json.Unmarshal(out.Bytes(), &objs); err != nil {
+		t.Fatal(err)
+	}
+	if len(objs) != 1 || objs[0]["name"] != "DMA BUSY" || objs[0]["tiling_mode"] != nil {
+		t.Errorf("unexpected json: %v", out.String())
+	}
+
+	out.Reset()
+	if err := result.Write(out, Format_Table); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(out.String(), "name      tiling_mode\nDMA BUSY") {
+		t.Errorf("unexpected table:\n%v", out.String())
+	}
+
+	if _, err := RunSQL(db.DB, `delete from memcpy`, nil); err == nil {
+		t.Errorf("expecting the vpd read only")
+	}
+	if err := result.Write(out, "xml"); err == nil {
+		t.Errorf("expecting error of unknown format")
+	}
+}
+
+func TestQueryOlderVpd(t *testing.T) {
+	target := newQueryVpd(t)
+	db, err := sql.Open("sqlite3", target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	older := dbexport.CurrentSchemaVersion() - 1
+	if _, err := db.Exec(`update schema_version set version = ?`, older); err != nil {
+		t.Fatal(err)
+	}
+
+	vpd, err := Open(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := RunSQL(vpd.DB, `select count(*) from dtu_op`, nil)
+	vpd.Close()
+	if err != nil || len(result.Rows) != 1 || result.Rows[0][0] != int64(4) {
+		t.Errorf("expecting 4 dtu_op rows, got %v: %v", result.Rows, err)
+	}
+	// The vpd itself is not upgraded
+	if v, err := dbexport.DetectSchemaVersion(db); err != nil || v != older {
+		t.Errorf("expecting the vpd left at %v, got %v: %v", older, v, err)
+	}
+}
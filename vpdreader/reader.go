@@ -0,0 +1,449 @@
+// Package vpdreader loads the activities of a vpd back into the rtdata
+// structures they were dumped from, for analyses done in Go.
+package vpdreader
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"git.enflame.cn/hai.bai/dmaster/codec"
+	"git.enflame.cn/hai.bai/dmaster/dbexport"
+	"git.enflame.cn/hai.bai/dmaster/meta/metadata"
+	"git.enflame.cn/hai.bai/dmaster/rtinfo/rtdata"
+	"git.enflame.cn/hai.bai/dmaster/topsdev/mimic/mimicdefs"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// Filter selects the rows to load, the zero value selects all of them
+type Filter struct {
+	// Host time in ns, rows overlapping [StartNs, EndNs) are kept.
+	// Zero is no bound.
+	StartNs, EndNs uint64
+	// Empty for all the devices
+	Devices []rtdata.Coords
+	// Empty for all the captures
+	Captures []int
+}
+
+func (f Filter) where(conds ...string) (string, []interface{}) {
+	var args []interface{}
+	if f.StartNs > 0 {
+		conds = append(conds, "end_timestamp > ?")
+		args = append(args, f.StartNs)
+	}
+	if f.EndNs > 0 {
+		conds = append(conds, "start_timestamp < ?")
+		args = append(args, f.EndNs)
+	}
+	if len(f.Devices) > 0 {
+		var devs []string
+		for _, d := range f.Devices {
+			devs = append(devs, "(node_id = ? AND device_id = ?)")
+			args = append(args, d.NodeID, d.DeviceID)
+		}
+		conds = append(conds, "("+strings.Join(devs, " OR ")+")")
+	}
+	if len(f.Captures) > 0 {
+		conds = append(conds, "capture_id IN (?"+
+			strings.Repeat(", ?", len(f.Captures)-1)+")")
+		for _, c := range f.Captures {
+			args = append(args, c)
+		}
+	}
+	if len(conds) == 0 {
+		return "", args
+	}
+	return " WHERE " + strings.Join(conds, " AND "), args
+}
+
+// Row has the columns shared by dtu_op, fw, memcpy and kernel
+type Row struct {
+	Idx       int
+	CaptureId int // -1 if not tagged
+	Coords    rtdata.Coords
+	Name      string
+	RowName   string
+	StartNs   uint64
+	EndNs     uint64
+}
+
+const rowColumns = `idx, IFNULL(capture_id, -1), node_id, device_id,
+	IFNULL(name, ''), IFNULL(row_name, ''), start_timestamp, end_timestamp,
+	IFNULL(start_cycle, 0), IFNULL(end_cycle, 0),
+	IFNULL(cluster_id, -1), IFNULL(context_id, -1)`
+
+// What rowColumns scan into, besides Row
+type rowCycles struct {
+	startCy, endCy     uint64
+	clusterID, context int
+}
+
+func (r *Row) dests(cy *rowCycles) []interface{} {
+	return []interface{}{&r.Idx, &r.CaptureId,
+		&r.Coords.NodeID, &r.Coords.DeviceID,
+		&r.Name, &r.RowName, &r.StartNs, &r.EndNs,
+		&cy.startCy, &cy.endCy, &cy.clusterID, &cy.context}
+}
+
+func (cy rowCycles) dpfAct() rtdata.DpfAct {
+	return rtdata.DpfAct{
+		Start: codec.DpfEvent{Cycle: cy.startCy,
+			ClusterID: cy.clusterID, Context: cy.context},
+		End: codec.DpfEvent{Cycle: cy.endCy,
+			ClusterID: cy.clusterID, Context: cy.context},
+	}
+}
+
+type OpRecord struct {
+	Row
+	Act rtdata.OpActivity
+}
+
+// TaskRecord is a task on its Pg track of dtu_op
+type TaskRecord struct {
+	Row
+	Task rtdata.RuntimeTask
+}
+
+// FwRecord has the event of the activity in RowName only,
+// Start.Event is not kept in the vpd
+type FwRecord struct {
+	Row
+	Act rtdata.FwActivity
+}
+
+// DmaRecord has the DMA meta columns of memcpy, unknown ones are zero
+type DmaRecord struct {
+	Row
+	Act              rtdata.CookedDmaActivity
+	SrcAddr, DstAddr int64
+	SrcSize, DstSize int64
+	Direction        string
+}
+
+type KernelRecord struct {
+	Row
+	Act rtdata.KernelActivity
+}
+
+type Reader struct {
+	target string
+	vpd    *dbexport.ReadOnlyVpd
+	db     *sql.DB
+}
+
+// Open reads the vpd only, one of an older schema through an upgraded
+// copy, and refuses the newer ones.
+func Open(target string) (*Reader, error) {
+	vpd, err := dbexport.OpenVpdReadOnly(target)
+	if err != nil {
+		return nil, err
+	}
+	return &Reader{target: target, vpd: vpd, db: vpd.DB}, nil
+}
+
+func (r *Reader) Close() error {
+	return r.vpd.Close()
+}
+
+// DB is for the queries not covered here
+func (r *Reader) DB() *sql.DB {
+	return r.db
+}
+
+func (r *Reader) query(table, columns string, f Filter, conds []string,
+	scan func(rows *sql.Rows) error) error {
+	where, args := f.where(conds...)
+	rows, err := r.db.Query(fmt.Sprintf("SELECT %v, %v FROM %v%v ORDER BY idx",
+		rowColumns, columns, table, where), args...)
+	if err != nil {
+		return fmt.Errorf("%v: %v: %v", r.target, table, err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		if err := scan(rows); err != nil {
+			return fmt.Errorf("%v: %v: %v", r.target, table, err)
+		}
+	}
+	return rows.Err()
+}
+
+// Tasks of the same device, id and executable share one RuntimeTask
+type taskKey struct {
+	coords   rtdata.Coords
+	taskId   int
+	execUuid uint64
+}
+
+type taskCache map[taskKey]*rtdata.RuntimeTask
+
+func (tc taskCache) get(coords rtdata.Coords,
+	taskId sql.NullInt64, execUuid sql.NullString) *rtdata.RuntimeTask {
+	if !taskId.Valid || !execUuid.Valid {
+		return nil
+	}
+	uuid, err := strconv.ParseUint(execUuid.String, 0, 64)
+	if err != nil {
+		return nil
+	}
+	key := taskKey{coords, int(taskId.Int64), uuid}
+	if task, ok := tc[key]; ok {
+		return task
+	}
+	task := &rtdata.RuntimeTask{
+		RuntimeTaskBase: rtdata.RuntimeTaskBase{
+			TaskID: key.taskId, ExecutableUUID: uuid},
+		MetaValid: true,
+	}
+	tc[key] = task
+	return task
+}
+
+// DtuOps are the ops on the DTU op track, with the op and task they
+// belong to if known
+func (r *Reader) DtuOps(f Filter) ([]OpRecord, error) {
+	var rv []OpRecord
+	tasks := make(taskCache)
+	err := r.query("dtu_op", "IFNULL(op_id, -1), IFNULL(op_name, ''), task_id, exec_uuid",
+		f, []string{fmt.Sprintf("row_name = '%v'", dbexport.DtuOpRowName)},
+		func(rows *sql.Rows) error {
+			var rec OpRecord
+			var cy rowCycles
+			var opId int
+			var opName string
+			var taskId sql.NullInt64
+			var execUuid sql.NullString
+			if err := rows.Scan(append(rec.dests(&cy),
+				&opId, &opName, &taskId, &execUuid)...); err != nil {
+				return err
+			}
+			rec.Act.DpfAct = cy.dpfAct()
+			if task := tasks.get(rec.Coords, taskId, execUuid); task != nil {
+				// op_name is dumped as name.op_id
+				opName = strings.TrimSuffix(opName, fmt.Sprintf(".%v", opId))
+				rec.Act.SetOpRef(rtdata.NewOpRef(
+					&metadata.DtuOp{OpName: opName, OpId: opId}, task))
+			}
+			rv = append(rv, rec)
+			return nil
+		})
+	return rv, err
+}
+
+// Tasks are the rows of the Pg tracks, named after the Pg mask
+func (r *Reader) Tasks(f Filter) ([]TaskRecord, error) {
+	var rv []TaskRecord
+	err := r.query("dtu_op", "IFNULL(task_id, -1), IFNULL(exec_uuid, '')",
+		f, []string{"row_name LIKE 'Pg %'"},
+		func(rows *sql.Rows) error {
+			var rec TaskRecord
+			var cy rowCycles
+			var execUuid string
+			if err := rows.Scan(append(rec.dests(&cy),
+				&rec.Task.TaskID, &execUuid)...); err != nil {
+				return err
+			}
+			uuid, _ := strconv.ParseUint(execUuid, 0, 64)
+			pgMask, _ := strconv.ParseInt(strings.TrimPrefix(rec.RowName, "Pg "), 2, 32)
+			rec.Task.ExecutableUUID = uuid
+			rec.Task.PgMask = int(pgMask)
+			rec.Task.StartCycle, rec.Task.EndCycle = cy.startCy, cy.endCy
+			rec.Task.CycleValid = true
+			rec.Task.MetaValid = execUuid != ""
+			rv = append(rv, rec)
+			return nil
+		})
+	return rv, err
+}
+
+func (r *Reader) FwActs(f Filter) ([]FwRecord, error) {
+	var rv []FwRecord
+	err := r.query("fw", "IFNULL(packet_id, 0), IFNULL(engine_type, ''), IFNULL(engine_id, 0)",
+		f, nil,
+		func(rows *sql.Rows) error {
+			var rec FwRecord
+			var cy rowCycles
+			var packetID, engineIndex int
+			var engineType string
+			if err := rows.Scan(append(rec.dests(&cy),
+				&packetID, &engineType, &engineIndex)...); err != nil {
+				return err
+			}
+			rec.Act.DpfAct = cy.dpfAct()
+			setEngine(&rec.Act.DpfAct, codec.ToEngineTypeCode(engineType),
+				engineIndex, packetID)
+			rv = append(rv, rec)
+			return nil
+		})
+	return rv, err
+}
+
+func setEngine(act *rtdata.DpfAct, engineType codec.EngineTypeCode,
+	engineIndex, packetID int) {
+	for _, evt := range []*codec.DpfEvent{&act.Start, &act.End} {
+		evt.EngineTypeCode = engineType
+		evt.EngineIndex = engineIndex
+		evt.PacketID = packetID
+	}
+}
+
+func toDmaMatchStatus(s string) rtdata.DmaMatchStatus {
+	for _, status := range []rtdata.DmaMatchStatus{
+		rtdata.DmaMatch_Matched, rtdata.DmaMatch_Skipped} {
+		if s == status.String() {
+			return status
+		}
+	}
+	return rtdata.DmaMatch_NoMeta
+}
+
+// DmaActs have the DMA meta and task if matched, and the owner op.
+// The vc is put back into Start.Event so that GetVcId works.
+func (r *Reader) DmaActs(f Filter) ([]DmaRecord, error) {
+	var rv []DmaRecord
+	tasks := make(taskCache)
+	err := r.query("memcpy", `IFNULL(packet_id, 0), IFNULL(engine_type, ''),
+		IFNULL(engine_id, 0), IFNULL(vc, 0),
+		IFNULL(src_addr, 0), IFNULL(dst_addr, 0),
+		IFNULL(src_size, 0), IFNULL(dst_size, 0), IFNULL(direction, ''),
+		dma_op, task_id, exec_uuid, op_id, IFNULL(op_name, ''),
+		IFNULL(match_status, '')`,
+		f, nil,
+		func(rows *sql.Rows) error {
+			var rec DmaRecord
+			var cy rowCycles
+			var packetID, engineIndex, vc int
+			var engineType, opName, status string
+			var dmaOp, execUuid sql.NullString
+			var taskId, opId sql.NullInt64
+			if err := rows.Scan(append(rec.dests(&cy),
+				&packetID, &engineType, &engineIndex, &vc,
+				&rec.SrcAddr, &rec.DstAddr, &rec.SrcSize, &rec.DstSize,
+				&rec.Direction,
+				&dmaOp, &taskId, &execUuid, &opId, &opName,
+				&status)...); err != nil {
+				return err
+			}
+			act := &rec.Act
+			act.DpfAct = cy.dpfAct()
+			setEngine(&act.DpfAct, codec.ToEngineTypeCode(engineType),
+				engineIndex, packetID)
+			act.Start.Event = vc << 2
+			if task := tasks.get(rec.Coords, taskId, execUuid); task != nil && dmaOp.Valid {
+				act.SetDmaRef(rtdata.NewDmaRef(&metadata.DmaOp{
+					PktId:       packetID,
+					DmaOpString: dmaOp.String,
+					EngineTy:    engineType,
+					EngineIndex: engineIndex,
+				}, task))
+			}
+			act.Status = toDmaMatchStatus(status)
+			if opId.Valid {
+				act.OwnerOpValid = true
+				act.OwnerOpId, act.OwnerOpName = int(opId.Int64), opName
+			}
+			rv = append(rv, rec)
+			return nil
+		})
+	return rv, err
+}
+
+func toAttribReason(s string) rtdata.AttribReason {
+	for _, reason := range []rtdata.AttribReason{
+		rtdata.AttribReason_Contained,
+		rtdata.AttribReason_Overlap,
+		rtdata.AttribReason_Fallback} {
+		if s == reason.String() {
+			return reason
+		}
+	}
+	return rtdata.AttribReason_None
+}
+
+// KernelActs have RtInfo set if the kernel is attributed to an op,
+// the sub op name is the name without the low confidence mark
+func (r *Reader) KernelActs(f Filter) ([]KernelRecord, error) {
+	var rv []KernelRecord
+	err := r.query("kernel", `IFNULL(packet_id, 0), IFNULL(engine_type, ''),
+		IFNULL(engine_id, 0), op_id, IFNULL(confidence, 0),
+		IFNULL(attrib_reason, '')`,
+		f, nil,
+		func(rows *sql.Rows) error {
+			var rec KernelRecord
+			var cy rowCycles
+			var packetID, engineIndex int
+			var engineType, reason string
+			var opId sql.NullInt64
+			var confidence float64
+			if err := rows.Scan(append(rec.dests(&cy),
+				&packetID, &engineType, &engineIndex,
+				&opId, &confidence, &reason)...); err != nil {
+				return err
+			}
+			act := &rec.Act
+			act.DpfAct = cy.dpfAct()
+			setEngine(&act.DpfAct, codec.ToEngineTypeCode(engineType),
+				engineIndex, packetID)
+			if opId.Valid {
+				act.RtInfo.Update(0, strings.TrimSuffix(rec.Name, " (?)"),
+					int(opId.Int64))
+				act.RtInfo.UpdateAttribution(confidence, toAttribReason(reason))
+			}
+			rv = append(rv, rec)
+			return nil
+		})
+	return rv, err
+}
+
+// HostInfo of the first capture selected, time and devices of the
+// filter do not apply
+func (r *Reader) HostInfo(f Filter) (mimicdefs.HostInfo, error) {
+	var rv mimicdefs.HostInfo
+	where, args := Filter{Captures: f.Captures}.where()
+	cmd := &rv.CommandInfo
+	err := r.db.QueryRow(`SELECT IFNULL(command, ''),
+		IFNULL(start_timestamp, 0), IFNULL(end_timestamp, 0)
+		FROM command`+where+` ORDER BY rowid LIMIT 1`, args...).Scan(
+		&cmd.Command, &cmd.StartTimestamp, &cmd.EndTimestamp)
+	if err != nil && err != sql.ErrNoRows {
+		return rv, fmt.Errorf("%v: command: %v", r.target, err)
+	}
+
+	ver := &rv.VersionInfo
+	err = r.db.QueryRow(`SELECT IFNULL(sdk_version, ''),
+		IFNULL(framework_version, ''), IFNULL(profile_data_name, ''),
+		IFNULL(profile_data_type, ''), IFNULL(profile_data_version, '')
+		FROM version`+where+` ORDER BY rowid LIMIT 1`, args...).Scan(
+		&ver.SdkVersion, &ver.FrameworkVersion, &ver.ProfileDataName,
+		&ver.ProfileDataType, &ver.ProfileDataVersion)
+	if err != nil && err != sql.ErrNoRows {
+		return rv, fmt.Errorf("%v: version: %v", r.target, err)
+	}
+
+	rows, err := r.db.Query(`SELECT IFNULL(product, ''),
+		IFNULL(platform, ''), IFNULL(os_name, ''),
+		IFNULL(os_version, ''), IFNULL(os_release, ''),
+		IFNULL(host_name, ''), IFNULL(arch, ''),
+		IFNULL(cpu_model, ''), IFNULL(cpu_vendor, ''),
+		IFNULL(distribution_name, '')
+		FROM platform`+where+` ORDER BY rowid`, args...)
+	if err != nil {
+		return rv, fmt.Errorf("%v: platform: %v", r.target, err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var pl mimicdefs.PlatformInfo
+		if err := rows.Scan(&pl.Product,
+			&pl.Platform, &pl.OsName,
+			&pl.OsVersion, &pl.OsRelease,
+			&pl.HostName, &pl.Arch,
+			&pl.CpuModel, &pl.CpuVendor,
+			&pl.DistributionName); err != nil {
+			return rv, fmt.Errorf("%v: platform: %v", r.target, err)
+		}
+		rv.PlatformInfo = append(rv.PlatformInfo, pl)
+	}
+	return rv, rows.Err()
+}
@@ -0,0 +1,185 @@
+package vpdreader
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"git.enflame.cn/hai.bai/dmaster/dbexport"
+	"git.enflame.cn/hai.bai/dmaster/rtinfo/rtdata"
+	"git.enflame.cn/hai.bai/dmaster/topsdev/mimic/mimicdefs"
+)
+
+var testPlatform = mimicdefs.PlatformInfo{
+	Product: "i20", Platform: "x86_64",
+	OsName: "Linux", OsVersion: "#1 SMP", OsRelease: "5.4.0",
+	HostName: "node0", Arch: "x86_64",
+	CpuModel: "Xeon", CpuVendor: "GenuineIntel",
+	DistributionName: "ubuntu",
+}
+
+func makeVpd(t *testing.T) string {
+	target := filepath.Join(t.TempDir(), "foo.vpd")
+	dbs, err := dbexport.NewDbSession(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dbs.DumpHostInfo(mimicdefs.HostInfo{
+		CommandInfo:  mimicdefs.CommandInfo{Command: "python3 foo.py"},
+		VersionInfo:  mimicdefs.VersionInfo{SdkVersion: "2.1"},
+		PlatformInfo: []mimicdefs.PlatformInfo{testPlatform},
+	})
+	dbs.Close()
+
+	db, err := sql.Open("sqlite3", target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	// Task 1 on device 0 runs op 3, task 2 on device 1 runs op 4
+	if _, err := db.Exec(`
+		insert into dtu_op(idx, node_id, device_id, cluster_id, context_id,
+			name, row_name, op_id, op_name, task_id, exec_uuid,
+			start_timestamp, end_timestamp, start_cycle, end_cycle, capture_id)
+		values(0, 0, 0, -1, -1, 'Task.1 0xab', 'Pg 000011', 0, 'Task.1 0xab',
+				1, '0x00000000000000ab', 100, 400, 1000, 4000, 0),
+			(1, 0, 0, -1, 2, 'conv.3', ?, 3, 'conv.3', 1, '0x00000000000000ab',
+				150, 300, 1500, 3000, 0),
+			(2, 0, 1, -1, 2, 'dot.4', ?, 4, 'dot.4', 2, '0x00000000000000cd',
+				500, 600, 5000, 6000, 0);
+		insert into fw(idx, node_id, device_id, cluster_id, context_id, name,
+			row_name, packet_id, engine_type, engine_id,
+			start_timestamp, end_timestamp, start_cycle, end_cycle, capture_id)
+		values(3, 0, 0, 0, 2, 'Task.1', 'CQM Executable', 7, 'CQM', 1,
+			120, 380, 1200, 3800, 0);
+		insert into memcpy(idx, node_id, device_id, cluster_id, context_id, name,
+			row_name, packet_id, engine_type, engine_id, vc, direction,
+			src_size, dst_size, dma_op, task_id, exec_uuid, op_id, op_name,
+			match_status, start_timestamp, end_timestamp, start_cycle, end_cycle,
+			capture_id)
+		values(4, 0, 0, 0, 2, 'DMA', 'DMA', 9, 'SDMA', 2, 5, 'L3->L2',
+			1024, 1024, 'Slice', 1, '0x00000000000000ab', 3, 'conv.3',
+			'matched', 160, 200, 1600, 2000, 0);
+		insert into kernel(idx, node_id, device_id, cluster_id, context_id, name,
+			row_name, packet_id, engine_type, engine_id, op_id, confidence,
+			attrib_reason, start_timestamp, end_timestamp, start_cycle, end_cycle,
+			capture_id)
+		values(5, 0, 0, 0, 2, 'conv_kernel (?)', 'SIP', 11, 'SIP', 3, 3, 0.25,
+			'overlap', 210, 290, 2100, 2900, 0);`,
+		dbexport.DtuOpRowName, dbexport.DtuOpRowName); err != nil {
+		t.Fatal(err)
+	}
+	return target
+}
+
+func TestReadActivities(t *testing.T) {
+	r, err := Open(makeVpd(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	ops, err := r.DtuOps(Filter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ops) != 2 || !ops[0].Act.IsOpRefValid() {
+		t.Fatalf("expecting 2 ops with op ref, got %+v", ops)
+	}
+	op, task := ops[0].Act.GetOp(), ops[0].Act.GetTask()
+	if op.OpName != "conv" || op.OpId != 3 ||
+		task.TaskID != 1 || task.ExecutableUUID != 0xab ||
+		ops[0].Act.StartCycle() != 1500 || ops[0].Act.Start.Context != 2 {
+		t.Errorf("unexpected op %+v of task %+v", op, task)
+	}
+
+	tasks, err := r.Tasks(Filter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tasks) != 1 || tasks[0].Task.PgMask != 3 ||
+		tasks[0].Task.EndCycle != 4000 {
+		t.Errorf("unexpected tasks %+v", tasks)
+	}
+
+	fws, err := r.FwActs(Filter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fws) != 1 || fws[0].Act.Start.PacketID != 7 ||
+		fws[0].Act.Start.EngineTypeCode.String() != "CQM" {
+		t.Errorf("unexpected fw %+v", fws)
+	}
+
+	dmas, err := r.DmaActs(Filter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dmas) != 1 {
+		t.Fatalf("expecting 1 dma, got %v", len(dmas))
+	}
+	dma := dmas[0]
+	if !dma.Act.IsDmaMetaRefValid() || dma.Act.GetDmaMeta().DmaOpString != "Slice" ||
+		dma.Act.GetVcId() != 5 || dma.Act.Status != rtdata.DmaMatch_Matched ||
+		dma.Act.OwnerOpId != 3 || dma.SrcSize != 1024 {
+		t.Errorf("unexpected dma %+v", dma)
+	}
+
+	kernels, err := r.KernelActs(Filter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(kernels) != 1 {
+		t.Fatalf("expecting 1 kernel, got %v", len(kernels))
+	}
+	rtInfo := kernels[0].Act.RtInfo
+	if !rtInfo.SubValid || rtInfo.Name != "conv_kernel" || rtInfo.OpId != 3 ||
+		rtInfo.Reason != rtdata.AttribReason_Overlap || !rtInfo.IsLowConfidence() {
+		t.Errorf("unexpected kernel attribution %+v", rtInfo)
+	}
+
+	hostInfo, err := r.HostInfo(Filter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hostInfo.CommandInfo.Command != "python3 foo.py" ||
+		hostInfo.VersionInfo.SdkVersion != "2.1" ||
+		len(hostInfo.PlatformInfo) != 1 {
+		t.Errorf("unexpected host info %+v", hostInfo)
+	}
+	if len(hostInfo.PlatformInfo) == 1 && hostInfo.PlatformInfo[0] != testPlatform {
+		t.Errorf("expecting platform %+v, got %+v",
+			testPlatform, hostInfo.PlatformInfo[0])
+	}
+
+	if _, err := r.DB().Exec(`delete from dtu_op`); err == nil {
+		t.Errorf("expecting the vpd read only")
+	}
+}
+
+func TestReadFiltered(t *testing.T) {
+	r, err := Open(makeVpd(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	for _, c := range []struct {
+		f        Filter
+		expected int
+	}{
+		{Filter{Devices: []rtdata.Coords{{NodeID: 0, DeviceID: 1}}}, 1},
+		{Filter{StartNs: 350}, 1},
+		{Filter{EndNs: 150}, 0},
+		{Filter{StartNs: 200, EndNs: 550}, 2},
+		{Filter{Captures: []int{1}}, 0},
+	} {
+		ops, err := r.DtuOps(c.f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(ops) != c.expected {
+			t.Errorf("%+v: expecting %v ops, got %v", c.f, c.expected, len(ops))
+		}
+	}
+}